@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/HyperGAI/serving-agent/storage"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// The default size limit of an uploaded file
+const defaultMaxArtifactSize = 100 << 20
+
+// upload stores the file in the object store and returns its stable URL. The file is sent either
+// in the multipart form field `file` or as the raw request body.
+func (server *Server) upload(ctx *gin.Context) {
+	if server.artifacts == nil {
+		respondError(ctx, http.StatusNotFound, errors.New("the upload service is not enabled"))
+		return
+	}
+	maxSize := server.config.MaxArtifactSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxArtifactSize
+	}
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxSize)
+
+	var reader io.Reader = ctx.Request.Body
+	contentType, ext := ctx.ContentType(), ""
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		file, header, err := ctx.Request.FormFile("file")
+		if err != nil {
+			respondError(ctx, uploadErrorCode(err), err)
+			return
+		}
+		defer file.Close()
+		reader, contentType, ext = file, header.Header.Get("Content-Type"), path.Ext(header.Filename)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		respondError(ctx, uploadErrorCode(err), err)
+		return
+	}
+	if len(data) == 0 {
+		respondError(ctx, http.StatusBadRequest, errors.New("the file is empty"))
+		return
+	}
+	url, err := server.artifacts.Save(ctx.Request.Context(), data, contentType, ext)
+	if err != nil {
+		respondError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"url": url})
+}
+
+func uploadErrorCode(err error) int {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// getFile serves the artifact stored by `upload` or re-hosted from the model outputs by the permanent URL.
+// If signing is enabled, the artifacts are only served by `getSignedFile`.
+func (server *Server) getFile(ctx *gin.Context) {
+	if server.artifacts == nil {
+		respondError(ctx, http.StatusNotFound, errors.New("the upload service is not enabled"))
+		return
+	}
+	if server.artifacts.Signed() {
+		respondError(ctx, http.StatusForbidden, errors.New("a signed URL is required"))
+		return
+	}
+	server.sendFile(ctx, strings.TrimPrefix(ctx.Param("key"), "/"), "public, max-age=31536000, immutable")
+}
+
+// getSignedFile serves the artifact by the signed URL, i.e., `/artifacts/{name}?expires=...&key_id=...&signature=...`.
+func (server *Server) getSignedFile(ctx *gin.Context) {
+	if !server.artifacts.Signed() {
+		respondError(ctx, http.StatusNotFound, errors.New("the signed URLs are not enabled"))
+		return
+	}
+	name := strings.TrimPrefix(ctx.Param("name"), "/")
+	if err := server.artifacts.Verify(name, ctx.Request.URL.Query()); err != nil {
+		respondError(ctx, http.StatusForbidden, err)
+		return
+	}
+	// The signed URLs must not be cached longer than they are valid
+	server.sendFile(ctx, storage.ArtifactPrefix+name, "private, no-store")
+}
+
+func (server *Server) sendFile(ctx *gin.Context, key string, cacheControl string) {
+	data, contentType, err := server.artifacts.Load(ctx.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondError(ctx, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		respondError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	ctx.Header("Cache-Control", cacheControl)
+	ctx.Data(http.StatusOK, contentType, data)
+}
+
+// resignResponse re-signs the artifact URLs in a stored JSON response.
+func (server *Server) resignResponse(data json.RawMessage) interface{} {
+	if !server.artifacts.Signed() {
+		return data
+	}
+	var response interface{}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return data
+	}
+	return server.artifacts.Resign(response)
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"fmt"
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/worker"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"sync"
+)
+
+// BatchRequest is the request of the batch prediction APIs, i.e., a list of inputs for one model.
+type BatchRequest struct {
+	ModelName string                   `json:"model_name" binding:"required"`
+	Inputs    []map[string]interface{} `json:"inputs" binding:"required"`
+}
+
+// batchItem is the result of a child task, in the same order as the inputs.
+type batchItem struct {
+	ID          string      `json:"id"`
+	Status      string      `json:"status"`
+	Outputs     interface{} `json:"outputs,omitempty"`
+	RunningTime string      `json:"running_time,omitempty"`
+	ErrorInfo   string      `json:"error_info,omitempty"`
+}
+
+// batchResponse is the status of a batch with the aggregated results of the child tasks.
+type batchResponse struct {
+	ID        string      `json:"id"`
+	ModelName string      `json:"model_name"`
+	Status    string      `json:"status"`
+	Total     int         `json:"total"`
+	Finished  int         `json:"finished"`
+	Succeeded int         `json:"succeeded"`
+	Failed    int         `json:"failed"`
+	Progress  float64     `json:"progress"`
+	Results   []batchItem `json:"results"`
+}
+
+// newBatchResponse aggregates the results. The batch is `running` until all the child tasks are finished,
+// and then `succeeded`, `failed` or `partially_succeeded`.
+func newBatchResponse(id string, modelName string, results []batchItem) *batchResponse {
+	response := batchResponse{ID: id, ModelName: modelName, Total: len(results), Results: results}
+	for _, item := range results {
+		switch item.Status {
+		case "succeeded":
+			response.Succeeded++
+			response.Finished++
+		case "failed", "canceled":
+			response.Failed++
+			response.Finished++
+		}
+	}
+	if response.Total > 0 {
+		response.Progress = float64(response.Finished) / float64(response.Total)
+	}
+	switch {
+	case response.Finished < response.Total:
+		response.Status = "running"
+	case response.Failed == 0:
+		response.Status = "succeeded"
+	case response.Succeeded == 0:
+		response.Status = "failed"
+	default:
+		response.Status = "partially_succeeded"
+	}
+	return &response
+}
+
+// forEach calls `fn` for the indexes in [0, n) with at most `BATCH_CONCURRENCY` goroutines.
+func (server *Server) forEach(n int, fn func(i int)) {
+	concurrency := server.config.BatchConcurrency
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// bindBatchRequest parses and validates the batch request. It writes a 400 response and returns false
+// if the request is invalid. The violations of the inputs are reported as `inputs[i].field`.
+func (server *Server) bindBatchRequest(ctx *gin.Context) ([]platform.InferRequest, bool) {
+	var req BatchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		respondError(ctx, http.StatusBadRequest, err)
+		return nil, false
+	}
+	if len(req.Inputs) == 0 {
+		respondError(ctx, http.StatusBadRequest, fmt.Errorf("inputs is empty"))
+		return nil, false
+	}
+	if server.config.MaxBatchSize > 0 && len(req.Inputs) > server.config.MaxBatchSize {
+		respondError(ctx, http.StatusBadRequest, fmt.Errorf(
+			"the batch size %d exceeds the limit %d", len(req.Inputs), server.config.MaxBatchSize))
+		return nil, false
+	}
+
+	requests := make([]platform.InferRequest, len(req.Inputs))
+	violations := make([]platform.Violation, 0)
+	for i, inputs := range req.Inputs {
+		if inputs == nil {
+			respondError(ctx, http.StatusBadRequest, fmt.Errorf("inputs[%d] must be an object", i))
+			return nil, false
+		}
+		for _, violation := range server.inputViolations(req.ModelName, inputs) {
+			violation.Field = fmt.Sprintf("inputs[%d].%s", i, violation.Field)
+			violations = append(violations, violation)
+		}
+		requests[i] = platform.InferRequest{ModelName: req.ModelName, Inputs: inputs}
+	}
+	if len(violations) > 0 {
+		respondViolations(ctx, violations)
+		return nil, false
+	}
+	return requests, true
+}
+
+// createBatch creates the child task records and then the parent batch record. The queued tasks,
+// i.e., with the empty status, are numbered from `queueSize`. If any record fails to be created,
+// the created child tasks are set to `failed`.
+func (server *Server) createBatch(
+	batchID string,
+	userID string,
+	requests []platform.InferRequest,
+	status string,
+	queueSize int,
+) ([]string, error) {
+	modelName := requests[0].ModelName
+	taskIDs := make([]string, len(requests))
+	for i := range taskIDs {
+		taskIDs[i] = uuid.New().String()
+	}
+	errs := make([]error, len(requests))
+	server.forEach(len(requests), func(i int) {
+		queueNum := 0
+		if status == "" {
+			queueNum = queueSize + i
+		}
+		_, errs[i] = server.webhook.CreateNewTask(taskIDs[i], userID, modelName, status, queueNum)
+	})
+
+	var err error
+	for _, e := range errs {
+		if e != nil {
+			err = fmt.Errorf("failed to create new task info: %w", e)
+			break
+		}
+	}
+	if err == nil {
+		if e := server.webhook.CreateNewBatch(batchID, userID, modelName, taskIDs); e != nil {
+			err = fmt.Errorf("failed to create new batch info: %w", e)
+		}
+	}
+	if err != nil {
+		server.forEach(len(requests), func(i int) {
+			if errs[i] != nil {
+				return
+			}
+			info := platform.UpdateRequest{ID: taskIDs[i], Status: "failed", ErrorInfo: "batch creation failed"}
+			if e := server.webhook.UpdateTaskInfo(&info); e != nil {
+				log.Error().Msgf("failed to update task info: %v", e)
+			}
+		})
+		return nil, err
+	}
+	return taskIDs, nil
+}
+
+// batchPredict runs the predictions of the batch concurrently and returns the aggregated results.
+func (server *Server) batchPredict(ctx *gin.Context) {
+	requests, ok := server.bindBatchRequest(ctx)
+	if !ok {
+		return
+	}
+	userID := ctx.Request.Header.Get("UID")
+	batchID := uuid.New().String()
+	taskIDs, err := server.createBatch(batchID, userID, requests, "running", 0)
+	if err != nil {
+		log.Error().Msgf("failed to create batch: %v", err)
+		respondError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	// The predictions are aborted if the client disconnects
+	requestCtx := ctx.Request.Context()
+	results := make([]batchItem, len(requests))
+	server.forEach(len(requests), func(i int) {
+		item := batchItem{ID: taskIDs[i], Status: "failed"}
+		info, e, err := server.runTask(requestCtx, &requests[i], taskIDs[i], "v1")
+		switch {
+		case err != nil:
+			item.ErrorInfo = err.Error()
+		case e != nil:
+			item.ErrorInfo = e.Error()
+		default:
+			item.Status = info.Status
+			item.Outputs = server.artifacts.Resign(info.Outputs)
+			item.RunningTime = info.RunningTime
+		}
+		results[i] = item
+	})
+	ctx.JSON(http.StatusOK, newBatchResponse(batchID, requests[0].ModelName, results))
+}
+
+// asyncBatchPredict submits a task for each input. The whole batch is rejected if the task queue
+// cannot hold all the tasks.
+func (server *Server) asyncBatchPredict(ctx *gin.Context) {
+	requests, ok := server.bindBatchRequest(ctx)
+	if !ok {
+		return
+	}
+
+	// Get task queue info
+	var queueSize = 0
+	queueInfo, err := server.distributor.GetTaskQueueInfo(worker.QueueCritical)
+	if err == nil {
+		queueSize = queueInfo.Scheduled + queueInfo.Pending + queueInfo.Retry
+		log.Info().Msgf("task queue current size: %d", queueSize)
+		if queueSize+len(requests) > server.config.MaxQueueSize {
+			log.Error().Msgf("the task queue cannot hold %d more tasks", len(requests))
+			respondError(ctx, http.StatusTooManyRequests, fmt.Errorf(
+				"the prediction task queue cannot hold %d more tasks, please wait for a while",
+				len(requests)))
+			return
+		}
+	}
+
+	// Add the task records and the batch record
+	userID := ctx.Request.Header.Get("UID")
+	batchID := uuid.New().String()
+	taskIDs, err := server.createBatch(batchID, userID, requests, "", queueSize)
+	if err != nil {
+		log.Error().Msgf("failed to create batch: %v", err)
+		respondError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Submit the prediction tasks. The tasks failed to be submitted are set to `failed`.
+	opts := server.taskOptions()
+	server.forEach(len(requests), func(i int) {
+		payload := &worker.PayloadRunPrediction{
+			InferRequest: requests[i],
+			ID:           taskIDs[i],
+			APIVersion:   "v1",
+		}
+		queueID, err := server.distributor.DistributeTaskRunPrediction(ctx, payload, opts...)
+		info := platform.UpdateRequest{ID: payload.ID, QueueID: queueID}
+		if err != nil {
+			log.Error().Msgf("failed to distribute prediction task %s: %v", payload.ID, err)
+			info = platform.UpdateRequest{ID: payload.ID, Status: "failed", ErrorInfo: "task queue failed"}
+		}
+		if e := server.webhook.UpdateTaskInfo(&info); e != nil {
+			log.Error().Msgf("failed to update task info: %v", e)
+			if err == nil {
+				if e := server.distributor.DeleteTask(worker.QueueCritical, queueID); e != nil {
+					log.Error().Msgf("failed to delete task from queue: %v", e)
+				}
+			}
+		}
+	})
+	ctx.JSON(http.StatusOK, gin.H{"id": batchID, "task_ids": taskIDs})
+}
+
+// getBatch returns the status of the batch and the results of the child tasks.
+func (server *Server) getBatch(ctx *gin.Context) {
+	var batchID TaskID
+	if err := ctx.ShouldBindUri(&batchID); err != nil {
+		respondError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	batch, err := server.webhook.GetBatchInfo(batchID.ID)
+	if err != nil {
+		respondError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	results := make([]batchItem, len(batch.TaskIDs))
+	server.forEach(len(batch.TaskIDs), func(i int) {
+		task, err := server.webhook.GetTaskInfoObject(batch.TaskIDs[i])
+		if err != nil {
+			log.Error().Msgf("failed to get task info: %v", err)
+			results[i] = batchItem{ID: batch.TaskIDs[i], Status: "unknown", ErrorInfo: err.Error()}
+			return
+		}
+		results[i] = batchItem{
+			ID:          batch.TaskIDs[i],
+			Status:      task.Status,
+			Outputs:     server.artifacts.Resign(task.Outputs),
+			RunningTime: task.RunningTime,
+			ErrorInfo:   task.ErrorInfo,
+		}
+	})
+	ctx.JSON(http.StatusOK, newBatchResponse(batch.ID, batch.ModelName, results))
+}
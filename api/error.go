@@ -0,0 +1,108 @@
+package api
+
+import (
+	"errors"
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/gin-gonic/gin"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrorResponse is the JSON error envelope returned by all the APIs. `Reason` is machine-readable,
+// and `Retryable` tells the clients whether the same request may succeed later.
+// `UpstreamStatus` is the status code returned by the ML platform if the error is caused by it.
+type ErrorResponse struct {
+	Error          string      `json:"error"`
+	Reason         string      `json:"reason"`
+	Retryable      bool        `json:"retryable"`
+	UpstreamStatus int         `json:"upstream_status,omitempty"`
+	Violations     interface{} `json:"violations,omitempty"`
+}
+
+// The reasons of the errors raised by the agent itself
+var statusReasons = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnprocessableEntity:   "unprocessable_request",
+	http.StatusTooManyRequests:       "too_many_requests",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+// httpStatuses maps the error codes of the platforms to the HTTP status codes.
+var httpStatuses = map[int]int{
+	platform.MarshalError:           http.StatusBadRequest,
+	platform.BuildRequestError:      http.StatusBadRequest,
+	platform.UnknownAPIVersion:      http.StatusBadRequest,
+	platform.InvalidInputError:      http.StatusUnprocessableEntity,
+	platform.UnknownModelError:      http.StatusNotFound,
+	platform.SendRequestError:       http.StatusBadGateway,
+	platform.ReadResponseError:      http.StatusBadGateway,
+	platform.UnmarshalResponseError: http.StatusBadGateway,
+	platform.UpstreamServerError:    http.StatusBadGateway,
+	platform.UpstreamAuthError:      http.StatusBadGateway,
+	platform.RateLimitedError:       http.StatusTooManyRequests,
+	platform.UnavailableError:       http.StatusServiceUnavailable,
+	platform.CircuitOpenError:       http.StatusServiceUnavailable,
+	platform.TimeoutError:           http.StatusGatewayTimeout,
+	platform.UnsupportedError:       http.StatusConflict,
+}
+
+// newErrorResponse builds the envelope. The reason of a RequestError is kept, otherwise it is derived
+// from the HTTP status code.
+func newErrorResponse(statusCode int, err error) ErrorResponse {
+	var e *platform.RequestError
+	if errors.As(err, &e) {
+		return ErrorResponse{
+			Error:          err.Error(),
+			Reason:         e.Reason,
+			Retryable:      e.Retryable,
+			UpstreamStatus: e.UpstreamStatus,
+		}
+	}
+	reason, ok := statusReasons[statusCode]
+	if !ok {
+		reason = platform.ReasonInternal
+	}
+	return ErrorResponse{
+		Error:     err.Error(),
+		Reason:    reason,
+		Retryable: statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable,
+	}
+}
+
+// respondError writes the error envelope. `Retry-After` is set if the platform asks the clients to back off.
+func respondError(ctx *gin.Context, statusCode int, err error) {
+	var e *platform.RequestError
+	if errors.As(err, &e) && e.RetryAfter > 0 {
+		ctx.Header("Retry-After", retryAfterSeconds(e.RetryAfter))
+	}
+	ctx.JSON(statusCode, newErrorResponse(statusCode, err))
+}
+
+// respondViolations writes the error envelope listing the invalid input fields.
+func respondViolations(ctx *gin.Context, violations interface{}) {
+	response := newErrorResponse(http.StatusBadRequest, errors.New("invalid inputs"))
+	response.Reason = platform.ReasonInvalidInput
+	response.Violations = violations
+	ctx.JSON(http.StatusBadRequest, response)
+}
+
+// convertErrorCode writes the error of the platform with the corresponding HTTP status code.
+func (server *Server) convertErrorCode(err *platform.RequestError, ctx *gin.Context) {
+	statusCode, ok := httpStatuses[err.StatusCode]
+	if !ok {
+		statusCode = http.StatusInternalServerError
+	}
+	respondError(ctx, statusCode, err)
+}
+
+// retryAfterSeconds formats the delay in seconds for `Retry-After`, which is rounded up.
+func retryAfterSeconds(delay time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(delay.Seconds())))
+}
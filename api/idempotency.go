@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"time"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	defaultIdempotencyTTL    = 24 * time.Hour
+)
+
+// idempotencyRecord is the state of a request with an idempotency key. `Hash` identifies the request body,
+// and `TaskID` and `Response` are set once the request succeeded.
+type idempotencyRecord struct {
+	Hash     string          `json:"hash"`
+	Done     bool            `json:"done"`
+	TaskID   string          `json:"task_id,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// idempotencyStore persists the records of the idempotency keys.
+type idempotencyStore interface {
+	// reserve saves the record with the TTL if the key is new, otherwise it returns the existing record.
+	reserve(ctx context.Context, key string, record *idempotencyRecord, ttl time.Duration) (*idempotencyRecord, error)
+	save(ctx context.Context, key string, record *idempotencyRecord, ttl time.Duration) error
+	remove(ctx context.Context, key string) error
+}
+
+type redisIdempotencyStore struct {
+	client redis.UniversalClient
+}
+
+// newIdempotencyStore returns the store in redis, or nil if redis is not configured.
+func newIdempotencyStore(client redis.UniversalClient) idempotencyStore {
+	if client == nil {
+		return nil
+	}
+	return &redisIdempotencyStore{client: client}
+}
+
+func (store *redisIdempotencyStore) reserve(
+	ctx context.Context,
+	key string,
+	record *idempotencyRecord,
+	ttl time.Duration,
+) (*idempotencyRecord, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	// The existing key may expire between SETNX and GET, so it is tried again
+	for i := 0; i < 2; i++ {
+		ok, err := store.client.SetNX(ctx, key, data, ttl).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return nil, nil
+		}
+		value, err := store.client.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var existing idempotencyRecord
+		if err := json.Unmarshal(value, &existing); err != nil {
+			return nil, err
+		}
+		return &existing, nil
+	}
+	return nil, fmt.Errorf("failed to reserve idempotency key %s", key)
+}
+
+func (store *redisIdempotencyStore) save(
+	ctx context.Context,
+	key string,
+	record *idempotencyRecord,
+	ttl time.Duration,
+) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return store.client.Set(ctx, key, data, ttl).Err()
+}
+
+func (store *redisIdempotencyStore) remove(ctx context.Context, key string) error {
+	return store.client.Del(ctx, key).Err()
+}
+
+// idempotentCall is a request holding an idempotency key. The key is released unless the request
+// is completed, so that the client can retry the failed requests. The methods of a nil call are no-ops.
+type idempotentCall struct {
+	store     idempotencyStore
+	key       string
+	hash      string
+	ttl       time.Duration
+	completed bool
+}
+
+// reserveIdempotencyKey reserves the `Idempotency-Key` of the request. It writes the response and returns
+// false if the request is a replay or conflicts with the original request. The returned call is nil if
+// the request has no key or redis is not configured.
+func (server *Server) reserveIdempotencyKey(ctx *gin.Context, scope string, req interface{}) (*idempotentCall, bool) {
+	key := ctx.Request.Header.Get(IdempotencyKeyHeader)
+	if key == "" || server.idempotency == nil {
+		return nil, true
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		respondError(ctx, http.StatusBadRequest, fmt.Errorf(
+			"%s must be at most %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength))
+		return nil, false
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		respondError(ctx, http.StatusBadRequest, err)
+		return nil, false
+	}
+	hash := sha256.Sum256(data)
+	ttl := time.Duration(server.config.IdempotencyTTL) * time.Second
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	call := &idempotentCall{
+		store: server.idempotency,
+		// The keys are scoped by the API and the user
+		key:  fmt.Sprintf("idempotency:%s:%s:%s", scope, ctx.Request.Header.Get("UID"), key),
+		hash: hex.EncodeToString(hash[:]),
+		ttl:  ttl,
+	}
+
+	// The pending key expires with the task timeout in case the agent fails before completing it
+	pendingTTL := time.Duration(server.config.TaskTimeout) * time.Second
+	if pendingTTL <= 0 || pendingTTL > ttl {
+		pendingTTL = ttl
+	}
+	existing, err := call.store.reserve(ctx, call.key, &idempotencyRecord{Hash: call.hash}, pendingTTL)
+	if err != nil {
+		log.Error().Msgf("failed to reserve idempotency key: %v", err)
+		respondError(ctx, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if existing == nil {
+		return call, true
+	}
+	switch {
+	case existing.Hash != call.hash:
+		respondError(ctx, http.StatusUnprocessableEntity, fmt.Errorf(
+			"%s has been used by a different request", IdempotencyKeyHeader))
+	case !existing.Done:
+		respondError(ctx, http.StatusConflict, fmt.Errorf(
+			"the request with the same %s is in progress", IdempotencyKeyHeader))
+	case existing.Response != nil:
+		ctx.Header(IdempotentReplayedHeader, "true")
+		ctx.JSON(http.StatusOK, server.resignResponse(existing.Response))
+	default:
+		ctx.Header(IdempotentReplayedHeader, "true")
+		ctx.JSON(http.StatusOK, gin.H{"id": existing.TaskID})
+	}
+	return nil, false
+}
+
+// uniqueID returns the queue task ID derived from the key, so that the duplicated tasks are rejected by asynq.
+func (call *idempotentCall) uniqueID() string {
+	if call == nil {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(call.key))
+	return "idempotency-" + hex.EncodeToString(hash[:16])
+}
+
+// complete saves the task ID and the response of the sync API for the replays.
+// It doesn't use the request context, which is done if the client disconnects.
+func (call *idempotentCall) complete(taskID string, response interface{}) {
+	if call == nil {
+		return
+	}
+	record := idempotencyRecord{Hash: call.hash, Done: true, TaskID: taskID}
+	if response != nil {
+		data, err := json.Marshal(response)
+		if err != nil {
+			log.Error().Msgf("failed to marshal response: %v", err)
+			return
+		}
+		record.Response = data
+	}
+	if err := call.store.save(context.Background(), call.key, &record, call.ttl); err != nil {
+		log.Error().Msgf("failed to save idempotency key: %v", err)
+		return
+	}
+	call.completed = true
+}
+
+// release deletes the key if the request is not completed.
+func (call *idempotentCall) release() {
+	if call == nil || call.completed {
+		return
+	}
+	if err := call.store.remove(context.Background(), call.key); err != nil {
+		log.Error().Msgf("failed to release idempotency key: %v", err)
+	}
+}
@@ -17,7 +17,7 @@ func newTestServer(
 	webhook platform.Webhook,
 ) *Server {
 	config := utils.Config{MaxQueueSize: 300}
-	server, err := NewServer(config, platform, distributor, webhook)
+	server, err := NewServer(config, platform, distributor, webhook, nil, nil, nil)
 	require.NoError(t, err)
 	return server
 }
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+// The failures of `Platform.Docs` are cached for a short time, so that a broken docs endpoint
+// isn't queried by every prediction request
+const schemaFailureTTL = 30 * time.Second
+
+type schemaEntry struct {
+	schema    *platform.ModelSchema
+	err       *platform.RequestError
+	expiresAt time.Time
+}
+
+// schemaCall is an in-flight `Platform.Docs` call shared by the concurrent requests of the same model.
+type schemaCall struct {
+	done  chan struct{}
+	entry schemaEntry
+}
+
+// schemaCache caches the model schemas returned by `Platform.Docs` so that the inputs
+// can be validated without querying the platform for every request.
+type schemaCache struct {
+	ttl     time.Duration
+	mutex   sync.Mutex
+	schemas map[string]schemaEntry
+	calls   map[string]*schemaCall
+}
+
+func newSchemaCache(ttl time.Duration) *schemaCache {
+	return &schemaCache{
+		ttl:     ttl,
+		schemas: make(map[string]schemaEntry),
+		calls:   make(map[string]*schemaCall),
+	}
+}
+
+// get returns the cached schema of the model, or fetches it from the platform if it has expired.
+// Only one request fetches the schema of a model at a time, and the others wait for its result.
+func (cache *schemaCache) get(p platform.Platform, modelName string) (*platform.ModelSchema, *platform.RequestError) {
+	cache.mutex.Lock()
+	if entry, ok := cache.schemas[modelName]; ok && time.Now().Before(entry.expiresAt) {
+		cache.mutex.Unlock()
+		return entry.schema, entry.err
+	}
+	if call, ok := cache.calls[modelName]; ok {
+		cache.mutex.Unlock()
+		<-call.done
+		return call.entry.schema, call.entry.err
+	}
+	call := &schemaCall{done: make(chan struct{})}
+	cache.calls[modelName] = call
+	cache.mutex.Unlock()
+
+	schema, e := p.Docs(&platform.DocsRequest{ModelName: modelName})
+	call.entry = schemaEntry{schema: schema, err: e, expiresAt: time.Now().Add(cache.ttl)}
+	if e != nil {
+		call.entry.expiresAt = time.Now().Add(min(cache.ttl, schemaFailureTTL))
+	}
+	cache.mutex.Lock()
+	cache.schemas[modelName] = call.entry
+	delete(cache.calls, modelName)
+	cache.mutex.Unlock()
+	close(call.done)
+	return schema, e
+}
+
+// validateInputs validates the inputs against the model schema if `VALIDATE_INPUTS` is enabled.
+// It writes a 400 response listing the violations and returns false if the inputs are invalid.
+func (server *Server) validateInputs(ctx *gin.Context, req *platform.InferRequest) bool {
+	violations := server.inputViolations(req.ModelName, req.Inputs)
+	if len(violations) > 0 {
+		respondViolations(ctx, violations)
+		return false
+	}
+	return true
+}
+
+// inputViolations returns the violations of the inputs if `VALIDATE_INPUTS` is enabled.
+// The inputs are not validated if the schema is unavailable, e.g., the platform is down.
+func (server *Server) inputViolations(modelName string, inputs map[string]interface{}) []platform.Violation {
+	if !server.config.ValidateInputs {
+		return nil
+	}
+	schema, e := server.schemas.get(server.platform, modelName)
+	if e != nil {
+		log.Warn().Msgf("failed to get the schema of model %s, skip validation: %v", modelName, e)
+		return nil
+	}
+	if len(schema.Inputs) == 0 {
+		return nil
+	}
+	return platform.ValidateInputs(schema, inputs, server.config.FillInputDefaults)
+}
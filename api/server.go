@@ -1,14 +1,21 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/HyperGAI/serving-agent/cache"
 	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/storage"
 	"github.com/HyperGAI/serving-agent/utils"
 	"github.com/HyperGAI/serving-agent/worker"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -18,6 +25,11 @@ type Server struct {
 	platform    platform.Platform
 	distributor worker.TaskDistributor
 	webhook     platform.Webhook
+	schemas     *schemaCache
+	cache       *cache.ResponseCache
+	idempotency idempotencyStore
+	artifacts   *storage.Artifacts
+	redis       redis.UniversalClient
 }
 
 func NewServer(
@@ -25,6 +37,9 @@ func NewServer(
 	platform platform.Platform,
 	distributor worker.TaskDistributor,
 	webhook platform.Webhook,
+	responseCache *cache.ResponseCache,
+	artifacts *storage.Artifacts,
+	redisClient redis.UniversalClient,
 ) (*Server, error) {
 	server := Server{
 		config:      config,
@@ -32,6 +47,11 @@ func NewServer(
 		platform:    platform,
 		distributor: distributor,
 		webhook:     webhook,
+		schemas:     newSchemaCache(time.Duration(config.SchemaCacheTTL) * time.Second),
+		cache:       responseCache,
+		idempotency: newIdempotencyStore(redisClient),
+		artifacts:   artifacts,
+		redis:       redisClient,
 	}
 	server.setupRouter()
 	return &server, nil
@@ -47,21 +67,33 @@ func (server *Server) setupRouter() {
 	router.POST("/unpause", server.unpauseQueue)
 	router.POST("/delete_pending", server.deleteAllPendingTasks)
 	router.GET("/unfinished", server.listUnfinishedTasks)
+	router.POST("/upload", server.upload)
+	router.GET("/files/*key", server.getFile)
+	router.GET("/artifacts/*name", server.getSignedFile)
 
 	v1Routes := router.Group("/v1")
 	v1Routes.Use(prometheusMiddleware())
-	v1Routes.POST("/predict", server.predict)
+	v1Routes.POST("/predict", server.predict("v1"))
+	v1Routes.POST("/batch_predict", server.batchPredict)
 	v1Routes.POST("/generate", server.generate)
 	v1Routes.GET("/docs", server.docs)
 	v1Routes.GET("/queue_size", server.getQueueSize)
 
+	v2Routes := router.Group("/v2")
+	v2Routes.Use(prometheusMiddleware())
+	v2Routes.POST("/predict", server.predict("v2"))
+
 	asyncV1Routes := router.Group("/async/v1")
 	asyncV1Routes.Use(prometheusMiddleware())
 	asyncV1Routes.POST("/predict", server.asyncPredict)
+	asyncV1Routes.POST("/batch_predict", server.asyncBatchPredict)
 
 	taskRoutes := router.Group("/task")
 	taskRoutes.GET("/:id", server.getTask)
 
+	batchRoutes := router.Group("/batch")
+	batchRoutes.GET("/:id", server.getBatch)
+
 	cancelRoutes := router.Group("/cancel")
 	cancelRoutes.POST("/:id", server.cancelTask)
 
@@ -80,9 +112,104 @@ func (server *Server) checkLiveness(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"message": "API OK"})
 }
 
+// dependencyStatus is the result of checking a dependency in the readiness check.
+type dependencyStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// errNotConfigured is returned by the readiness checks of the optional dependencies which are not set,
+// e.g., redis in a docs-only setup. It doesn't make the agent unready.
+var errNotConfigured = errors.New("not configured")
+
+// checkReadiness checks the ML platform, redis, the webhook server and the task queue concurrently,
+// and returns 503 with the status of each dependency if any of them is unavailable.
 func (server *Server) checkReadiness(ctx *gin.Context) {
-	// TODO: Return False if the task queue is full
-	ctx.JSON(http.StatusOK, gin.H{"message": "API OK"})
+	timeout := time.Duration(server.config.HealthCheckTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	checkCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+	defer cancel()
+
+	checks := map[string]func(ctx context.Context) error{
+		"platform": func(ctx context.Context) error {
+			return platform.CheckHealth(ctx, server.platform)
+		},
+		"redis":   server.pingRedis,
+		"webhook": server.webhook.CheckHealth,
+		"queue": func(ctx context.Context) error {
+			return server.checkQueueSize()
+		},
+	}
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	dependencies := make(map[string]dependencyStatus, len(checks))
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+			status := dependencyStatus{Status: "ok"}
+			if err := check(checkCtx); errors.Is(err, errNotConfigured) {
+				status = dependencyStatus{Status: "not_configured"}
+			} else if err != nil {
+				log.Warn().Msgf("readiness check: %s is unavailable: %v", name, err)
+				status = dependencyStatus{Status: "unavailable", Error: err.Error()}
+			}
+			mutex.Lock()
+			dependencies[name] = status
+			mutex.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	ready := true
+	for _, status := range dependencies {
+		if status.Status == "unavailable" {
+			ready = false
+		}
+	}
+	states := platform.CircuitBreakerStates()
+	if platform.AllCircuitsOpen() {
+		ready = false
+		dependencies["platform"] = dependencyStatus{
+			Status: "unavailable", Error: "all ML platforms are unavailable"}
+	}
+	if !ready {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"message": "API not ready", "dependencies": dependencies, "circuit_breakers": states})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"message": "API OK", "dependencies": dependencies, "circuit_breakers": states})
+}
+
+// pingRedis checks the connection with redis shared by the task queue, the cache and the idempotency keys.
+func (server *Server) pingRedis(ctx context.Context) error {
+	if server.redis == nil {
+		return errNotConfigured
+	}
+	return server.redis.Ping(ctx).Err()
+}
+
+// checkQueueSize returns an error if the task queue is full.
+func (server *Server) checkQueueSize() error {
+	if server.distributor == nil {
+		return errNotConfigured
+	}
+	queueInfo, err := server.distributor.GetTaskQueueInfo(worker.QueueCritical)
+	if err != nil {
+		if strings.Contains(err.Error(), "NOT_FOUND") {
+			// The queue is created when the first task is submitted
+			return nil
+		}
+		return err
+	}
+	queueSize := queueInfo.Scheduled + queueInfo.Pending + queueInfo.Retry
+	if queueSize >= server.config.MaxQueueSize {
+		return fmt.Errorf("the task queue is full, size: %d", queueSize)
+	}
+	return nil
 }
 
 type TaskID struct {
@@ -92,41 +219,63 @@ type TaskID struct {
 func (server *Server) getTask(ctx *gin.Context) {
 	var taskID TaskID
 	if err := ctx.ShouldBindUri(&taskID); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		respondError(ctx, http.StatusBadRequest, err)
 		return
 	}
 	outputs, err := server.webhook.GetTaskInfo(taskID.ID)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondError(ctx, http.StatusInternalServerError, err)
 		return
 	}
-	ctx.JSON(http.StatusOK, outputs)
+	// The artifact URLs are signed on each read, so that they expire even if the response is leaked
+	ctx.JSON(http.StatusOK, server.artifacts.Resign(outputs))
 }
 
 func (server *Server) cancelTask(ctx *gin.Context) {
 	var taskID TaskID
 	if err := ctx.ShouldBindUri(&taskID); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		respondError(ctx, http.StatusBadRequest, err)
 		return
 	}
 	outputs, err := server.webhook.GetTaskInfoObject(taskID.ID)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondError(ctx, http.StatusInternalServerError, err)
 		return
 	}
 	if err := server.distributor.DeleteTask(worker.QueueCritical, outputs.QueueID); err != nil {
-		ctx.JSON(http.StatusForbidden, errorResponse(err))
-	} else {
-		info := platform.UpdateRequest{
-			ID:     outputs.ID,
-			Status: "canceled",
+		if outputs.Status != "running" {
+			respondError(ctx, http.StatusForbidden, err)
+			return
 		}
-		if err := server.webhook.UpdateTaskInfo(&info); err != nil {
-			ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		// The task is already running, cancel its context on the agent processing it, which aborts
+		// the backend request
+		cancelErr := server.distributor.CancelTask(outputs.QueueID)
+		if outputs.UpstreamID != "" {
+			// Cancel the upstream job directly as well in case the agent is gone
+			cancelRequest := platform.CancelRequest{ModelName: outputs.ModelName, UpstreamID: outputs.UpstreamID}
+			if e := server.platform.Cancel(&cancelRequest); e != nil {
+				if cancelErr != nil {
+					server.convertErrorCode(e, ctx)
+					return
+				}
+				log.Warn().Msgf("failed to cancel upstream job %s: %v", outputs.UpstreamID, e)
+			}
+		} else if cancelErr != nil {
+			e := platform.NewRequestError(platform.UnsupportedError,
+				fmt.Errorf("task %s is running and cannot be canceled: %v", outputs.ID, cancelErr))
+			server.convertErrorCode(e, ctx)
 			return
 		}
-		ctx.JSON(http.StatusOK, gin.H{"id": outputs.ID})
 	}
+	info := platform.UpdateRequest{
+		ID:     outputs.ID,
+		Status: "canceled",
+	}
+	if err := server.webhook.UpdateTaskInfo(&info); err != nil {
+		respondError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"id": outputs.ID})
 }
 
 func (server *Server) getQueueSize(ctx *gin.Context) {
@@ -137,7 +286,7 @@ func (server *Server) getQueueSize(ctx *gin.Context) {
 	} else if strings.Contains(err.Error(), "NOT_FOUND") {
 		queueSize = 0
 	} else {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondError(ctx, http.StatusInternalServerError, err)
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"queue_size": queueSize})
@@ -146,7 +295,7 @@ func (server *Server) getQueueSize(ctx *gin.Context) {
 func (server *Server) pauseQueue(ctx *gin.Context) {
 	err := server.distributor.PauseQueue(worker.QueueCritical)
 	if err != nil {
-		ctx.JSON(http.StatusForbidden, errorResponse(err))
+		respondError(ctx, http.StatusForbidden, err)
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"info": fmt.Sprintf("queue %s paused", worker.QueueCritical)})
@@ -155,7 +304,7 @@ func (server *Server) pauseQueue(ctx *gin.Context) {
 func (server *Server) unpauseQueue(ctx *gin.Context) {
 	err := server.distributor.UnpauseQueue(worker.QueueCritical)
 	if err != nil {
-		ctx.JSON(http.StatusForbidden, errorResponse(err))
+		respondError(ctx, http.StatusForbidden, err)
 		return
 	}
 	ctx.JSON(http.StatusOK, gin.H{"info": fmt.Sprintf("Unpaused queue %s paused", worker.QueueCritical)})
@@ -164,7 +313,7 @@ func (server *Server) unpauseQueue(ctx *gin.Context) {
 func (server *Server) deleteAllPendingTasks(ctx *gin.Context) {
 	pendingTaskIDs, err := server.webhook.GetTaskIDByModelStatus(server.config.ModelName, "pending")
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondError(ctx, http.StatusInternalServerError, err)
 		return
 	}
 	numPendingTasks := len(pendingTaskIDs)
@@ -189,17 +338,13 @@ func (server *Server) deleteAllPendingTasks(ctx *gin.Context) {
 func (server *Server) listUnfinishedTasks(ctx *gin.Context) {
 	unfinishedTasks, err := server.distributor.ListUnfinishedTasks(worker.QueueCritical)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondError(ctx, http.StatusInternalServerError, err)
 		return
 	} else {
 		ctx.JSON(http.StatusOK, gin.H{"num of unfinished tasks": len(unfinishedTasks)})
 	}
 }
 
-func errorResponse(err error) gin.H {
-	return gin.H{"error": err.Error()}
-}
-
 func (server *Server) CheckQueueSize() {
 	for {
 		var queueSize = 0
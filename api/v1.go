@@ -1,7 +1,9 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/HyperGAI/serving-agent/platform"
 	"github.com/HyperGAI/serving-agent/worker"
@@ -13,19 +15,27 @@ import (
 	"time"
 )
 
-func (server *Server) predict(ctx *gin.Context) {
+// predict returns the handler of the sync prediction API for the given API version.
+func (server *Server) predict(version string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		server.runPrediction(ctx, version)
+	}
+}
+
+func (server *Server) runPrediction(ctx *gin.Context, version string) {
 	var req platform.InferRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		respondError(ctx, http.StatusBadRequest, err)
+		return
+	}
+	if !server.validateInputs(ctx, &req) {
 		return
 	}
-	if server.config.MLPlatform == "kserve" ||
-		server.config.MLPlatform == "k8s" ||
-		server.config.MLPlatform == "k8s-plugin" {
-		// Append uploading webhook
-		uploadURL := fmt.Sprintf("http://%s/upload", server.config.UploadWebhookAddress)
-		req.Inputs["upload_webhook"] = uploadURL
+	call, ok := server.reserveIdempotencyKey(ctx, "predict-"+version, &req)
+	if !ok {
+		return
 	}
+	defer call.release()
 
 	// Add a prediction task record
 	userID := ctx.Request.Header.Get("UID")
@@ -33,22 +43,76 @@ func (server *Server) predict(ctx *gin.Context) {
 	_, err := server.webhook.CreateNewTask(id, userID, req.ModelName, "running", 0)
 	if err != nil {
 		log.Error().Msgf("failed to create new task info: %v", err)
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Run prediction, which is aborted if the client disconnects
+	_, e, err := server.runTask(ctx.Request.Context(), &req, id, version)
+	if e != nil {
+		server.convertErrorCode(e, ctx)
+		return
+	}
+	if err != nil {
+		respondError(ctx, http.StatusInternalServerError, err)
 		return
 	}
+
+	// Get results
+	outputs, err := server.webhook.GetTaskInfo(id)
+	if err != nil {
+		respondError(ctx, http.StatusInternalServerError, err)
+		return
+	}
+	call.complete(id, outputs)
+	ctx.JSON(http.StatusOK, server.artifacts.Resign(outputs))
+}
+
+// runTask runs the prediction of the task and records the result via the webhook. It returns
+// the recorded task info, a RequestError if the prediction failed, or an error if the result failed to be recorded.
+func (server *Server) runTask(
+	ctx context.Context,
+	req *platform.InferRequest,
+	id string,
+	version string,
+) (*platform.UpdateRequest, *platform.RequestError, error) {
 	info := platform.UpdateRequest{ID: id}
 
-	// Run prediction
-	response, e := server.platform.Predict(&req, "v1")
+	// Return the cached outputs of the same inputs if there are any
+	cacheKey, cacheable := server.cache.Key(req, version)
+	if cacheable {
+		if outputs, ok := server.cache.Get(ctx, req.ModelName, cacheKey); ok {
+			info.Status = "succeeded"
+			info.Outputs = outputs
+			info.CacheHit = true
+			if err := server.webhook.UpdateTaskInfo(&info); err != nil {
+				log.Error().Msgf("failed to update task info: %v", err)
+				return nil, nil, err
+			}
+			return &info, nil, nil
+		}
+	}
+
+	var upstreamID string
+	req.OnSubmitted = func(upstream string) {
+		upstreamID = upstream
+	}
+	response, e := server.platform.Predict(ctx, req, version)
 	if e != nil {
 		log.Error().Msgf("failed to run prediction: %v", e)
 		info.Status = "failed"
+		if (e.StatusCode == platform.TimeoutError || ctx.Err() != nil) && upstreamID != "" {
+			// Stop the upstream job so that it is no longer billed
+			cancelRequest := platform.CancelRequest{ModelName: req.ModelName, UpstreamID: upstreamID}
+			if err := server.platform.Cancel(&cancelRequest); err != nil {
+				log.Error().Msgf("failed to cancel upstream job %s: %v", upstreamID, err)
+			}
+		}
 		info.ErrorInfo = e.Error()
 		if err := server.webhook.UpdateTaskInfo(&info); err != nil {
 			log.Error().Msgf("failed to update task info: %v", err)
 		}
-		server.convertErrorCode(e, ctx)
-		return
+		return &info, e, nil
 	}
 
 	// Update task status
@@ -59,45 +123,38 @@ func (server *Server) predict(ctx *gin.Context) {
 		info.RunningTime = fmt.Sprintf("%v", runningTime)
 		delete(response.Outputs, "running_time")
 	}
+	if cacheable {
+		server.cache.Set(ctx, cacheKey, response.Outputs)
+	}
 	if err := server.webhook.UpdateTaskInfo(&info); err != nil {
 		log.Error().Msgf("failed to update task info: %v", err)
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
-		return
+		return nil, nil, err
 	}
-
-	// Get results
-	outputs, err := server.webhook.GetTaskInfo(id)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
-		return
-	}
-	ctx.JSON(http.StatusOK, outputs)
+	return &info, nil, nil
 }
 
 func (server *Server) asyncPredict(ctx *gin.Context) {
 	var req platform.InferRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		respondError(ctx, http.StatusBadRequest, err)
 		return
 	}
-	if server.config.MLPlatform == "kserve" ||
-		server.config.MLPlatform == "k8s" ||
-		server.config.MLPlatform == "k8s-plugin" {
-		// Append uploading webhook
-		uploadURL := fmt.Sprintf("http://%s/upload", server.config.UploadWebhookAddress)
-		req.Inputs["upload_webhook"] = uploadURL
+	if !server.validateInputs(ctx, &req) {
+		return
 	}
+	call, ok := server.reserveIdempotencyKey(ctx, "async", &req)
+	if !ok {
+		return
+	}
+	defer call.release()
 
 	id := uuid.New().String()
-	opts := []asynq.Option{
-		asynq.MaxRetry(1),
-		asynq.Queue(worker.QueueCritical),
-		asynq.Timeout(time.Duration(server.config.TaskTimeout) * time.Second),
-	}
+	opts := server.taskOptions()
 	payload := &worker.PayloadRunPrediction{
 		InferRequest: req,
 		ID:           id,
 		APIVersion:   "v1",
+		UniqueID:     call.uniqueID(),
 	}
 
 	// Get task queue info
@@ -108,9 +165,8 @@ func (server *Server) asyncPredict(ctx *gin.Context) {
 		log.Info().Msgf("task queue current size: %d", queueSize)
 		if queueSize >= server.config.MaxQueueSize {
 			log.Error().Msg("the task queue is full, cannot add more tasks")
-			ctx.JSON(http.StatusTooManyRequests,
-				errorResponse(fmt.Errorf(
-					"the prediction task queue is full, please wait for a while")))
+			respondError(ctx, http.StatusTooManyRequests, fmt.Errorf(
+				"the prediction task queue is full, please wait for a while"))
 			return
 		}
 	}
@@ -121,12 +177,12 @@ func (server *Server) asyncPredict(ctx *gin.Context) {
 	res, err := server.webhook.CreateNewTask(id, userID, req.ModelName, "", queueSize)
 	if err != nil {
 		log.Error().Msgf("failed to create new task info: %v", err)
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondError(ctx, http.StatusInternalServerError, err)
 		return
 	}
 	if err := json.Unmarshal([]byte(res), &output); err != nil {
 		log.Error().Msgf("failed to unmarshal output: %v", err)
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondError(ctx, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -137,10 +193,14 @@ func (server *Server) asyncPredict(ctx *gin.Context) {
 		info := platform.UpdateRequest{ID: payload.ID, Status: "failed", ErrorInfo: "task queue failed"}
 		if e := server.webhook.UpdateTaskInfo(&info); e != nil {
 			log.Error().Msgf("failed to update task info: %v", err)
-			ctx.JSON(http.StatusInternalServerError, errorResponse(e))
+			respondError(ctx, http.StatusInternalServerError, e)
+			return
+		}
+		if errors.Is(err, worker.ErrDuplicateTask) {
+			respondError(ctx, http.StatusConflict, err)
 			return
 		}
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondError(ctx, http.StatusInternalServerError, err)
 		return
 	} else {
 		info := platform.UpdateRequest{ID: payload.ID, QueueID: taskID}
@@ -149,27 +209,33 @@ func (server *Server) asyncPredict(ctx *gin.Context) {
 			if e := server.distributor.DeleteTask(worker.QueueCritical, taskID); e != nil {
 				log.Error().Msgf("failed to delete task from queue: %v", e)
 			}
-			ctx.JSON(http.StatusInternalServerError, errorResponse(e))
+			respondError(ctx, http.StatusInternalServerError, e)
 			return
 		}
 	}
+	call.complete(output["id"], nil)
 	// url := fmt.Sprintf("%s/task/%s", server.config.PublicURL, output["id"])
 	// ctx.JSON(http.StatusOK, gin.H{"url": url})
 	ctx.JSON(http.StatusOK, gin.H{"id": output["id"]})
 }
 
+// taskOptions returns the options of the prediction tasks.
+func (server *Server) taskOptions() []asynq.Option {
+	return []asynq.Option{
+		asynq.MaxRetry(1),
+		asynq.Queue(worker.QueueCritical),
+		asynq.Timeout(time.Duration(server.config.TaskTimeout) * time.Second),
+	}
+}
+
 func (server *Server) generate(ctx *gin.Context) {
 	var req platform.InferRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		respondError(ctx, http.StatusBadRequest, err)
 		return
 	}
-	if server.config.MLPlatform == "kserve" ||
-		server.config.MLPlatform == "k8s" ||
-		server.config.MLPlatform == "k8s-plugin" {
-		// Append uploading webhook
-		uploadURL := fmt.Sprintf("http://%s/upload", server.config.UploadWebhookAddress)
-		req.Inputs["upload_webhook"] = uploadURL
+	if !server.validateInputs(ctx, &req) {
+		return
 	}
 
 	// Add a prediction task record
@@ -178,7 +244,7 @@ func (server *Server) generate(ctx *gin.Context) {
 	_, err := server.webhook.CreateNewTask(id, userID, req.ModelName, "running", 0)
 	if err != nil {
 		log.Error().Msgf("failed to create new task info: %v", err)
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondError(ctx, http.StatusInternalServerError, err)
 		return
 	}
 	info := platform.UpdateRequest{ID: id}
@@ -216,7 +282,7 @@ func (server *Server) generate(ctx *gin.Context) {
 	info.RunningTime = fmt.Sprintf("%f", execution.Seconds())
 	if err := server.webhook.UpdateTaskInfo(&info); err != nil {
 		log.Error().Msgf("failed to update task info: %v", err)
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
+		respondError(ctx, http.StatusInternalServerError, err)
 		return
 	}
 }
@@ -224,7 +290,7 @@ func (server *Server) generate(ctx *gin.Context) {
 func (server *Server) docs(ctx *gin.Context) {
 	var req platform.DocsRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
+		respondError(ctx, http.StatusBadRequest, err)
 		return
 	}
 	response, err := server.platform.Docs(&req)
@@ -234,18 +300,3 @@ func (server *Server) docs(ctx *gin.Context) {
 	}
 	ctx.JSON(http.StatusOK, response)
 }
-
-func (server *Server) convertErrorCode(err *platform.RequestError, ctx *gin.Context) {
-	switch err.StatusCode {
-	case platform.MarshalError:
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
-	case platform.BuildRequestError:
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
-	case platform.SendRequestError:
-		ctx.JSON(http.StatusForbidden, errorResponse(err))
-	case platform.InvalidInputError:
-		ctx.JSON(http.StatusBadRequest, errorResponse(err))
-	default:
-		ctx.JSON(http.StatusInternalServerError, errorResponse(err))
-	}
-}
@@ -2,21 +2,30 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/HyperGAI/serving-agent/cache"
 	"github.com/HyperGAI/serving-agent/platform"
 	mockplatform "github.com/HyperGAI/serving-agent/platform/mock"
+	"github.com/HyperGAI/serving-agent/storage"
 	"github.com/HyperGAI/serving-agent/utils"
 	"github.com/HyperGAI/serving-agent/worker"
 	mockwk "github.com/HyperGAI/serving-agent/worker/mock"
 	"github.com/gin-gonic/gin"
 	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -43,7 +52,7 @@ func TestPredictV1(t *testing.T) {
 			},
 			buildStubs: func(x *mockplatform.MockPlatform, webhook *mockplatform.MockWebhook) {
 				x.EXPECT().
-					Predict(gomock.Any(), gomock.Any()).
+					Predict(gomock.Any(), gomock.Any(), gomock.Any()).
 					Times(1).
 					Return(&platform.InferResponse{}, nil)
 				webhook.EXPECT().
@@ -74,7 +83,7 @@ func TestPredictV1(t *testing.T) {
 			},
 			buildStubs: func(x *mockplatform.MockPlatform, webhook *mockplatform.MockWebhook) {
 				x.EXPECT().
-					Predict(gomock.Any(), gomock.Any()).
+					Predict(gomock.Any(), gomock.Any(), gomock.Any()).
 					Times(1).
 					Return(nil, platform.NewRequestError(20007, errors.New("invalid inputs")))
 				webhook.EXPECT().
@@ -90,7 +99,7 @@ func TestPredictV1(t *testing.T) {
 					Times(0)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
-				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
 			},
 		},
 		{
@@ -104,7 +113,7 @@ func TestPredictV1(t *testing.T) {
 			},
 			buildStubs: func(x *mockplatform.MockPlatform, webhook *mockplatform.MockWebhook) {
 				x.EXPECT().
-					Predict(gomock.Any(), gomock.Any()).
+					Predict(gomock.Any(), gomock.Any(), gomock.Any()).
 					Times(1).
 					Return(nil, platform.NewRequestError(20000, errors.New("internal error")))
 				webhook.EXPECT().
@@ -123,6 +132,30 @@ func TestPredictV1(t *testing.T) {
 				require.Equal(t, http.StatusInternalServerError, recorder.Code)
 			},
 		},
+		{
+			name: "Circuit open",
+			body: gin.H{
+				"model_name": "test_model",
+				"inputs":     map[string]interface{}{},
+			},
+			buildStubs: func(x *mockplatform.MockPlatform, webhook *mockplatform.MockWebhook) {
+				x.EXPECT().
+					Predict(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(nil, platform.NewRequestError(platform.CircuitOpenError, errors.New("circuit open")))
+				webhook.EXPECT().
+					CreateNewTask(gomock.Any(), gomock.Eq(userID), gomock.Eq("test_model"), gomock.Eq("running"), 0).
+					Times(1).
+					Return("", nil)
+				webhook.EXPECT().
+					UpdateTaskInfo(gomock.Any()).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+			},
+		},
 	}
 
 	for i := range testCases {
@@ -154,6 +187,170 @@ func TestPredictV1(t *testing.T) {
 	}
 }
 
+func TestPredictInputValidation(t *testing.T) {
+	userID := "12345"
+	schema := &platform.ModelSchema{
+		ModelName: "test_model",
+		Inputs: []platform.FieldSchema{
+			{Name: "prompt", Type: "string", Required: true},
+			{Name: "steps", Type: "integer", Default: 50.0},
+		},
+	}
+	testCases := []struct {
+		name          string
+		inputs        gin.H
+		buildStubs    func(x *mockplatform.MockPlatform, webhook *mockplatform.MockWebhook)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name:   "OK",
+			inputs: gin.H{"prompt": "a cat"},
+			buildStubs: func(x *mockplatform.MockPlatform, webhook *mockplatform.MockWebhook) {
+				x.EXPECT().Docs(gomock.Any()).Times(1).Return(schema, nil)
+				x.EXPECT().
+					Predict(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					DoAndReturn(func(_ interface{}, request *platform.InferRequest, _ string) (*platform.InferResponse, *platform.RequestError) {
+						require.Equal(t, 50.0, request.Inputs["steps"])
+						return &platform.InferResponse{}, nil
+					})
+				webhook.EXPECT().CreateNewTask(gomock.Any(), gomock.Eq(userID), gomock.Any(), gomock.Any(), 0).
+					Times(1).
+					Return("", nil)
+				webhook.EXPECT().UpdateTaskInfo(gomock.Any()).Times(1).Return(nil)
+				webhook.EXPECT().GetTaskInfo(gomock.Any()).Times(1).Return(nil, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name:   "Invalid inputs",
+			inputs: gin.H{"steps": "fifty"},
+			buildStubs: func(x *mockplatform.MockPlatform, webhook *mockplatform.MockWebhook) {
+				x.EXPECT().Docs(gomock.Any()).Times(1).Return(schema, nil)
+				x.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+				webhook.EXPECT().CreateNewTask(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+				var body struct {
+					Violations []platform.Violation `json:"violations"`
+				}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+				require.Equal(t, []platform.Violation{
+					{Field: "prompt", Message: "field is required"},
+					{Field: "steps", Message: "expected integer, got string"},
+				}, body.Violations)
+			},
+		},
+		{
+			name:   "Schema unavailable",
+			inputs: gin.H{"steps": "fifty"},
+			buildStubs: func(x *mockplatform.MockPlatform, webhook *mockplatform.MockWebhook) {
+				x.EXPECT().
+					Docs(gomock.Any()).
+					Times(1).
+					Return(nil, platform.NewRequestError(platform.UpstreamServerError, errors.New("bad gateway")))
+				x.EXPECT().
+					Predict(gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(&platform.InferResponse{}, nil)
+				webhook.EXPECT().CreateNewTask(gomock.Any(), gomock.Eq(userID), gomock.Any(), gomock.Any(), 0).
+					Times(1).
+					Return("", nil)
+				webhook.EXPECT().UpdateTaskInfo(gomock.Any()).Times(1).Return(nil)
+				webhook.EXPECT().GetTaskInfo(gomock.Any()).Times(1).Return(nil, nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			p := mockplatform.NewMockPlatform(ctrl)
+			distributor := mockwk.NewMockTaskDistributor(ctrl)
+			webhook := mockplatform.NewMockWebhook(ctrl)
+			tc.buildStubs(p, webhook)
+
+			config := utils.Config{
+				MaxQueueSize:      300,
+				ValidateInputs:    true,
+				SchemaCacheTTL:    60,
+				FillInputDefaults: true,
+			}
+			server, err := NewServer(config, p, distributor, webhook, nil, nil, nil)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(gin.H{"model_name": "test_model", "inputs": tc.inputs})
+			require.NoError(t, err)
+
+			request, err := http.NewRequest(
+				http.MethodPost, "/v1/predict", bytes.NewReader(data))
+			require.NoError(t, err)
+			request.Header.Set("UID", userID)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestSchemaCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	p := mockplatform.NewMockPlatform(ctrl)
+	schemas := newSchemaCache(time.Minute)
+	failure := platform.NewRequestError(platform.UpstreamServerError, errors.New("bad gateway"))
+
+	// The concurrent requests share one call, and the failure is cached
+	release := make(chan struct{})
+	p.EXPECT().Docs(gomock.Any()).Times(1).DoAndReturn(
+		func(_ *platform.DocsRequest) (*platform.ModelSchema, *platform.RequestError) {
+			<-release
+			return nil, failure
+		})
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, e := schemas.get(p, "test_model")
+			require.Equal(t, failure, e)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	_, e := schemas.get(p, "test_model")
+	require.Equal(t, failure, e)
+
+	// The failure expires earlier than the schemas
+	schemas.mutex.Lock()
+	entry := schemas.schemas["test_model"]
+	require.WithinDuration(t, time.Now().Add(schemaFailureTTL), entry.expiresAt, time.Second)
+	entry.expiresAt = time.Now()
+	schemas.schemas["test_model"] = entry
+	schemas.mutex.Unlock()
+
+	schema := &platform.ModelSchema{ModelName: "test_model"}
+	p.EXPECT().Docs(gomock.Any()).Times(1).Return(schema, nil)
+	for i := 0; i < 2; i++ {
+		result, e := schemas.get(p, "test_model")
+		require.Nil(t, e)
+		require.Equal(t, schema, result)
+	}
+}
 func TestAsyncPredictV1(t *testing.T) {
 	userID := "12345"
 	testCases := []struct {
@@ -571,6 +768,210 @@ func TestCancelTask(t *testing.T) {
 	}
 }
 
+func TestCancelRunningTask(t *testing.T) {
+	runningTask := &platform.TaskInfo{
+		ID:         "12345",
+		Status:     "running",
+		QueueID:    "12-23",
+		ModelName:  "test_model",
+		UpstreamID: "abc",
+	}
+	testCases := []struct {
+		name       string
+		buildStubs func(
+			p *mockplatform.MockPlatform,
+			distributor *mockwk.MockTaskDistributor,
+			webhook *mockplatform.MockWebhook,
+		)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(
+				p *mockplatform.MockPlatform,
+				distributor *mockwk.MockTaskDistributor,
+				webhook *mockplatform.MockWebhook,
+			) {
+				webhook.EXPECT().
+					GetTaskInfoObject(gomock.Eq("12345")).
+					Times(1).
+					Return(runningTask, nil)
+				distributor.EXPECT().
+					DeleteTask(gomock.Eq(worker.QueueCritical), gomock.Eq("12-23")).
+					Times(1).
+					Return(errors.New("task is active"))
+				distributor.EXPECT().
+					CancelTask(gomock.Eq("12-23")).
+					Times(1).
+					Return(nil)
+				p.EXPECT().
+					Cancel(gomock.Eq(&platform.CancelRequest{ModelName: "test_model", UpstreamID: "abc"})).
+					Times(1).
+					Return(nil)
+				webhook.EXPECT().
+					UpdateTaskInfo(gomock.Eq(&platform.UpdateRequest{ID: "12345", Status: "canceled"})).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Cancel failed",
+			buildStubs: func(
+				p *mockplatform.MockPlatform,
+				distributor *mockwk.MockTaskDistributor,
+				webhook *mockplatform.MockWebhook,
+			) {
+				webhook.EXPECT().
+					GetTaskInfoObject(gomock.Eq("12345")).
+					Times(1).
+					Return(runningTask, nil)
+				distributor.EXPECT().
+					DeleteTask(gomock.Eq(worker.QueueCritical), gomock.Eq("12-23")).
+					Times(1).
+					Return(errors.New("task is active"))
+				distributor.EXPECT().
+					CancelTask(gomock.Eq("12-23")).
+					Times(1).
+					Return(errors.New("redis is down"))
+				p.EXPECT().
+					Cancel(gomock.Any()).
+					Times(1).
+					Return(platform.NewRequestError(platform.InvalidInputError, errors.New("failed")))
+				webhook.EXPECT().
+					UpdateTaskInfo(gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name: "No upstream job",
+			buildStubs: func(
+				p *mockplatform.MockPlatform,
+				distributor *mockwk.MockTaskDistributor,
+				webhook *mockplatform.MockWebhook,
+			) {
+				webhook.EXPECT().
+					GetTaskInfoObject(gomock.Eq("12345")).
+					Times(1).
+					Return(&platform.TaskInfo{ID: "12345", Status: "running", QueueID: "12-23"}, nil)
+				distributor.EXPECT().
+					DeleteTask(gomock.Eq(worker.QueueCritical), gomock.Eq("12-23")).
+					Times(1).
+					Return(errors.New("task is active"))
+				distributor.EXPECT().
+					CancelTask(gomock.Eq("12-23")).
+					Times(1).
+					Return(nil)
+				// The backend request is aborted by the worker
+				p.EXPECT().
+					Cancel(gomock.Any()).
+					Times(0)
+				webhook.EXPECT().
+					UpdateTaskInfo(gomock.Eq(&platform.UpdateRequest{ID: "12345", Status: "canceled"})).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "Cancellation not supported",
+			buildStubs: func(
+				p *mockplatform.MockPlatform,
+				distributor *mockwk.MockTaskDistributor,
+				webhook *mockplatform.MockWebhook,
+			) {
+				webhook.EXPECT().
+					GetTaskInfoObject(gomock.Eq("12345")).
+					Times(1).
+					Return(&platform.TaskInfo{ID: "12345", Status: "running", QueueID: "12-23"}, nil)
+				distributor.EXPECT().
+					DeleteTask(gomock.Eq(worker.QueueCritical), gomock.Eq("12-23")).
+					Times(1).
+					Return(errors.New("task is active"))
+				distributor.EXPECT().
+					CancelTask(gomock.Eq("12-23")).
+					Times(1).
+					Return(errors.New("redis is down"))
+				p.EXPECT().
+					Cancel(gomock.Any()).
+					Times(0)
+				webhook.EXPECT().
+					UpdateTaskInfo(gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusConflict, recorder.Code)
+				var response ErrorResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				require.Equal(t, platform.ReasonUnsupported, response.Reason)
+			},
+		},
+		{
+			name: "Upstream cancel failed",
+			buildStubs: func(
+				p *mockplatform.MockPlatform,
+				distributor *mockwk.MockTaskDistributor,
+				webhook *mockplatform.MockWebhook,
+			) {
+				webhook.EXPECT().
+					GetTaskInfoObject(gomock.Eq("12345")).
+					Times(1).
+					Return(runningTask, nil)
+				distributor.EXPECT().
+					DeleteTask(gomock.Eq(worker.QueueCritical), gomock.Eq("12-23")).
+					Times(1).
+					Return(errors.New("task is active"))
+				distributor.EXPECT().
+					CancelTask(gomock.Eq("12-23")).
+					Times(1).
+					Return(nil)
+				// The worker cancels the upstream job once its context is canceled
+				p.EXPECT().
+					Cancel(gomock.Any()).
+					Times(1).
+					Return(platform.NewRequestError(platform.InvalidInputError, errors.New("failed")))
+				webhook.EXPECT().
+					UpdateTaskInfo(gomock.Eq(&platform.UpdateRequest{ID: "12345", Status: "canceled"})).
+					Times(1).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			p := mockplatform.NewMockPlatform(ctrl)
+			distributor := mockwk.NewMockTaskDistributor(ctrl)
+			webhook := mockplatform.NewMockWebhook(ctrl)
+			tc.buildStubs(p, distributor, webhook)
+
+			server := newTestServer(t, p, distributor, webhook)
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodPost, "/cancel/12345", nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
 func TestCheckArchivedTasks(t *testing.T) {
 	currentTime := time.Now()
 	payload := worker.PayloadRunPrediction{
@@ -968,51 +1369,183 @@ func TestGetQueueSize(t *testing.T) {
 	}
 }
 
-func TestDeleteAllPendingTasks(t *testing.T) {
+// unhealthyPlatform is a platform whose health check always fails.
+type unhealthyPlatform struct {
+	*mockplatform.MockPlatform
+}
+
+func (p unhealthyPlatform) CheckHealth(ctx context.Context) error {
+	return errors.New("model is not ready")
+}
+
+func TestCheckReadiness(t *testing.T) {
 	testCases := []struct {
 		name          string
+		unhealthy     bool
+		redisDown     bool
+		noQueue       bool
 		buildStubs    func(distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook)
 		checkResponse func(recorder *httptest.ResponseRecorder)
 	}{
 		{
 			name: "OK",
 			buildStubs: func(distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
-				webhook.EXPECT().
-					GetTaskIDByModelStatus(gomock.Any(), gomock.Eq("pending")).
-					Times(1).
-					Return([]string{"1", "2", "3"}, nil)
-				webhook.EXPECT().
-					GetTaskInfoObject(gomock.Any()).
-					Times(3).
-					Return(&platform.TaskInfo{
-						ID:          "123",
-						Status:      "pending",
-						RunningTime: "",
-						Outputs:     nil,
-						CreatedAt:   time.Time{},
-						ErrorInfo:   "",
-						QueueID:     "12345",
-					}, nil)
-				distributor.EXPECT().
-					DeleteTask(gomock.Any(), gomock.Eq("12345")).
-					Times(3).
-					Return(nil)
+				distributor.EXPECT().GetTaskQueueInfo(gomock.Eq(worker.QueueCritical)).Times(1).
+					Return(&asynq.QueueInfo{Pending: 1}, nil)
+				webhook.EXPECT().CheckHealth(gomock.Any()).Times(1).Return(nil)
 			},
 			checkResponse: func(recorder *httptest.ResponseRecorder) {
 				require.Equal(t, http.StatusOK, recorder.Code)
-				fmt.Println(recorder.Body)
+				// Redis is optional, e.g., a docs-only setup
+				dependencies := readDependencies(t, recorder)
+				require.Equal(t, "not_configured", dependencies["redis"].Status)
 			},
 		},
-	}
-
-	for i := range testCases {
-		tc := testCases[i]
-		t.Run(tc.name, func(t *testing.T) {
-			ctrl := gomock.NewController(t)
-			defer ctrl.Finish()
-
-			p := mockplatform.NewMockPlatform(ctrl)
-			distributor := mockwk.NewMockTaskDistributor(ctrl)
+		{
+			name:    "No task queue",
+			noQueue: true,
+			buildStubs: func(distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				webhook.EXPECT().CheckHealth(gomock.Any()).Times(1).Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				dependencies := readDependencies(t, recorder)
+				require.Equal(t, "not_configured", dependencies["queue"].Status)
+			},
+		},
+		{
+			name:      "Platform unhealthy",
+			unhealthy: true,
+			buildStubs: func(distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				distributor.EXPECT().GetTaskQueueInfo(gomock.Any()).Times(1).
+					Return(nil, errors.New("NOT_FOUND"))
+				webhook.EXPECT().CheckHealth(gomock.Any()).Times(1).Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+				dependencies := readDependencies(t, recorder)
+				require.Equal(t, "unavailable", dependencies["platform"].Status)
+				require.Equal(t, "model is not ready", dependencies["platform"].Error)
+				require.Equal(t, "ok", dependencies["queue"].Status)
+			},
+		},
+		{
+			name:      "Redis and webhook down",
+			redisDown: true,
+			buildStubs: func(distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				distributor.EXPECT().GetTaskQueueInfo(gomock.Any()).Times(1).
+					Return(nil, errors.New("connection refused"))
+				webhook.EXPECT().CheckHealth(gomock.Any()).Times(1).Return(errors.New("timeout"))
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+				dependencies := readDependencies(t, recorder)
+				require.Equal(t, "ok", dependencies["platform"].Status)
+				require.Equal(t, "unavailable", dependencies["redis"].Status)
+				require.Equal(t, "unavailable", dependencies["webhook"].Status)
+			},
+		},
+		{
+			name: "Queue full",
+			buildStubs: func(distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				distributor.EXPECT().GetTaskQueueInfo(gomock.Any()).Times(1).
+					Return(&asynq.QueueInfo{Pending: 200, Scheduled: 50, Retry: 50}, nil)
+				webhook.EXPECT().CheckHealth(gomock.Any()).Times(1).Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+				dependencies := readDependencies(t, recorder)
+				require.Equal(t, "unavailable", dependencies["queue"].Status)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var p platform.Platform = mockplatform.NewMockPlatform(ctrl)
+			if tc.unhealthy {
+				p = unhealthyPlatform{mockplatform.NewMockPlatform(ctrl)}
+			}
+			distributor := mockwk.NewMockTaskDistributor(ctrl)
+			webhook := mockplatform.NewMockWebhook(ctrl)
+			tc.buildStubs(distributor, webhook)
+
+			var taskDistributor worker.TaskDistributor = distributor
+			if tc.noQueue {
+				taskDistributor = nil
+			}
+			server := newTestServer(t, p, taskDistributor, webhook)
+			if tc.redisDown {
+				server.redis = redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+			}
+			recorder := httptest.NewRecorder()
+
+			request, err := http.NewRequest(http.MethodGet, "/ready", nil)
+			require.NoError(t, err)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func readDependencies(t *testing.T, recorder *httptest.ResponseRecorder) map[string]dependencyStatus {
+	var output struct {
+		Dependencies map[string]dependencyStatus `json:"dependencies"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &output))
+	return output.Dependencies
+}
+
+func TestDeleteAllPendingTasks(t *testing.T) {
+	testCases := []struct {
+		name          string
+		buildStubs    func(distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				webhook.EXPECT().
+					GetTaskIDByModelStatus(gomock.Any(), gomock.Eq("pending")).
+					Times(1).
+					Return([]string{"1", "2", "3"}, nil)
+				webhook.EXPECT().
+					GetTaskInfoObject(gomock.Any()).
+					Times(3).
+					Return(&platform.TaskInfo{
+						ID:          "123",
+						Status:      "pending",
+						RunningTime: "",
+						Outputs:     nil,
+						CreatedAt:   time.Time{},
+						ErrorInfo:   "",
+						QueueID:     "12345",
+					}, nil)
+				distributor.EXPECT().
+					DeleteTask(gomock.Any(), gomock.Eq("12345")).
+					Times(3).
+					Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				fmt.Println(recorder.Body)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			p := mockplatform.NewMockPlatform(ctrl)
+			distributor := mockwk.NewMockTaskDistributor(ctrl)
 			webhook := mockplatform.NewMockWebhook(ctrl)
 			tc.buildStubs(distributor, webhook)
 
@@ -1028,3 +1561,722 @@ func TestDeleteAllPendingTasks(t *testing.T) {
 		})
 	}
 }
+
+func TestBatchPredict(t *testing.T) {
+	userID := "12345"
+	body := gin.H{
+		"model_name": "test_model",
+		"inputs":     []gin.H{{"prompt": "a"}, {"prompt": "b"}, {"prompt": "c"}},
+	}
+	testCases := []struct {
+		name          string
+		url           string
+		body          gin.H
+		buildStubs    func(p *mockplatform.MockPlatform, distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook)
+		checkResponse func(recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Sync OK",
+			url:  "/v1/batch_predict",
+			body: body,
+			buildStubs: func(p *mockplatform.MockPlatform, distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				webhook.EXPECT().CreateNewTask(gomock.Any(), gomock.Eq(userID), gomock.Eq("test_model"), "running", 0).
+					Times(3).
+					Return("{}", nil)
+				webhook.EXPECT().CreateNewBatch(gomock.Any(), gomock.Eq(userID), gomock.Eq("test_model"), gomock.Len(3)).
+					Times(1).
+					Return(nil)
+				p.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(3).
+					DoAndReturn(func(_ context.Context, request *platform.InferRequest, _ string) (
+						*platform.InferResponse, *platform.RequestError) {
+						if request.Inputs["prompt"] == "b" {
+							return nil, &platform.RequestError{StatusCode: platform.UpstreamServerError}
+						}
+						return &platform.InferResponse{Outputs: map[string]interface{}{
+							"output": request.Inputs["prompt"], "running_time": "1s"}}, nil
+					})
+				webhook.EXPECT().UpdateTaskInfo(gomock.Any()).Times(3).Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var response batchResponse
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				require.Equal(t, "partially_succeeded", response.Status)
+				require.Equal(t, 3, response.Total)
+				require.Equal(t, 2, response.Succeeded)
+				require.Equal(t, 1, response.Failed)
+				require.Equal(t, 1.0, response.Progress)
+				require.Equal(t, map[string]interface{}{"output": "a"}, response.Results[0].Outputs)
+				require.Equal(t, "1s", response.Results[0].RunningTime)
+				require.Equal(t, "failed", response.Results[1].Status)
+				require.Equal(t, map[string]interface{}{"output": "c"}, response.Results[2].Outputs)
+			},
+		},
+		{
+			name: "Failed to create batch",
+			url:  "/v1/batch_predict",
+			body: body,
+			buildStubs: func(p *mockplatform.MockPlatform, distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				webhook.EXPECT().CreateNewTask(gomock.Any(), gomock.Eq(userID), gomock.Eq("test_model"), "running", 0).
+					Times(3).
+					Return("{}", nil)
+				webhook.EXPECT().CreateNewBatch(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(1).
+					Return(errors.New("webhook error"))
+				webhook.EXPECT().UpdateTaskInfo(gomock.Any()).Times(3).Return(nil)
+				p.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+			},
+		},
+		{
+			name: "Empty inputs",
+			url:  "/v1/batch_predict",
+			body: gin.H{"model_name": "test_model", "inputs": []gin.H{}},
+			buildStubs: func(p *mockplatform.MockPlatform, distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				webhook.EXPECT().CreateNewTask(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Batch too large",
+			url:  "/async/v1/batch_predict",
+			body: gin.H{"model_name": "test_model", "inputs": make([]gin.H, 11)},
+			buildStubs: func(p *mockplatform.MockPlatform, distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				distributor.EXPECT().GetTaskQueueInfo(gomock.Any()).Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Async OK",
+			url:  "/async/v1/batch_predict",
+			body: body,
+			buildStubs: func(p *mockplatform.MockPlatform, distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				distributor.EXPECT().GetTaskQueueInfo(gomock.Any()).Times(1).
+					Return(&asynq.QueueInfo{Pending: 5}, nil)
+				webhook.EXPECT().CreateNewTask(gomock.Any(), gomock.Eq(userID), gomock.Eq("test_model"), "", gomock.Any()).
+					Times(3).
+					Return("{}", nil)
+				webhook.EXPECT().CreateNewBatch(gomock.Any(), gomock.Eq(userID), gomock.Eq("test_model"), gomock.Len(3)).
+					Times(1).
+					Return(nil)
+				distributor.EXPECT().
+					DistributeTaskRunPrediction(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(3).
+					Return("123", nil)
+				webhook.EXPECT().UpdateTaskInfo(gomock.Any()).Times(3).Return(nil)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var response struct {
+					ID      string   `json:"id"`
+					TaskIDs []string `json:"task_ids"`
+				}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				require.NotEmpty(t, response.ID)
+				require.Len(t, response.TaskIDs, 3)
+			},
+		},
+		{
+			name: "Queue cannot hold the batch",
+			url:  "/async/v1/batch_predict",
+			body: body,
+			buildStubs: func(p *mockplatform.MockPlatform, distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				distributor.EXPECT().GetTaskQueueInfo(gomock.Any()).Times(1).
+					Return(&asynq.QueueInfo{Pending: 8}, nil)
+				webhook.EXPECT().CreateNewTask(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Times(0)
+			},
+			checkResponse: func(recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			p := mockplatform.NewMockPlatform(ctrl)
+			distributor := mockwk.NewMockTaskDistributor(ctrl)
+			webhook := mockplatform.NewMockWebhook(ctrl)
+			tc.buildStubs(p, distributor, webhook)
+
+			config := utils.Config{MaxQueueSize: 10, MaxBatchSize: 10}
+			server, err := NewServer(config, p, distributor, webhook, nil, nil, nil)
+			require.NoError(t, err)
+			recorder := httptest.NewRecorder()
+
+			data, err := json.Marshal(tc.body)
+			require.NoError(t, err)
+			request, err := http.NewRequest(http.MethodPost, tc.url, bytes.NewReader(data))
+			require.NoError(t, err)
+			request.Header.Set("UID", userID)
+
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(recorder)
+		})
+	}
+}
+
+func TestGetBatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	webhook := mockplatform.NewMockWebhook(ctrl)
+	webhook.EXPECT().GetBatchInfo(gomock.Eq("b1")).Times(1).Return(&platform.BatchInfo{
+		ID: "b1", ModelName: "test_model", TaskIDs: []string{"t1", "t2", "t3"},
+	}, nil)
+	tasks := map[string]*platform.TaskInfo{
+		"t1": {ID: "t1", Status: "succeeded", Outputs: map[string]interface{}{"output": "a"}},
+		"t2": {ID: "t2", Status: "running"},
+		"t3": {ID: "t3", Status: "failed", ErrorInfo: "upstream error"},
+	}
+	webhook.EXPECT().GetTaskInfoObject(gomock.Any()).Times(3).
+		DoAndReturn(func(id string) (*platform.TaskInfo, error) {
+			return tasks[id], nil
+		})
+
+	server := newTestServer(t, mockplatform.NewMockPlatform(ctrl), mockwk.NewMockTaskDistributor(ctrl), webhook)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodGet, "/batch/b1", nil)
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response batchResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, "running", response.Status)
+	require.Equal(t, 2, response.Finished)
+	require.InDelta(t, 2.0/3.0, response.Progress, 1e-9)
+	require.Equal(t, []string{"t1", "t2", "t3"},
+		[]string{response.Results[0].ID, response.Results[1].ID, response.Results[2].ID})
+	require.Equal(t, "upstream error", response.Results[2].ErrorInfo)
+}
+
+type memoryCacheStore struct {
+	values map[string][]byte
+}
+
+func (store *memoryCacheStore) Get(_ context.Context, key string) ([]byte, error) {
+	if value, ok := store.values[key]; ok {
+		return value, nil
+	}
+	return nil, cache.ErrMiss
+}
+
+func (store *memoryCacheStore) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	store.values[key] = value
+	return nil
+}
+
+func TestPredictCache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	p := mockplatform.NewMockPlatform(ctrl)
+	webhook := mockplatform.NewMockWebhook(ctrl)
+	// Only the first request is sent to the platform
+	p.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(1).
+		Return(&platform.InferResponse{Outputs: map[string]interface{}{
+			"output": "a.png", "running_time": "1.0s"}}, nil)
+	webhook.EXPECT().CreateNewTask(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Times(2).Return("", nil)
+	var updates []platform.UpdateRequest
+	webhook.EXPECT().UpdateTaskInfo(gomock.Any()).Times(2).
+		DoAndReturn(func(info *platform.UpdateRequest) error {
+			updates = append(updates, *info)
+			return nil
+		})
+	webhook.EXPECT().GetTaskInfo(gomock.Any()).Times(2).Return(nil, nil)
+
+	responseCache, err := cache.NewResponseCacheWithStore(
+		&memoryCacheStore{values: make(map[string][]byte)}, time.Hour, &cache.Config{})
+	require.NoError(t, err)
+	server, err := NewServer(utils.Config{MaxQueueSize: 300}, p, mockwk.NewMockTaskDistributor(ctrl),
+		webhook, responseCache, nil, nil)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		data, err := json.Marshal(gin.H{"model_name": "sdxl", "inputs": gin.H{"prompt": "a cat", "seed": 42}})
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, "/v1/predict", bytes.NewReader(data))
+		require.NoError(t, err)
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusOK, recorder.Code)
+	}
+	require.False(t, updates[0].CacheHit)
+	require.Equal(t, "1.0s", updates[0].RunningTime)
+	require.True(t, updates[1].CacheHit)
+	require.Equal(t, "succeeded", updates[1].Status)
+	require.Equal(t, map[string]interface{}{"output": "a.png"}, updates[1].Outputs)
+}
+
+type memoryIdempotencyStore struct {
+	records map[string]*idempotencyRecord
+}
+
+func (store *memoryIdempotencyStore) reserve(
+	_ context.Context,
+	key string,
+	record *idempotencyRecord,
+	_ time.Duration,
+) (*idempotencyRecord, error) {
+	if existing, ok := store.records[key]; ok {
+		return existing, nil
+	}
+	store.records[key] = record
+	return nil, nil
+}
+
+func (store *memoryIdempotencyStore) save(
+	_ context.Context,
+	key string,
+	record *idempotencyRecord,
+	_ time.Duration,
+) error {
+	store.records[key] = record
+	return nil
+}
+
+func (store *memoryIdempotencyStore) remove(_ context.Context, key string) error {
+	delete(store.records, key)
+	return nil
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	userID := "12345"
+	body := gin.H{"model_name": "test_model", "inputs": gin.H{"prompt": "a cat"}}
+	send := func(server *Server, url string, body gin.H, key string) *httptest.ResponseRecorder {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+		require.NoError(t, err)
+		request.Header.Set("UID", userID)
+		request.Header.Set(IdempotencyKeyHeader, key)
+		recorder := httptest.NewRecorder()
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	testCases := []struct {
+		name  string
+		check func(server *Server, p *mockplatform.MockPlatform,
+			distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook)
+	}{
+		{
+			name: "Async replay",
+			check: func(server *Server, p *mockplatform.MockPlatform,
+				distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				distributor.EXPECT().GetTaskQueueInfo(gomock.Any()).Times(1).Return(&asynq.QueueInfo{}, nil)
+				webhook.EXPECT().CreateNewTask(gomock.Any(), gomock.Eq(userID), gomock.Any(), "", 0).
+					Times(1).Return(`{"id": "task-1"}`, nil)
+				distributor.EXPECT().DistributeTaskRunPrediction(gomock.Any(), gomock.Any(), gomock.Any(),
+					gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(_ context.Context, payload *worker.PayloadRunPrediction, _ ...asynq.Option) (
+						string, error) {
+						require.NotEmpty(t, payload.UniqueID)
+						return payload.UniqueID, nil
+					})
+				webhook.EXPECT().UpdateTaskInfo(gomock.Any()).Times(1).Return(nil)
+
+				for i := 0; i < 2; i++ {
+					recorder := send(server, "/async/v1/predict", body, "key-1")
+					require.Equal(t, http.StatusOK, recorder.Code)
+					require.JSONEq(t, `{"id": "task-1"}`, recorder.Body.String())
+					require.Equal(t, i == 1, recorder.Header().Get(IdempotentReplayedHeader) == "true")
+				}
+				// The same key with a different body
+				recorder := send(server, "/async/v1/predict",
+					gin.H{"model_name": "test_model", "inputs": gin.H{"prompt": "a dog"}}, "key-1")
+				require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+			},
+		},
+		{
+			name: "Sync replay",
+			check: func(server *Server, p *mockplatform.MockPlatform,
+				distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				webhook.EXPECT().CreateNewTask(gomock.Any(), gomock.Eq(userID), gomock.Any(), "running", 0).
+					Times(1).Return("", nil)
+				p.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(1).
+					Return(&platform.InferResponse{Outputs: map[string]interface{}{"output": "a.png"}}, nil)
+				webhook.EXPECT().UpdateTaskInfo(gomock.Any()).Times(1).Return(nil)
+				webhook.EXPECT().GetTaskInfo(gomock.Any()).Times(1).
+					Return(map[string]interface{}{"status": "succeeded", "outputs": "a.png"}, nil)
+
+				for i := 0; i < 2; i++ {
+					recorder := send(server, "/v1/predict", body, "key-1")
+					require.Equal(t, http.StatusOK, recorder.Code)
+					require.JSONEq(t, `{"status": "succeeded", "outputs": "a.png"}`, recorder.Body.String())
+				}
+			},
+		},
+		{
+			name: "Released after failure",
+			check: func(server *Server, p *mockplatform.MockPlatform,
+				distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				distributor.EXPECT().GetTaskQueueInfo(gomock.Any()).Times(2).Return(&asynq.QueueInfo{}, nil)
+				gomock.InOrder(
+					webhook.EXPECT().CreateNewTask(gomock.Any(), gomock.Eq(userID), gomock.Any(), "", 0).
+						Times(1).Return("", errors.New("webhook error")),
+					webhook.EXPECT().CreateNewTask(gomock.Any(), gomock.Eq(userID), gomock.Any(), "", 0).
+						Times(1).Return(`{"id": "task-1"}`, nil),
+				)
+				distributor.EXPECT().DistributeTaskRunPrediction(gomock.Any(), gomock.Any(), gomock.Any(),
+					gomock.Any(), gomock.Any()).Times(1).Return("123", nil)
+				webhook.EXPECT().UpdateTaskInfo(gomock.Any()).Times(1).Return(nil)
+
+				recorder := send(server, "/async/v1/predict", body, "key-1")
+				require.Equal(t, http.StatusInternalServerError, recorder.Code)
+				recorder = send(server, "/async/v1/predict", body, "key-1")
+				require.Equal(t, http.StatusOK, recorder.Code)
+			},
+		},
+		{
+			name: "In progress",
+			check: func(server *Server, p *mockplatform.MockPlatform,
+				distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				data, err := json.Marshal(&platform.InferRequest{
+					ModelName: "test_model", Inputs: map[string]interface{}{"prompt": "a cat"}})
+				require.NoError(t, err)
+				hash := sha256.Sum256(data)
+				server.idempotency.(*memoryIdempotencyStore).records["idempotency:async:12345:key-1"] =
+					&idempotencyRecord{Hash: hex.EncodeToString(hash[:])}
+
+				recorder := send(server, "/async/v1/predict", body, "key-1")
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+		{
+			name: "Duplicate task in the queue",
+			check: func(server *Server, p *mockplatform.MockPlatform,
+				distributor *mockwk.MockTaskDistributor, webhook *mockplatform.MockWebhook) {
+				distributor.EXPECT().GetTaskQueueInfo(gomock.Any()).Times(1).Return(&asynq.QueueInfo{}, nil)
+				webhook.EXPECT().CreateNewTask(gomock.Any(), gomock.Eq(userID), gomock.Any(), "", 0).
+					Times(1).Return(`{"id": "task-1"}`, nil)
+				distributor.EXPECT().DistributeTaskRunPrediction(gomock.Any(), gomock.Any(), gomock.Any(),
+					gomock.Any(), gomock.Any()).Times(1).Return("", worker.ErrDuplicateTask)
+				webhook.EXPECT().UpdateTaskInfo(gomock.Any()).Times(1).Return(nil)
+
+				recorder := send(server, "/async/v1/predict", body, "key-1")
+				require.Equal(t, http.StatusConflict, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			p := mockplatform.NewMockPlatform(ctrl)
+			distributor := mockwk.NewMockTaskDistributor(ctrl)
+			webhook := mockplatform.NewMockWebhook(ctrl)
+			server := newTestServer(t, p, distributor, webhook)
+			server.idempotency = &memoryIdempotencyStore{records: make(map[string]*idempotencyRecord)}
+			tc.check(server, p, distributor, webhook)
+		})
+	}
+}
+
+func TestUploadArtifact(t *testing.T) {
+	image := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	multipartBody := func() (*bytes.Buffer, string) {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("file", "image.png")
+		require.NoError(t, err)
+		_, err = part.Write(image)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		return body, writer.FormDataContentType()
+	}
+
+	testCases := []struct {
+		name          string
+		body          func() (*bytes.Buffer, string)
+		checkResponse func(server *Server, recorder *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Multipart",
+			body: multipartBody,
+			checkResponse: func(server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				var response struct {
+					URL string `json:"url"`
+				}
+				require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+				require.True(t, strings.HasPrefix(response.URL, "http://agent/files/artifacts/"))
+				require.True(t, strings.HasSuffix(response.URL, ".png"))
+
+				fileRecorder := httptest.NewRecorder()
+				request, err := http.NewRequest(http.MethodGet, strings.TrimPrefix(response.URL, "http://agent"), nil)
+				require.NoError(t, err)
+				server.router.ServeHTTP(fileRecorder, request)
+				require.Equal(t, http.StatusOK, fileRecorder.Code)
+				require.Equal(t, "image/png", fileRecorder.Header().Get("Content-Type"))
+				require.Equal(t, image, fileRecorder.Body.Bytes())
+			},
+		},
+		{
+			name: "Raw body",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBuffer(image), "application/octet-stream"
+			},
+			checkResponse: func(server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, recorder.Code)
+				require.Contains(t, recorder.Body.String(), ".png")
+			},
+		},
+		{
+			name: "Empty",
+			body: func() (*bytes.Buffer, string) {
+				return &bytes.Buffer{}, "application/octet-stream"
+			},
+			checkResponse: func(server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusBadRequest, recorder.Code)
+			},
+		},
+		{
+			name: "Too large",
+			body: func() (*bytes.Buffer, string) {
+				return bytes.NewBuffer(make([]byte, 2048)), "application/octet-stream"
+			},
+			checkResponse: func(server *Server, recorder *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			config := utils.Config{MaxQueueSize: 300, ArtifactBaseURL: "http://agent", MaxArtifactSize: 1024}
+			store, err := storage.NewLocalStore(t.TempDir())
+			require.NoError(t, err)
+			artifacts, err := storage.NewArtifacts(config, store)
+			require.NoError(t, err)
+			server, err := NewServer(config, mockplatform.NewMockPlatform(ctrl), mockwk.NewMockTaskDistributor(ctrl),
+				mockplatform.NewMockWebhook(ctrl), nil, artifacts, nil)
+			require.NoError(t, err)
+
+			body, contentType := tc.body()
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodPost, "/upload", body)
+			require.NoError(t, err)
+			request.Header.Set("Content-Type", contentType)
+			server.router.ServeHTTP(recorder, request)
+			tc.checkResponse(server, recorder)
+		})
+	}
+}
+
+func TestGetFile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	config := utils.Config{MaxQueueSize: 300, ArtifactBaseURL: "http://agent"}
+	store, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	artifacts, err := storage.NewArtifacts(config, store)
+	require.NoError(t, err)
+	require.NoError(t, store.Put(context.Background(), "payloads/a.json", []byte("{}")))
+	server, err := NewServer(config, mockplatform.NewMockPlatform(ctrl), mockwk.NewMockTaskDistributor(ctrl),
+		mockplatform.NewMockWebhook(ctrl), nil, artifacts, nil)
+	require.NoError(t, err)
+
+	for _, url := range []string{"/files/artifacts/missing.png", "/files/payloads/a.json"} {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		server.router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusNotFound, recorder.Code, url)
+	}
+}
+
+func TestSignedArtifacts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	config := utils.Config{
+		MaxQueueSize:        300,
+		ArtifactBaseURL:     "http://agent",
+		ArtifactSigningKeys: "k2:secret2,k1:secret1",
+		ArtifactURLTTL:      60,
+	}
+	store, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	artifacts, err := storage.NewArtifacts(config, store)
+	require.NoError(t, err)
+	webhook := mockplatform.NewMockWebhook(ctrl)
+	server, err := NewServer(config, mockplatform.NewMockPlatform(ctrl), mockwk.NewMockTaskDistributor(ctrl),
+		webhook, nil, artifacts, nil)
+	require.NoError(t, err)
+	get := func(url string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		server.router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	image := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/upload", bytes.NewReader(image))
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response struct {
+		URL string `json:"url"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	link := strings.TrimPrefix(response.URL, "http://agent")
+	require.True(t, strings.HasPrefix(link, "/artifacts/"))
+	path, _, _ := strings.Cut(link, "?")
+
+	recorder = get(link)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, image, recorder.Body.Bytes())
+	require.Equal(t, "private, no-store", recorder.Header().Get("Cache-Control"))
+
+	// The tampered, unsigned and permanent URLs are rejected
+	require.Equal(t, http.StatusForbidden, get(strings.Replace(link, "signature=", "signature=x", 1)).Code)
+	require.Equal(t, http.StatusForbidden, get(path).Code)
+	require.Equal(t, http.StatusForbidden, get("/files"+path).Code)
+
+	// The expired URL in the task outputs is signed again on each read
+	expired := "http://agent" + path + "?expires=1&key_id=k1&signature=x"
+	webhook.EXPECT().GetTaskInfo(gomock.Eq("task-1")).Times(1).Return(map[string]interface{}{
+		"id": "task-1", "status": "succeeded", "outputs": map[string]interface{}{"image": expired},
+	}, nil)
+	recorder = get("/task/task-1")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var task platform.TaskInfo
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &task))
+	resigned := task.Outputs.(map[string]interface{})["image"].(string)
+	require.NotEqual(t, expired, resigned)
+	require.True(t, strings.Contains(resigned, "key_id=k2"))
+	require.Equal(t, http.StatusOK, get(strings.TrimPrefix(resigned, "http://agent")).Code)
+}
+
+func TestErrorResponse(t *testing.T) {
+	rateLimited := platform.NewUpstreamError(&http.Response{
+		StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": {"2"}},
+	}, errors.New("throttled"))
+	circuitOpen := platform.NewRequestError(platform.CircuitOpenError, errors.New("circuit breaker is open"))
+	circuitOpen.RetryAfter = 1500 * time.Millisecond
+
+	testCases := []struct {
+		name       string
+		err        *platform.RequestError
+		statusCode int
+		retryAfter string
+		expected   ErrorResponse
+	}{
+		{
+			name:       "Invalid input",
+			err:        platform.NewRequestError(platform.InvalidInputError, errors.New("invalid")),
+			statusCode: http.StatusUnprocessableEntity,
+			expected:   ErrorResponse{Reason: platform.ReasonInvalidInput},
+		},
+		{
+			name:       "Rate limited",
+			err:        rateLimited,
+			statusCode: http.StatusTooManyRequests,
+			retryAfter: "2",
+			expected: ErrorResponse{
+				Reason: platform.ReasonRateLimited, Retryable: true, UpstreamStatus: http.StatusTooManyRequests,
+			},
+		},
+		{
+			name:       "Circuit open",
+			err:        circuitOpen,
+			statusCode: http.StatusServiceUnavailable,
+			retryAfter: "2",
+			expected:   ErrorResponse{Reason: platform.ReasonCircuitOpen, Retryable: true},
+		},
+		{
+			name: "Upstream auth",
+			err: platform.NewUpstreamError(&http.Response{StatusCode: http.StatusUnauthorized, Header: http.Header{}},
+				errors.New("invalid token")),
+			statusCode: http.StatusBadGateway,
+			expected:   ErrorResponse{Reason: platform.ReasonUpstreamAuth, UpstreamStatus: http.StatusUnauthorized},
+		},
+		{
+			name:       "Send request failed",
+			err:        platform.NewRequestError(platform.SendRequestError, errors.New("connection refused")),
+			statusCode: http.StatusBadGateway,
+			expected:   ErrorResponse{Reason: platform.ReasonConnectionFailed, Retryable: true},
+		},
+		{
+			name:       "Timeout",
+			err:        platform.NewRequestError(platform.TimeoutError, errors.New("timeout")),
+			statusCode: http.StatusGatewayTimeout,
+			expected:   ErrorResponse{Reason: platform.ReasonTimeout, Retryable: true},
+		},
+		{
+			name:       "Internal",
+			err:        platform.NewRequestError(platform.InternalError, errors.New("failed")),
+			statusCode: http.StatusInternalServerError,
+			expected:   ErrorResponse{Reason: platform.ReasonInternal},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			p := mockplatform.NewMockPlatform(ctrl)
+			p.EXPECT().Docs(gomock.Any()).Times(1).Return(nil, tc.err)
+			server := newTestServer(t, p, mockwk.NewMockTaskDistributor(ctrl), mockplatform.NewMockWebhook(ctrl))
+
+			recorder := httptest.NewRecorder()
+			request, err := http.NewRequest(http.MethodGet, "/v1/docs",
+				bytes.NewReader([]byte(`{"model_name": "test_model"}`)))
+			require.NoError(t, err)
+			server.router.ServeHTTP(recorder, request)
+
+			require.Equal(t, tc.statusCode, recorder.Code)
+			require.Equal(t, tc.retryAfter, recorder.Header().Get("Retry-After"))
+			var response ErrorResponse
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			tc.expected.Error = tc.err.Error()
+			require.Equal(t, tc.expected, response)
+		})
+	}
+
+	// The errors raised by the agent use the same envelope
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	server := newTestServer(t, mockplatform.NewMockPlatform(ctrl), mockwk.NewMockTaskDistributor(ctrl),
+		mockplatform.NewMockWebhook(ctrl))
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest(http.MethodPost, "/v1/predict", bytes.NewReader([]byte("{")))
+	require.NoError(t, err)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	var response ErrorResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, "bad_request", response.Reason)
+	require.False(t, response.Retryable)
+	require.NotEmpty(t, response.Error)
+}
@@ -0,0 +1,227 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+var cacheRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "response_cache_requests_total",
+		Help: "Number of the response cache lookups by model and result, i.e., hit or miss",
+	},
+	[]string{"model", "result"},
+)
+
+// ErrMiss is returned by `Store.Get` if the key doesn't exist.
+var ErrMiss = errors.New("cache miss")
+
+// Store keeps the cached outputs with a TTL, i.e., redis.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+type redisStore struct {
+	client redis.UniversalClient
+}
+
+func (store *redisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := store.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrMiss
+	}
+	return value, err
+}
+
+func (store *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return store.client.Set(ctx, key, value, ttl).Err()
+}
+
+// Rule configures the caching of the models matching `Model`, which is a model name or a glob pattern.
+// `Disabled` opts the models out of the cache. The requests missing any of `RequiredInputs` are
+// non-deterministic and not cached, e.g., without a fixed `seed`. `IgnoredInputs` are excluded from
+// the cache key, e.g., the fields which don't change the outputs.
+type Rule struct {
+	Model          string   `json:"model"`
+	Disabled       bool     `json:"disabled"`
+	RequiredInputs []string `json:"required_inputs"`
+	IgnoredInputs  []string `json:"ignored_inputs"`
+}
+
+// Config is loaded from the JSON file specified by `CACHE_CONFIG_PATH`, e.g.,
+//
+//	{
+//	  "rules": [
+//	    {"model": "sdxl", "required_inputs": ["seed"]},
+//	    {"model": "llama-*", "disabled": true}
+//	  ]
+//	}
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// The inputs added by the agent, which are never part of the cache key
+var agentInputs = []string{"upload_webhook"}
+
+// ResponseCache caches the outputs of the predictions keyed by the model name and the hash of
+// the canonicalized inputs. The models without a rule are cached. The methods of a nil cache
+// are no-ops, so that the callers don't need to check if caching is enabled.
+type ResponseCache struct {
+	store    Store
+	ttl      time.Duration
+	exact    map[string]*Rule
+	patterns []*Rule
+}
+
+func LoadConfig(filepath string) (*Config, error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache config: %w", err)
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse cache config: %w", err)
+	}
+	return &config, nil
+}
+
+// NewResponseCache creates the cache stored in redis if `CACHE_ENABLED` is set, otherwise it returns nil.
+func NewResponseCache(config utils.Config, client redis.UniversalClient) (*ResponseCache, error) {
+	if !config.CacheEnabled {
+		return nil, nil
+	}
+	if client == nil {
+		return nil, errors.New("REDIS_ADDRESS is required by the response cache")
+	}
+	cacheConfig := &Config{}
+	if config.CacheConfigPath != "" {
+		var err error
+		if cacheConfig, err = LoadConfig(config.CacheConfigPath); err != nil {
+			return nil, err
+		}
+	}
+	ttl := time.Duration(config.CacheTTL) * time.Second
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	log.Info().Msgf("response cache is enabled, ttl: %v", ttl)
+	return NewResponseCacheWithStore(&redisStore{client: client}, ttl, cacheConfig)
+}
+
+func NewResponseCacheWithStore(store Store, ttl time.Duration, config *Config) (*ResponseCache, error) {
+	cache := ResponseCache{store: store, ttl: ttl, exact: make(map[string]*Rule)}
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if rule.Model == "" {
+			return nil, errors.New("`model` must be set in a cache rule")
+		}
+		if _, err := path.Match(rule.Model, ""); err != nil {
+			return nil, fmt.Errorf("invalid model pattern %s: %w", rule.Model, err)
+		}
+		if strings.ContainsAny(rule.Model, "*?[\\") {
+			cache.patterns = append(cache.patterns, rule)
+		} else {
+			cache.exact[rule.Model] = rule
+		}
+	}
+	return &cache, nil
+}
+
+func (cache *ResponseCache) rule(modelName string) *Rule {
+	if rule, ok := cache.exact[modelName]; ok {
+		return rule
+	}
+	for _, rule := range cache.patterns {
+		if matched, _ := path.Match(rule.Model, modelName); matched {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Key returns the cache key of the request, or false if the request is not cacheable.
+func (cache *ResponseCache) Key(request *platform.InferRequest, version string) (string, bool) {
+	if cache == nil {
+		return "", false
+	}
+	inputs := make(map[string]interface{}, len(request.Inputs))
+	for key, value := range request.Inputs {
+		inputs[key] = value
+	}
+	for _, key := range agentInputs {
+		delete(inputs, key)
+	}
+	if rule := cache.rule(request.ModelName); rule != nil {
+		if rule.Disabled {
+			return "", false
+		}
+		for _, key := range rule.RequiredInputs {
+			if value, ok := inputs[key]; !ok || value == nil {
+				return "", false
+			}
+		}
+		for _, key := range rule.IgnoredInputs {
+			delete(inputs, key)
+		}
+	}
+	// The map keys are sorted by `json.Marshal`, so that the same inputs always have the same hash
+	data, err := json.Marshal(inputs)
+	if err != nil {
+		return "", false
+	}
+	hash := sha256.Sum256(data)
+	return fmt.Sprintf("cache:%s:%s:%s", version, request.ModelName, hex.EncodeToString(hash[:])), true
+}
+
+// Get returns the cached outputs. The errors of the store are treated as misses.
+func (cache *ResponseCache) Get(ctx context.Context, modelName string, key string) (map[string]interface{}, bool) {
+	if cache == nil {
+		return nil, false
+	}
+	data, err := cache.store.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, ErrMiss) {
+			log.Warn().Msgf("failed to get cached outputs: %v", err)
+		}
+		cacheRequests.WithLabelValues(modelName, "miss").Inc()
+		return nil, false
+	}
+	var outputs map[string]interface{}
+	if err := json.Unmarshal(data, &outputs); err != nil {
+		log.Warn().Msgf("failed to unmarshal cached outputs: %v", err)
+		cacheRequests.WithLabelValues(modelName, "miss").Inc()
+		return nil, false
+	}
+	cacheRequests.WithLabelValues(modelName, "hit").Inc()
+	return outputs, true
+}
+
+// Set caches the outputs. The errors are only logged, since caching is best-effort.
+func (cache *ResponseCache) Set(ctx context.Context, key string, outputs map[string]interface{}) {
+	if cache == nil {
+		return
+	}
+	data, err := json.Marshal(outputs)
+	if err != nil {
+		log.Warn().Msgf("failed to marshal outputs: %v", err)
+		return
+	}
+	if err := cache.store.Set(ctx, key, data, cache.ttl); err != nil {
+		log.Warn().Msgf("failed to cache outputs: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package cache_test
+
+import (
+	"context"
+	"github.com/HyperGAI/serving-agent/cache"
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	mutex  sync.Mutex
+	values map[string][]byte
+}
+
+func (store *memoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	value, ok := store.values[key]
+	if !ok {
+		return nil, cache.ErrMiss
+	}
+	return value, nil
+}
+
+func (store *memoryStore) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.values[key] = value
+	return nil
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	responseCache, err := cache.NewResponseCacheWithStore(&memoryStore{}, time.Hour, &cache.Config{
+		Rules: []cache.Rule{
+			{Model: "sdxl", RequiredInputs: []string{"seed"}, IgnoredInputs: []string{"request_id"}},
+			{Model: "llama-*", Disabled: true},
+		},
+	})
+	require.NoError(t, err)
+	key := func(modelName string, inputs map[string]interface{}) (string, bool) {
+		return responseCache.Key(&platform.InferRequest{ModelName: modelName, Inputs: inputs}, "v1")
+	}
+
+	sdxl, ok := key("sdxl", map[string]interface{}{
+		"prompt": "a cat", "seed": 42.0, "size": map[string]interface{}{"w": 512.0, "h": 512.0}})
+	require.True(t, ok)
+	same, ok := key("sdxl", map[string]interface{}{
+		"size": map[string]interface{}{"h": 512.0, "w": 512.0}, "seed": 42.0, "prompt": "a cat",
+		"upload_webhook": "http://localhost/upload", "request_id": "123"})
+	require.True(t, ok)
+	require.Equal(t, sdxl, same)
+
+	other, ok := key("sdxl", map[string]interface{}{
+		"prompt": "a cat", "seed": 43.0, "size": map[string]interface{}{"w": 512.0, "h": 512.0}})
+	require.True(t, ok)
+	require.NotEqual(t, sdxl, other)
+	v2, ok := responseCache.Key(&platform.InferRequest{ModelName: "sdxl", Inputs: map[string]interface{}{
+		"prompt": "a cat", "seed": 42.0, "size": map[string]interface{}{"w": 512.0, "h": 512.0}}}, "v2")
+	require.True(t, ok)
+	require.NotEqual(t, sdxl, v2)
+
+	// Without a fixed seed
+	_, ok = key("sdxl", map[string]interface{}{"prompt": "a cat"})
+	require.False(t, ok)
+	_, ok = key("sdxl", map[string]interface{}{"prompt": "a cat", "seed": nil})
+	require.False(t, ok)
+	// Opted out
+	_, ok = key("llama-2-7b", map[string]interface{}{"prompt": "Hi"})
+	require.False(t, ok)
+	// No rule
+	_, ok = key("resnet", map[string]interface{}{"image": "a.png"})
+	require.True(t, ok)
+}
+
+func TestResponseCacheGetSet(t *testing.T) {
+	responseCache, err := cache.NewResponseCacheWithStore(
+		&memoryStore{values: make(map[string][]byte)}, time.Hour, &cache.Config{})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, ok := responseCache.Get(ctx, "sdxl", "cache:v1:sdxl:123")
+	require.False(t, ok)
+	responseCache.Set(ctx, "cache:v1:sdxl:123", map[string]interface{}{"output": "a.png"})
+	outputs, ok := responseCache.Get(ctx, "sdxl", "cache:v1:sdxl:123")
+	require.True(t, ok)
+	require.Equal(t, map[string]interface{}{"output": "a.png"}, outputs)
+}
+
+func TestNilResponseCache(t *testing.T) {
+	responseCache, err := cache.NewResponseCache(utils.Config{}, nil)
+	require.NoError(t, err)
+	require.Nil(t, responseCache)
+
+	_, ok := responseCache.Key(&platform.InferRequest{ModelName: "sdxl"}, "v1")
+	require.False(t, ok)
+	_, ok = responseCache.Get(context.Background(), "sdxl", "key")
+	require.False(t, ok)
+	responseCache.Set(context.Background(), "key", nil)
+}
+
+func TestInvalidCacheConfig(t *testing.T) {
+	for _, rule := range []cache.Rule{{}, {Model: "["}} {
+		_, err := cache.NewResponseCacheWithStore(&memoryStore{}, time.Hour, &cache.Config{Rules: []cache.Rule{rule}})
+		require.Error(t, err)
+	}
+}
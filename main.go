@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
-	"fmt"
 	"github.com/HyperGAI/serving-agent/api"
+	"github.com/HyperGAI/serving-agent/cache"
 	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/storage"
 	"github.com/HyperGAI/serving-agent/utils"
 	"github.com/HyperGAI/serving-agent/worker"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sys/unix"
@@ -27,35 +29,51 @@ func main() {
 	}
 	PreCheck(config)
 
+	// The redis client is shared by the rate limiters, the response cache and the idempotency keys
+	var redisClient redis.UniversalClient
+	if config.RedisAddress != "" {
+		redisClient = utils.NewRedisClient(config)
+	}
+
 	// Initialize ML platform service
-	var service platform.Platform
-	if config.MLPlatform == "kserve" {
-		log.Info().Msg(fmt.Sprintf("using KServe platform: %s", config.KServeAddress))
-		service = platform.NewKServe(config)
-	} else if config.MLPlatform == "replicate" {
-		log.Info().Msg(fmt.Sprintf("using Replicate platform: %s, %s",
-			config.ReplicateAddress, config.ReplicateModelID))
-		service = platform.NewReplicate(config)
-	} else if config.MLPlatform == "runpod" {
-		log.Info().Msg(fmt.Sprintf("using RunPod platform: %s, %s",
-			config.RunPodAddress, config.RunPodModelID))
-		service = platform.NewRunPod(config)
-	} else if config.MLPlatform == "k8s" || config.MLPlatform == "k8s-plugin" {
-		log.Info().Msg(fmt.Sprintf("using k8s deployment: %s", config.K8sPluginAddress))
-		service = platform.NewK8sPlugin(config)
-	} else {
-		log.Fatal().Msg("ML platform is not set")
+	service, err := platform.NewPlatform(config.MLPlatform, config, platform.NewRateLimitStore(config, redisClient))
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to initialize ML platform")
+	}
+	service, err = platform.NewDynamicBatcher(config, service)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to initialize dynamic batching")
+	}
+	service, err = platform.NewTransformer(config, service)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load transform rules")
 	}
 
+	store, err := storage.NewObjectStore(config, platform.SharedTransport(config))
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to initialize object store")
+	}
+	artifacts, err := storage.NewArtifacts(config, store)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to initialize artifact hosting")
+	}
+	service, err = platform.NewArtifactRehoster(config, service, artifacts)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to initialize artifact re-hosting")
+	}
+	responseCache, err := cache.NewResponseCache(config, redisClient)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to initialize response cache")
+	}
 	webhook := platform.NewInternalWebhook(config)
-	distributor := worker.NewRedisTaskDistributor(config)
+	distributor := worker.NewRedisTaskDistributor(config, store)
 	/*
 		// Start task processor
-		go runTaskProcessor(config, service, webhook)
+		go runTaskProcessor(config, service, webhook, store, responseCache)
 		// Start model API server
-		runGinServer(config, service, distributor, webhook)
+		runGinServer(config, service, distributor, webhook, responseCache, artifacts, redisClient)
 	*/
-	runServer(config, service, distributor, webhook)
+	runServer(config, service, distributor, webhook, store, responseCache, artifacts, redisClient)
 }
 
 func PreCheck(config utils.Config) {
@@ -65,7 +83,9 @@ func PreCheck(config utils.Config) {
 	if config.TaskTimeout < config.KServeRequestTimeout ||
 		config.TaskTimeout < config.K8sPluginRequestTimeout ||
 		config.TaskTimeout < config.ReplicateRequestTimeout ||
-		config.TaskTimeout < config.RunPodRequestTimeout {
+		config.TaskTimeout < config.RunPodRequestTimeout ||
+		config.TaskTimeout < config.OpenAIRequestTimeout ||
+		config.TaskTimeout < config.OllamaRequestTimeout {
 		log.Fatal().Msg("timeout setting error: TaskTimeout must be >= [Platform]RequestTimeout")
 	}
 }
@@ -75,8 +95,11 @@ func runGinServer(
 	platform platform.Platform,
 	distributor worker.TaskDistributor,
 	webhook platform.Webhook,
+	responseCache *cache.ResponseCache,
+	artifacts *storage.Artifacts,
+	redisClient redis.UniversalClient,
 ) {
-	server, err := api.NewServer(config, platform, distributor, webhook)
+	server, err := api.NewServer(config, platform, distributor, webhook, responseCache, artifacts, redisClient)
 	if err != nil {
 		log.Fatal().Err(err).Msg("cannot create server")
 	}
@@ -86,11 +109,17 @@ func runGinServer(
 	}
 }
 
-func runTaskProcessor(config utils.Config, platform platform.Platform, webhook platform.Webhook) {
+func runTaskProcessor(
+	config utils.Config,
+	platform platform.Platform,
+	webhook platform.Webhook,
+	store storage.ObjectStore,
+	responseCache *cache.ResponseCache,
+) {
 	if config.RedisAddress == "" {
 		log.Fatal().Msg("redis address is not set")
 	}
-	taskProcessor := worker.NewRedisTaskProcessor(config, platform, webhook)
+	taskProcessor := worker.NewRedisTaskProcessor(config, platform, webhook, store, responseCache)
 	log.Info().Msg("start task processor")
 	err := taskProcessor.Start()
 	if err != nil {
@@ -103,9 +132,13 @@ func runServer(
 	platform platform.Platform,
 	distributor worker.TaskDistributor,
 	webhook platform.Webhook,
+	store storage.ObjectStore,
+	responseCache *cache.ResponseCache,
+	artifacts *storage.Artifacts,
+	redisClient redis.UniversalClient,
 ) {
 	// Start the Gin server
-	server, err := api.NewServer(config, platform, distributor, webhook)
+	server, err := api.NewServer(config, platform, distributor, webhook, responseCache, artifacts, redisClient)
 	if err != nil {
 		log.Fatal().Err(err).Msg("cannot create server")
 	}
@@ -128,7 +161,7 @@ func runServer(
 	if config.RedisAddress == "" {
 		log.Fatal().Msg("redis address is not set")
 	}
-	taskProcessor := worker.NewRedisTaskProcessor(config, platform, webhook)
+	taskProcessor := worker.NewRedisTaskProcessor(config, platform, webhook, store, responseCache)
 	log.Info().Msg("start task processor")
 	go func() {
 		if err := taskProcessor.Start(); err != nil {
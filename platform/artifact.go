@@ -0,0 +1,210 @@
+package platform
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/storage"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The minimum length of a raw base64 string to be checked, so that the short texts are skipped quickly
+const minBase64Length = 128
+
+// ArtifactRehoster wraps a platform and re-hosts the files in the outputs with the agent's storage,
+// so that all the platforms return uniform artifact links. The following strings are re-hosted:
+//  1. Data URIs, e.g., `data:image/png;base64,...`.
+//  2. Raw base64 strings of images.
+//  3. The URLs whose hosts match `hosts`, e.g., the files delivered by Replicate.
+//
+// If a file fails to be re-hosted, the original value is kept.
+type ArtifactRehoster struct {
+	platform  Platform
+	artifacts *storage.Artifacts
+	hosts     []string
+	maxSize   int64
+	client    http.Client
+}
+
+// NewArtifactRehoster wraps the platform if `REHOST_ARTIFACTS` is enabled, otherwise the platform is
+// returned as is.
+func NewArtifactRehoster(config utils.Config, platform Platform, artifacts *storage.Artifacts) (Platform, error) {
+	if !config.RehostArtifacts {
+		return platform, nil
+	}
+	if artifacts == nil {
+		return nil, errors.New("ARTIFACT_BASE_URL must be set for re-hosting artifacts")
+	}
+	hosts := make([]string, 0)
+	for _, host := range strings.Split(config.ArtifactRehostHosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			if _, err := path.Match(host, ""); err != nil {
+				return nil, fmt.Errorf("invalid host pattern %s: %w", host, err)
+			}
+			hosts = append(hosts, host)
+		}
+	}
+	log.Info().Msgf("re-host the artifacts in the outputs, hosts: %v", hosts)
+	return NewArtifactRehosterWithOptions(platform, artifacts, hosts, config.MaxArtifactSize,
+		SharedTransport(config)), nil
+}
+
+func NewArtifactRehosterWithOptions(
+	platform Platform,
+	artifacts *storage.Artifacts,
+	hosts []string,
+	maxSize int64,
+	transport http.RoundTripper,
+) *ArtifactRehoster {
+	if maxSize <= 0 {
+		maxSize = 100 << 20
+	}
+	return &ArtifactRehoster{
+		platform:  platform,
+		artifacts: artifacts,
+		hosts:     hosts,
+		maxSize:   maxSize,
+		client:    http.Client{Transport: transport, Timeout: 60 * time.Second},
+	}
+}
+
+func (rehoster *ArtifactRehoster) Predict(
+	ctx context.Context,
+	request *InferRequest,
+	version string,
+) (*InferResponse, *RequestError) {
+	response, e := rehoster.platform.Predict(ctx, request, version)
+	if e != nil {
+		return nil, e
+	}
+	for key, value := range response.Outputs {
+		if slices.Contains(agentOutputs, key) {
+			continue
+		}
+		response.Outputs[key] = rehoster.rehost(ctx, value)
+	}
+	return response, nil
+}
+
+// rehost replaces the files in the value recursively.
+func (rehoster *ArtifactRehoster) rehost(ctx context.Context, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = rehoster.rehost(ctx, item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = rehoster.rehost(ctx, item)
+		}
+		return v
+	case string:
+		link, err := rehoster.rehostString(ctx, v)
+		if err != nil {
+			log.Warn().Msgf("failed to re-host artifact: %v", err)
+			return v
+		}
+		if link != "" {
+			return link
+		}
+	}
+	return value
+}
+
+// rehostString returns the new URL of the file, or an empty string if the value is not a file.
+func (rehoster *ArtifactRehoster) rehostString(ctx context.Context, value string) (string, error) {
+	if strings.HasPrefix(value, "data:") {
+		header, encoded, ok := strings.Cut(value[len("data:"):], ",")
+		if !ok || !strings.HasSuffix(header, ";base64") {
+			return "", nil
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", fmt.Errorf("invalid data URI: %w", err)
+		}
+		return rehoster.artifacts.Save(ctx, data, strings.TrimSuffix(header, ";base64"), "")
+	}
+	if strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://") {
+		u, err := url.Parse(value)
+		if err != nil || !rehoster.matchHost(u.Hostname()) {
+			return "", nil
+		}
+		return rehoster.download(ctx, u)
+	}
+	if len(value) >= minBase64Length {
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return "", nil
+		}
+		if contentType := http.DetectContentType(data); strings.HasPrefix(contentType, "image/") {
+			return rehoster.artifacts.Save(ctx, data, contentType, "")
+		}
+	}
+	return "", nil
+}
+
+func (rehoster *ArtifactRehoster) matchHost(host string) bool {
+	for _, pattern := range rehoster.hosts {
+		if matched, _ := path.Match(pattern, host); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (rehoster *ArtifactRehoster) download(ctx context.Context, u *url.URL) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build request: %w", err)
+	}
+	res, err := rehoster.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", u.Redacted(), err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s, status code: %d", u.Redacted(), res.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, rehoster.maxSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", u.Redacted(), err)
+	}
+	if int64(len(data)) > rehoster.maxSize {
+		return "", fmt.Errorf("%s is larger than %d bytes", u.Redacted(), rehoster.maxSize)
+	}
+	return rehoster.artifacts.Save(ctx, data, res.Header.Get("Content-Type"), path.Ext(u.Path))
+}
+
+// Generate doesn't re-host the streaming outputs.
+func (rehoster *ArtifactRehoster) Generate(
+	request *InferRequest,
+	version string,
+	ctx context.Context,
+	encoder *json.Encoder,
+	flusher http.Flusher,
+) *RequestError {
+	return rehoster.platform.Generate(request, version, ctx, encoder, flusher)
+}
+
+func (rehoster *ArtifactRehoster) Docs(request *DocsRequest) (*ModelSchema, *RequestError) {
+	return rehoster.platform.Docs(request)
+}
+
+func (rehoster *ArtifactRehoster) Cancel(request *CancelRequest) *RequestError {
+	return rehoster.platform.Cancel(request)
+}
+
+func (rehoster *ArtifactRehoster) CheckHealth(ctx context.Context) error {
+	return CheckHealth(ctx, rehoster.platform)
+}
@@ -0,0 +1,97 @@
+package platform_test
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/HyperGAI/serving-agent/platform"
+	mockplatform "github.com/HyperGAI/serving-agent/platform/mock"
+	"github.com/HyperGAI/serving-agent/storage"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestArtifactRehoster(t *testing.T) {
+	image := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 200)...)
+	encoded := base64.StdEncoding.EncodeToString(image)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/out.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(image)
+		case "/large.png":
+			w.Write(make([]byte, 2048))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	host := serverURL.Hostname()
+
+	store, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	artifacts, err := storage.NewArtifacts(utils.Config{ArtifactBaseURL: "http://agent"}, store)
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	backend := mockplatform.NewMockPlatform(ctrl)
+	backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(1).Return(
+		&platform.InferResponse{Outputs: map[string]interface{}{
+			"data_uri": "data:image/png;base64," + encoded,
+			"raw":      encoded,
+			"files": []interface{}{
+				server.URL + "/out.png",
+				map[string]interface{}{"url": server.URL + "/missing.png"},
+				server.URL + "/large.png",
+			},
+			"other":        "https://example.com/a.png",
+			"text":         "a cat",
+			"running_time": "1.0s",
+		}}, nil)
+	rehoster := platform.NewArtifactRehosterWithOptions(
+		backend, artifacts, []string{host}, 1024, http.DefaultTransport)
+
+	response, e := rehoster.Predict(context.Background(), &platform.InferRequest{ModelName: "sdxl"}, "v1")
+	require.Nil(t, e)
+	outputs := response.Outputs
+	isArtifact := func(value interface{}) {
+		link, ok := value.(string)
+		require.True(t, ok)
+		require.True(t, strings.HasPrefix(link, "http://agent/files/artifacts/"), link)
+		require.True(t, strings.HasSuffix(link, ".png"), link)
+		data, _, err := artifacts.Load(context.Background(), strings.TrimPrefix(link, "http://agent/files/"))
+		require.NoError(t, err)
+		require.Equal(t, image, data)
+	}
+	isArtifact(outputs["data_uri"])
+	isArtifact(outputs["raw"])
+	files := outputs["files"].([]interface{})
+	isArtifact(files[0])
+	// The original values are kept if the files fail to be re-hosted
+	require.Equal(t, map[string]interface{}{"url": server.URL + "/missing.png"}, files[1])
+	require.Equal(t, server.URL+"/large.png", files[2])
+	require.Equal(t, "https://example.com/a.png", outputs["other"])
+	require.Equal(t, "a cat", outputs["text"])
+	require.Equal(t, "1.0s", outputs["running_time"])
+}
+
+func TestNewArtifactRehoster(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	backend := mockplatform.NewMockPlatform(ctrl)
+
+	p, err := platform.NewArtifactRehoster(utils.Config{}, backend, nil)
+	require.NoError(t, err)
+	require.Equal(t, backend, p)
+
+	_, err = platform.NewArtifactRehoster(utils.Config{RehostArtifacts: true}, backend, nil)
+	require.Error(t, err)
+}
@@ -3,19 +3,37 @@ package platform
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/rs/zerolog/log"
 	"net/http"
+	"path"
+	"strconv"
 	"time"
 )
 
+// RequestTimeoutHeader carries the remaining time budget of the request in seconds,
+// so that the upstream server can give up once the caller is no longer waiting.
+const RequestTimeoutHeader = "X-Request-Timeout"
+
 type InferRequest struct {
 	ModelName string                 `json:"model_name" binding:"required"`
 	Inputs    map[string]interface{} `json:"inputs" binding:"required"`
+	// OnSubmitted is called with the upstream job ID once the request is submitted to the platform,
+	// so that the job can be canceled later via `Platform.Cancel`.
+	OnSubmitted func(upstreamID string) `json:"-"`
 }
 
 type InferResponse struct {
 	Outputs map[string]interface{}
 }
 
+type CancelRequest struct {
+	ModelName  string `json:"model_name"`
+	UpstreamID string `json:"upstream_id"`
+}
+
 type DocsRequest struct {
 	ModelName string `json:"model_name" binding:"required"`
 }
@@ -28,12 +46,25 @@ type TaskInfo struct {
 	CreatedAt   time.Time   `json:"created_at"`
 	ErrorInfo   string      `json:"error_info"`
 	QueueID     string      `json:"queue_id"`
+	ModelName   string      `json:"model_name"`
+	UpstreamID  string      `json:"upstream_id"`
+	CacheHit    bool        `json:"cache_hit"`
+}
+
+// BatchInfo is the parent record of the tasks created by a batch prediction request.
+type BatchInfo struct {
+	ID        string    `json:"id"`
+	ModelName string    `json:"model_name"`
+	TaskIDs   []string  `json:"task_ids"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Platform interface {
-	Predict(request *InferRequest, version string) (*InferResponse, *RequestError)
+	Predict(ctx context.Context, request *InferRequest, version string) (*InferResponse, *RequestError)
 	Generate(request *InferRequest, version string, ctx context.Context, encoder *json.Encoder, flusher http.Flusher) *RequestError
-	Docs(request *DocsRequest) (interface{}, *RequestError)
+	Docs(request *DocsRequest) (*ModelSchema, *RequestError)
+	// Cancel cancels the upstream job reported by `InferRequest.OnSubmitted`.
+	Cancel(request *CancelRequest) *RequestError
 }
 
 type UpdateRequest struct {
@@ -43,6 +74,8 @@ type UpdateRequest struct {
 	Outputs      interface{} `json:"outputs"`
 	ErrorInfo    string      `json:"error_info"`
 	QueueID      string      `json:"queue_id"`
+	UpstreamID   string      `json:"upstream_id,omitempty"`
+	CacheHit     bool        `json:"cache_hit,omitempty"`
 	DatabaseOnly bool        `json:"database_only"`
 }
 
@@ -52,6 +85,9 @@ type Webhook interface {
 	GetTaskInfo(taskID string) (interface{}, error)
 	GetTaskInfoObject(taskID string) (*TaskInfo, error)
 	GetTaskIDByModelStatus(modelName, status string) ([]string, error)
+	CreateNewBatch(batchID, userID, modelName string, taskIDs []string) error
+	GetBatchInfo(batchID string) (*BatchInfo, error)
+	CheckHealth(ctx context.Context) error
 }
 
 type Fetcher interface {
@@ -59,6 +95,94 @@ type Fetcher interface {
 }
 
 type StreamingMessage struct {
-	Id   int    `json:"id"`
-	Data string `json:"data"`
+	Id    int    `json:"id"`
+	Event string `json:"event,omitempty"`
+	Data  string `json:"data"`
+}
+
+// notifySubmitted reports the upstream job ID if the caller is interested in it.
+func notifySubmitted(request *InferRequest, upstreamID string) {
+	if request.OnSubmitted != nil {
+		request.OnSubmitted(upstreamID)
+	}
+}
+
+// cancelNotSupported is returned by `Cancel` of the platforms without upstream jobs.
+func cancelNotSupported() *RequestError {
+	return NewRequestError(UnsupportedError,
+		errors.New("cancellation is not supported"))
+}
+
+// setRequestTimeout forwards the remaining budget of the context deadline to the upstream server.
+func setRequestTimeout(ctx context.Context, req *http.Request) {
+	if deadline, ok := ctx.Deadline(); ok {
+		budget := time.Until(deadline).Seconds()
+		req.Header.Set(RequestTimeoutHeader, strconv.FormatFloat(budget, 'f', 3, 64))
+	}
+}
+
+// sleepContext waits for the duration and returns false if the context is done before that.
+func sleepContext(ctx context.Context, duration time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(duration):
+		return true
+	}
+}
+
+// NewPlatform creates the ML platform service by name, e.g., kserve, replicate, runpod, k8s, openai or ollama.
+// `router` and `failover` combine multiple platforms. Each platform is wrapped by a circuit breaker
+// if `CIRCUIT_BREAKER_THRESHOLD` is set.
+func NewPlatform(name string, config utils.Config, limits RateLimitStore) (Platform, error) {
+	return newPlatform("", name, config, limits)
+}
+
+// newPlatform creates the platform combined by the parent platform, e.g., `router/failover`. The circuit breaker
+// is named after the route, so that the same backend combined by different platforms has its own breaker.
+func newPlatform(parent, name string, config utils.Config, limits RateLimitStore) (Platform, error) {
+	route := path.Join(parent, name)
+	switch name {
+	case "router":
+		return newRouter(route, config, limits)
+	case "failover":
+		return newFailover(route, config, limits)
+	}
+	service, err := newBackend(name, config, limits)
+	if err != nil {
+		return nil, err
+	}
+	if config.CircuitBreakerThreshold > 0 {
+		return NewCircuitBreaker(route, service, config.CircuitBreakerThreshold,
+			time.Duration(config.CircuitBreakerOpenTimeout)*time.Second), nil
+	}
+	return service, nil
+}
+
+// newBackend creates a single platform. KServe and the k8s plugin pass `upload_webhook` to the models,
+// which upload the images or files by themselves, while the other backends drop it.
+func newBackend(name string, config utils.Config, limits RateLimitStore) (Platform, error) {
+	switch name {
+	case "kserve":
+		log.Info().Msg(fmt.Sprintf("using KServe platform: %s", config.KServeAddress))
+		return NewKServe(config), nil
+	case "replicate":
+		log.Info().Msg(fmt.Sprintf("using Replicate platform: %s, %s",
+			config.ReplicateAddress, config.ReplicateModelID))
+		return newDefaultTransformer(NewReplicate(config, limits), &dropUploadWebhook), nil
+	case "runpod":
+		log.Info().Msg(fmt.Sprintf("using RunPod platform: %s, %s",
+			config.RunPodAddress, config.RunPodModelID))
+		return newDefaultTransformer(NewRunPod(config, limits), &dropUploadWebhook), nil
+	case "k8s", "k8s-plugin":
+		log.Info().Msg(fmt.Sprintf("using k8s deployment: %s", config.K8sPluginAddress))
+		return NewK8sPlugin(config), nil
+	case "openai":
+		log.Info().Msg(fmt.Sprintf("using OpenAI-compatible server: %s", config.OpenAIAddress))
+		return newDefaultTransformer(NewOpenAI(config), &dropUploadWebhook), nil
+	case "ollama":
+		log.Info().Msg(fmt.Sprintf("using Ollama server: %s", config.OllamaAddress))
+		return newDefaultTransformer(NewOllama(config), &dropUploadWebhook), nil
+	}
+	return nil, fmt.Errorf("unknown ML platform: %s", name)
 }
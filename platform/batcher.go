@@ -0,0 +1,251 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// batchCall is a prediction request waiting in the dynamic batcher.
+type batchCall struct {
+	ctx       context.Context
+	instances []interface{}
+	queuedAt  time.Time
+	done      chan batchResult
+}
+
+type batchResult struct {
+	response *InferResponse
+	err      *RequestError
+}
+
+// pendingBatch collects the requests of the same model and the same parameters.
+type pendingBatch struct {
+	modelName string
+	inputs    map[string]interface{}
+	calls     []*batchCall
+	size      int
+	timer     *time.Timer
+}
+
+// DynamicBatcher wraps a platform and coalesces the concurrent V1 predictions of the same model into
+// a single backend call, following the KServe V1 protocol, i.e., the `instances` of the requests are
+// concatenated and the `predictions` are split back to each request. The requests are batched together
+// only if the other input fields are the same. A batch is sent when it has `maxSize` instances or
+// the first request has waited for `maxLatency`.
+type DynamicBatcher struct {
+	platform   Platform
+	models     []string
+	maxSize    int
+	maxLatency time.Duration
+
+	mutex   sync.Mutex
+	pending map[string]*pendingBatch
+}
+
+// NewDynamicBatcher wraps the platform if `DYNAMIC_BATCH_MODELS` is set, otherwise the platform is
+// returned as is.
+func NewDynamicBatcher(config utils.Config, platform Platform) (Platform, error) {
+	if config.DynamicBatchModels == "" {
+		return platform, nil
+	}
+	models := strings.Split(config.DynamicBatchModels, ",")
+	for i := range models {
+		models[i] = strings.TrimSpace(models[i])
+		if _, err := path.Match(models[i], ""); err != nil {
+			return nil, fmt.Errorf("invalid model pattern %s: %w", models[i], err)
+		}
+	}
+	maxSize := config.DynamicBatchMaxSize
+	if maxSize <= 0 {
+		maxSize = 8
+	}
+	maxLatency := time.Duration(config.DynamicBatchMaxLatency) * time.Millisecond
+	if maxLatency <= 0 {
+		maxLatency = 10 * time.Millisecond
+	}
+	log.Info().Msgf("dynamic batching for models %v, max size: %d, max latency: %v",
+		models, maxSize, maxLatency)
+	return NewDynamicBatcherWithOptions(platform, models, maxSize, maxLatency), nil
+}
+
+func NewDynamicBatcherWithOptions(
+	platform Platform,
+	models []string,
+	maxSize int,
+	maxLatency time.Duration,
+) *DynamicBatcher {
+	return &DynamicBatcher{
+		platform:   platform,
+		models:     models,
+		maxSize:    maxSize,
+		maxLatency: maxLatency,
+		pending:    make(map[string]*pendingBatch),
+	}
+}
+
+func (batcher *DynamicBatcher) batchable(modelName string) bool {
+	for _, model := range batcher.models {
+		if matched, _ := path.Match(model, modelName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (batcher *DynamicBatcher) Predict(
+	ctx context.Context,
+	request *InferRequest,
+	version string,
+) (*InferResponse, *RequestError) {
+	instances, ok := request.Inputs["instances"].([]interface{})
+	if version != "v1" || !ok || len(instances) == 0 || len(instances) > batcher.maxSize ||
+		!batcher.batchable(request.ModelName) {
+		return batcher.platform.Predict(ctx, request, version)
+	}
+	// The other input fields are part of the key, since they are shared by the batched requests
+	inputs := make(map[string]interface{}, len(request.Inputs))
+	for key, value := range request.Inputs {
+		if key != "instances" {
+			inputs[key] = value
+		}
+	}
+	params, err := json.Marshal(inputs)
+	if err != nil {
+		return nil, NewRequestError(MarshalError, errors.New("failed to marshal request"))
+	}
+	key := request.ModelName + "\n" + string(params)
+
+	call := &batchCall{
+		ctx:       ctx,
+		instances: instances,
+		queuedAt:  time.Now(),
+		done:      make(chan batchResult, 1),
+	}
+	batcher.mutex.Lock()
+	batch := batcher.pending[key]
+	if batch != nil && batch.size+len(instances) > batcher.maxSize {
+		batcher.dispatch(key, batch)
+		batch = nil
+	}
+	if batch == nil {
+		batch = &pendingBatch{modelName: request.ModelName, inputs: inputs}
+		batcher.pending[key] = batch
+		batch.timer = time.AfterFunc(batcher.maxLatency, func() {
+			batcher.mutex.Lock()
+			defer batcher.mutex.Unlock()
+			if batcher.pending[key] == batch {
+				batcher.dispatch(key, batch)
+			}
+		})
+	}
+	batch.calls = append(batch.calls, call)
+	batch.size += len(instances)
+	if batch.size >= batcher.maxSize {
+		batcher.dispatch(key, batch)
+	}
+	batcher.mutex.Unlock()
+
+	select {
+	case result := <-call.done:
+		return result.response, result.err
+	case <-ctx.Done():
+		return nil, NewRequestError(contextErrorCode(ctx),
+			fmt.Errorf("model-name: %s, request aborted: %w", request.ModelName, ctx.Err()))
+	}
+}
+
+// dispatch removes the batch from the pending batches and sends it. It must be called with the lock held.
+func (batcher *DynamicBatcher) dispatch(key string, batch *pendingBatch) {
+	batch.timer.Stop()
+	delete(batcher.pending, key)
+	go batcher.run(batch)
+}
+
+// run sends the batch to the platform and splits the predictions back to the calls.
+// The backend call is aborted only if all the calls are aborted.
+func (batcher *DynamicBatcher) run(batch *pendingBatch) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	remaining := int32(len(batch.calls))
+	instances := make([]interface{}, 0, batch.size)
+	now := time.Now()
+	for _, call := range batch.calls {
+		stop := context.AfterFunc(call.ctx, func() {
+			if atomic.AddInt32(&remaining, -1) == 0 {
+				cancel()
+			}
+		})
+		defer stop()
+		instances = append(instances, call.instances...)
+		dynamicBatchWait.WithLabelValues(batch.modelName).Observe(now.Sub(call.queuedAt).Seconds())
+	}
+	dynamicBatchSize.WithLabelValues(batch.modelName).Observe(float64(len(instances)))
+
+	inputs := make(map[string]interface{}, len(batch.inputs)+1)
+	for key, value := range batch.inputs {
+		inputs[key] = value
+	}
+	inputs["instances"] = instances
+	request := &InferRequest{ModelName: batch.modelName, Inputs: inputs}
+	response, e := batcher.platform.Predict(ctx, request, "v1")
+	if e == nil {
+		predictions, ok := response.Outputs["predictions"].([]interface{})
+		if !ok || len(predictions) != len(instances) {
+			e = NewRequestError(UpstreamServerError, fmt.Errorf(
+				"model-name: %s, the batched predictions don't match the %d instances",
+				batch.modelName, len(instances)))
+		}
+	}
+	if e != nil {
+		for _, call := range batch.calls {
+			call.done <- batchResult{err: e}
+		}
+		return
+	}
+
+	predictions := response.Outputs["predictions"].([]interface{})
+	offset := 0
+	for _, call := range batch.calls {
+		outputs := make(map[string]interface{}, len(response.Outputs))
+		for key, value := range response.Outputs {
+			outputs[key] = value
+		}
+		outputs["predictions"] = predictions[offset : offset+len(call.instances)]
+		offset += len(call.instances)
+		call.done <- batchResult{response: &InferResponse{Outputs: outputs}}
+	}
+}
+
+func (batcher *DynamicBatcher) Generate(
+	request *InferRequest,
+	version string,
+	ctx context.Context,
+	encoder *json.Encoder,
+	flusher http.Flusher,
+) *RequestError {
+	return batcher.platform.Generate(request, version, ctx, encoder, flusher)
+}
+
+func (batcher *DynamicBatcher) Docs(request *DocsRequest) (*ModelSchema, *RequestError) {
+	return batcher.platform.Docs(request)
+}
+
+// Cancel only applies to the requests which are not batched, since the upstream job of a batch
+// is shared by several requests.
+func (batcher *DynamicBatcher) Cancel(request *CancelRequest) *RequestError {
+	return batcher.platform.Cancel(request)
+}
+
+func (batcher *DynamicBatcher) CheckHealth(ctx context.Context) error {
+	return CheckHealth(ctx, batcher.platform)
+}
@@ -0,0 +1,212 @@
+package platform_test
+
+import (
+	"context"
+	"errors"
+	"github.com/HyperGAI/serving-agent/platform"
+	mockplatform "github.com/HyperGAI/serving-agent/platform/mock"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"sync"
+	"testing"
+	"time"
+)
+
+// echoPredictions returns the instances as the predictions.
+func echoPredictions(_ context.Context, request *platform.InferRequest, _ string) (
+	*platform.InferResponse, *platform.RequestError) {
+	return &platform.InferResponse{Outputs: map[string]interface{}{
+		"predictions": request.Inputs["instances"],
+		"model_name":  request.ModelName,
+	}}, nil
+}
+
+func newBatchRequest(modelName string, instances ...interface{}) *platform.InferRequest {
+	return &platform.InferRequest{
+		ModelName: modelName,
+		Inputs:    map[string]interface{}{"instances": instances},
+	}
+}
+
+func TestDynamicBatcher(t *testing.T) {
+	testCases := []struct {
+		name       string
+		requests   []*platform.InferRequest
+		buildStubs func(backend *mockplatform.MockPlatform)
+		check      func(responses []*platform.InferResponse, errs []*platform.RequestError)
+	}{
+		{
+			name: "Coalesced",
+			requests: []*platform.InferRequest{
+				newBatchRequest("resnet", 1.0),
+				newBatchRequest("resnet", 2.0, 3.0),
+				newBatchRequest("resnet", 4.0),
+			},
+			buildStubs: func(backend *mockplatform.MockPlatform) {
+				backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(1).
+					DoAndReturn(func(ctx context.Context, request *platform.InferRequest, version string) (
+						*platform.InferResponse, *platform.RequestError) {
+						require.Len(t, request.Inputs["instances"], 4)
+						return echoPredictions(ctx, request, version)
+					})
+			},
+			check: func(responses []*platform.InferResponse, errs []*platform.RequestError) {
+				for i, instances := range [][]interface{}{{1.0}, {2.0, 3.0}, {4.0}} {
+					require.Nil(t, errs[i])
+					require.ElementsMatch(t, instances, responses[i].Outputs["predictions"])
+					require.Equal(t, "resnet", responses[i].Outputs["model_name"])
+				}
+			},
+		},
+		{
+			name: "Different parameters",
+			requests: []*platform.InferRequest{
+				newBatchRequest("resnet", 1.0),
+				{ModelName: "resnet", Inputs: map[string]interface{}{"instances": []interface{}{2.0}, "top_k": 5.0}},
+			},
+			buildStubs: func(backend *mockplatform.MockPlatform) {
+				backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(2).
+					DoAndReturn(echoPredictions)
+			},
+			check: func(responses []*platform.InferResponse, errs []*platform.RequestError) {
+				require.Equal(t, []interface{}{1.0}, responses[0].Outputs["predictions"])
+				require.Equal(t, []interface{}{2.0}, responses[1].Outputs["predictions"])
+			},
+		},
+		{
+			name: "Not batched",
+			requests: []*platform.InferRequest{
+				newBatchRequest("gpt2", 1.0),
+				{ModelName: "resnet", Inputs: map[string]interface{}{"image": "a.png"}},
+				newBatchRequest("resnet", 1.0, 2.0, 3.0, 4.0, 5.0),
+			},
+			buildStubs: func(backend *mockplatform.MockPlatform) {
+				backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(3).
+					DoAndReturn(echoPredictions)
+			},
+			check: func(responses []*platform.InferResponse, errs []*platform.RequestError) {
+				for i := range responses {
+					require.Nil(t, errs[i])
+				}
+			},
+		},
+		{
+			name: "Mismatched predictions",
+			requests: []*platform.InferRequest{
+				newBatchRequest("resnet", 1.0),
+				newBatchRequest("resnet", 2.0),
+			},
+			buildStubs: func(backend *mockplatform.MockPlatform) {
+				backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(1).
+					Return(&platform.InferResponse{Outputs: map[string]interface{}{
+						"predictions": []interface{}{1.0}}}, nil)
+			},
+			check: func(responses []*platform.InferResponse, errs []*platform.RequestError) {
+				for i := range responses {
+					require.NotNil(t, errs[i])
+					require.Equal(t, platform.UpstreamServerError, errs[i].StatusCode)
+				}
+			},
+		},
+		{
+			name: "Backend error",
+			requests: []*platform.InferRequest{
+				newBatchRequest("resnet", 1.0),
+				newBatchRequest("resnet", 2.0),
+			},
+			buildStubs: func(backend *mockplatform.MockPlatform) {
+				backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(1).
+					Return(nil, platform.NewRequestError(platform.SendRequestError, errors.New("failed")))
+			},
+			check: func(responses []*platform.InferResponse, errs []*platform.RequestError) {
+				for i := range responses {
+					require.NotNil(t, errs[i])
+					require.Equal(t, platform.SendRequestError, errs[i].StatusCode)
+				}
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			backend := mockplatform.NewMockPlatform(ctrl)
+			tc.buildStubs(backend)
+			batcher := platform.NewDynamicBatcherWithOptions(backend, []string{"resnet*"}, 4, 50*time.Millisecond)
+
+			var wg sync.WaitGroup
+			responses := make([]*platform.InferResponse, len(tc.requests))
+			errs := make([]*platform.RequestError, len(tc.requests))
+			for i := range tc.requests {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					responses[i], errs[i] = batcher.Predict(context.Background(), tc.requests[i], "v1")
+				}(i)
+			}
+			wg.Wait()
+			tc.check(responses, errs)
+		})
+	}
+}
+
+func TestDynamicBatcherMaxSize(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	backend := mockplatform.NewMockPlatform(ctrl)
+	backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(1).DoAndReturn(echoPredictions)
+	// The batch is sent once it is full instead of waiting for the max latency
+	batcher := platform.NewDynamicBatcherWithOptions(backend, []string{"resnet"}, 2, time.Hour)
+
+	var wg sync.WaitGroup
+	for _, value := range []float64{1, 2} {
+		wg.Add(1)
+		go func(value float64) {
+			defer wg.Done()
+			response, e := batcher.Predict(context.Background(), newBatchRequest("resnet", value), "v1")
+			require.Nil(t, e)
+			require.Equal(t, []interface{}{value}, response.Outputs["predictions"])
+		}(value)
+	}
+	wg.Wait()
+}
+
+func TestDynamicBatcherCanceled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	backend := mockplatform.NewMockPlatform(ctrl)
+	backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(1).
+		DoAndReturn(func(ctx context.Context, _ *platform.InferRequest, _ string) (
+			*platform.InferResponse, *platform.RequestError) {
+			// The backend call is aborted since the only caller is gone
+			<-ctx.Done()
+			return nil, platform.NewRequestError(platform.CanceledError, ctx.Err())
+		})
+	batcher := platform.NewDynamicBatcherWithOptions(backend, []string{"resnet"}, 4, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, e := batcher.Predict(ctx, newBatchRequest("resnet", 1.0), "v1")
+	require.NotNil(t, e)
+	require.Equal(t, platform.TimeoutError, e.StatusCode)
+}
+
+func TestNewDynamicBatcher(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	backend := mockplatform.NewMockPlatform(ctrl)
+	p, err := platform.NewDynamicBatcher(utils.Config{}, backend)
+	require.NoError(t, err)
+	require.Equal(t, backend, p)
+
+	_, err = platform.NewDynamicBatcher(utils.Config{DynamicBatchModels: "resnet,["}, backend)
+	require.Error(t, err)
+}
@@ -0,0 +1,208 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	CircuitClosed   = "closed"
+	CircuitHalfOpen = "half-open"
+	CircuitOpen     = "open"
+)
+
+// The value of the `circuit_breaker_state` gauge for each state
+var circuitStateValues = map[string]float64{
+	CircuitClosed:   0,
+	CircuitHalfOpen: 1,
+	CircuitOpen:     2,
+}
+
+// circuitBreakers keeps the created circuit breakers for the readiness check, indexed by the name,
+// which is the route of the platform created by `NewPlatform`, e.g., `router/kserve`.
+var circuitBreakers = struct {
+	sync.Mutex
+	breakers map[string]*CircuitBreaker
+}{breakers: make(map[string]*CircuitBreaker)}
+
+// CircuitBreaker wraps a platform and fails fast with CircuitOpenError after `threshold`
+// consecutive failures. After `openTimeout`, it lets one request through to probe the platform,
+// and closes again if the probe succeeds.
+type CircuitBreaker struct {
+	name        string
+	platform    Platform
+	threshold   int
+	openTimeout time.Duration
+
+	mutex    sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+func NewCircuitBreaker(name string, platform Platform, threshold int, openTimeout time.Duration) *CircuitBreaker {
+	breaker := &CircuitBreaker{
+		name:        name,
+		platform:    platform,
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		state:       CircuitClosed,
+	}
+	circuitBreakerState.WithLabelValues(name).Set(circuitStateValues[CircuitClosed])
+	circuitBreakers.Lock()
+	circuitBreakers.breakers[name] = breaker
+	circuitBreakers.Unlock()
+	return breaker
+}
+
+// CircuitBreakerStates returns the states of the circuit breakers indexed by the name.
+func CircuitBreakerStates() map[string]string {
+	circuitBreakers.Lock()
+	defer circuitBreakers.Unlock()
+	states := make(map[string]string, len(circuitBreakers.breakers))
+	for name, breaker := range circuitBreakers.breakers {
+		states[name] = breaker.State()
+	}
+	return states
+}
+
+// AllCircuitsOpen returns true if there are circuit breakers and all of them are open.
+func AllCircuitsOpen() bool {
+	states := CircuitBreakerStates()
+	for _, state := range states {
+		if state != CircuitOpen {
+			return false
+		}
+	}
+	return len(states) > 0
+}
+
+func (breaker *CircuitBreaker) State() string {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	if breaker.state == CircuitOpen && time.Since(breaker.openedAt) >= breaker.openTimeout {
+		// The next request will be a probe
+		return CircuitHalfOpen
+	}
+	return breaker.state
+}
+
+func (breaker *CircuitBreaker) setState(state string) {
+	if breaker.state != state {
+		log.Warn().Msgf("platform %s: circuit breaker %s -> %s", breaker.name, breaker.state, state)
+	}
+	breaker.state = state
+	circuitBreakerState.WithLabelValues(breaker.name).Set(circuitStateValues[state])
+}
+
+// openError returns CircuitOpenError if the circuit is open and it is not time to probe the platform yet.
+// The caller must hold the mutex.
+func (breaker *CircuitBreaker) openError() *RequestError {
+	if elapsed := time.Since(breaker.openedAt); breaker.state == CircuitOpen && elapsed < breaker.openTimeout {
+		e := NewRequestError(CircuitOpenError,
+			fmt.Errorf("platform %s is unavailable, circuit breaker is open", breaker.name))
+		e.RetryAfter = breaker.openTimeout - elapsed
+		return e
+	}
+	return nil
+}
+
+// allow checks if a request can be sent to the platform.
+func (breaker *CircuitBreaker) allow() *RequestError {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	switch breaker.state {
+	case CircuitOpen:
+		if e := breaker.openError(); e != nil {
+			return e
+		}
+		// Only one request is sent to probe the platform
+		breaker.setState(CircuitHalfOpen)
+		return nil
+	case CircuitHalfOpen:
+		return NewRequestError(CircuitOpenError,
+			fmt.Errorf("platform %s is unavailable, circuit breaker is half-open", breaker.name))
+	}
+	return nil
+}
+
+// record updates the state according to the result of the request.
+func (breaker *CircuitBreaker) record(ctx context.Context, e *RequestError) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	if e != nil && (ctx.Err() != nil || e.StatusCode == RateLimitedError) {
+		// The request was aborted by the caller or throttled, either by the rate limiter of the agent
+		// or by the platform with 429, which tells nothing about the health of the platform
+		if breaker.state == CircuitHalfOpen {
+			// Let the next request probe the platform again
+			breaker.openedAt = time.Now().Add(-breaker.openTimeout)
+			breaker.setState(CircuitOpen)
+		}
+		return
+	}
+	if e != nil && ShouldFailover(e) {
+		breaker.failures += 1
+		if breaker.state == CircuitHalfOpen || breaker.failures >= breaker.threshold {
+			breaker.openedAt = time.Now()
+			breaker.setState(CircuitOpen)
+		}
+		return
+	}
+	breaker.failures = 0
+	breaker.setState(CircuitClosed)
+}
+
+func (breaker *CircuitBreaker) Predict(
+	ctx context.Context,
+	request *InferRequest,
+	version string,
+) (*InferResponse, *RequestError) {
+	if e := breaker.allow(); e != nil {
+		return nil, e
+	}
+	response, e := breaker.platform.Predict(ctx, request, version)
+	breaker.record(ctx, e)
+	return response, e
+}
+
+func (breaker *CircuitBreaker) Generate(
+	request *InferRequest,
+	version string,
+	ctx context.Context,
+	encoder *json.Encoder,
+	flusher http.Flusher,
+) *RequestError {
+	if e := breaker.allow(); e != nil {
+		return e
+	}
+	e := breaker.platform.Generate(request, version, ctx, encoder, flusher)
+	breaker.record(ctx, e)
+	return e
+}
+
+// Docs fails fast while the circuit is open, but it neither probes the platform nor counts the failures,
+// since a broken docs endpoint doesn't mean that the predictions fail.
+func (breaker *CircuitBreaker) Docs(request *DocsRequest) (*ModelSchema, *RequestError) {
+	breaker.mutex.Lock()
+	e := breaker.openError()
+	breaker.mutex.Unlock()
+	if e != nil {
+		return nil, e
+	}
+	return breaker.platform.Docs(request)
+}
+
+// Cancel is always forwarded so that the running jobs can be stopped.
+func (breaker *CircuitBreaker) Cancel(request *CancelRequest) *RequestError {
+	return breaker.platform.Cancel(request)
+}
+
+// CheckHealth checks the wrapped platform regardless of the state of the circuit.
+func (breaker *CircuitBreaker) CheckHealth(ctx context.Context) error {
+	return CheckHealth(ctx, breaker.platform)
+}
@@ -0,0 +1,113 @@
+package platform_test
+
+import (
+	"context"
+	"errors"
+	"github.com/HyperGAI/serving-agent/platform"
+	mockplatform "github.com/HyperGAI/serving-agent/platform/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	backend := mockplatform.NewMockPlatform(ctrl)
+	breaker := platform.NewCircuitBreaker("test-breaker", backend, 2, 50*time.Millisecond)
+	request := &platform.InferRequest{ModelName: "test", Inputs: map[string]interface{}{}}
+	unavailable := platform.NewRequestError(platform.SendRequestError, errors.New("connection refused"))
+
+	// Invalid inputs don't open the circuit
+	backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).
+		Return(nil, platform.NewRequestError(platform.InvalidInputError, errors.New("invalid inputs")))
+	for i := 0; i < 2; i++ {
+		_, err := breaker.Predict(context.Background(), request, "v1")
+		require.Equal(t, platform.InvalidInputError, err.StatusCode)
+	}
+	require.Equal(t, platform.CircuitClosed, breaker.State())
+
+	// Neither do the throttled requests
+	backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(3).
+		Return(nil, platform.NewRequestError(platform.RateLimitedError, errors.New("rate limited")))
+	for i := 0; i < 3; i++ {
+		_, err := breaker.Predict(context.Background(), request, "v1")
+		require.Equal(t, platform.RateLimitedError, err.StatusCode)
+	}
+	require.Equal(t, platform.CircuitClosed, breaker.State())
+
+	// Nor the invalid API keys
+	backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).
+		Return(nil, platform.NewRequestError(platform.UpstreamAuthError, errors.New("invalid token")))
+	for i := 0; i < 2; i++ {
+		_, err := breaker.Predict(context.Background(), request, "v1")
+		require.Equal(t, platform.UpstreamAuthError, err.StatusCode)
+	}
+	require.Equal(t, platform.CircuitClosed, breaker.State())
+
+	// The circuit opens after consecutive failures and fails fast
+	backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).Return(nil, unavailable)
+	for i := 0; i < 2; i++ {
+		_, err := breaker.Predict(context.Background(), request, "v1")
+		require.Equal(t, platform.SendRequestError, err.StatusCode)
+	}
+	require.Equal(t, platform.CircuitOpen, breaker.State())
+	require.Equal(t, platform.CircuitOpen, platform.CircuitBreakerStates()["test-breaker"])
+	_, err := breaker.Predict(context.Background(), request, "v1")
+	require.Equal(t, platform.CircuitOpenError, err.StatusCode)
+
+	// A failed probe opens the circuit again
+	time.Sleep(60 * time.Millisecond)
+	require.Equal(t, platform.CircuitHalfOpen, breaker.State())
+	backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, unavailable)
+	_, err = breaker.Predict(context.Background(), request, "v1")
+	require.Equal(t, platform.SendRequestError, err.StatusCode)
+	require.Equal(t, platform.CircuitOpen, breaker.State())
+
+	// A successful probe closes the circuit
+	time.Sleep(60 * time.Millisecond)
+	backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+		Return(&platform.InferResponse{}, nil)
+	_, err = breaker.Predict(context.Background(), request, "v1")
+	require.Nil(t, err)
+	require.Equal(t, platform.CircuitClosed, breaker.State())
+}
+
+func TestCircuitBreakerDocs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	backend := mockplatform.NewMockPlatform(ctrl)
+	breaker := platform.NewCircuitBreaker("test-breaker-docs", backend, 2, 50*time.Millisecond)
+	request := &platform.InferRequest{ModelName: "test", Inputs: map[string]interface{}{}}
+	unavailable := platform.NewRequestError(platform.SendRequestError, errors.New("connection refused"))
+
+	// The failures of the docs endpoint don't open the circuit
+	backend.EXPECT().Docs(gomock.Any()).Times(3).Return(nil, unavailable)
+	for i := 0; i < 3; i++ {
+		_, err := breaker.Docs(&platform.DocsRequest{ModelName: "test"})
+		require.Equal(t, platform.SendRequestError, err.StatusCode)
+	}
+	require.Equal(t, platform.CircuitClosed, breaker.State())
+
+	// Docs fails fast while the circuit is open
+	backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(2).Return(nil, unavailable)
+	for i := 0; i < 2; i++ {
+		_, _ = breaker.Predict(context.Background(), request, "v1")
+	}
+	_, err := breaker.Docs(&platform.DocsRequest{ModelName: "test"})
+	require.Equal(t, platform.CircuitOpenError, err.StatusCode)
+
+	// Docs doesn't take the probe of a half-open circuit
+	time.Sleep(60 * time.Millisecond)
+	backend.EXPECT().Docs(gomock.Any()).Times(1).Return(&platform.ModelSchema{ModelName: "test"}, nil)
+	_, err = breaker.Docs(&platform.DocsRequest{ModelName: "test"})
+	require.Nil(t, err)
+	backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+		Return(&platform.InferResponse{}, nil)
+	_, err = breaker.Predict(context.Background(), request, "v1")
+	require.Nil(t, err)
+	require.Equal(t, platform.CircuitClosed, breaker.State())
+}
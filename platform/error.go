@@ -1,6 +1,13 @@
 package platform
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
 
 const (
 	InternalError          = 20000
@@ -11,20 +18,137 @@ const (
 	UnmarshalResponseError = 20005
 	UnknownAPIVersion      = 20006
 	InvalidInputError      = 20007
+	UnknownModelError      = 20008
+	UpstreamServerError    = 20009
+	TimeoutError           = 20010
+	CanceledError          = 20011
+	CircuitOpenError       = 20012
+	RateLimitedError       = 20013
+	UnavailableError       = 20014
+	UnsupportedError       = 20015
+	UpstreamAuthError      = 20016
 )
 
+// The machine-readable reasons of the errors
+const (
+	ReasonInternal            = "internal_error"
+	ReasonInvalidRequest      = "invalid_request"
+	ReasonInvalidInput        = "invalid_input"
+	ReasonUnknownModel        = "unknown_model"
+	ReasonConnectionFailed    = "connection_failed"
+	ReasonBadUpstreamResponse = "bad_upstream_response"
+	ReasonUpstreamError       = "upstream_error"
+	ReasonUpstreamAuth        = "upstream_auth"
+	ReasonRateLimited         = "rate_limited"
+	ReasonUnavailable         = "upstream_unavailable"
+	ReasonTimeout             = "timeout"
+	ReasonCanceled            = "canceled"
+	ReasonCircuitOpen         = "circuit_open"
+	ReasonUnsupported         = "not_supported"
+)
+
+// RequestError is the error of a platform request. `StatusCode` is one of the error codes above.
+// `UpstreamStatus` is the HTTP status code returned by the platform, or 0 if there is no response,
+// and `RetryAfter` is parsed from its `Retry-After` header. `Retryable` is true if the same request
+// may succeed later, e.g., the platform is overloaded.
 type RequestError struct {
-	StatusCode int
-	Err        error
+	StatusCode     int
+	Err            error
+	UpstreamStatus int
+	Retryable      bool
+	Reason         string
+	RetryAfter     time.Duration
 }
 
 func NewRequestError(statusCode int, err error) *RequestError {
+	reason, retryable := errorReason(statusCode)
 	return &RequestError{
 		StatusCode: statusCode,
 		Err:        err,
+		Retryable:  retryable,
+		Reason:     reason,
+	}
+}
+
+// NewUpstreamError returns the error of a non-successful response of the platform.
+func NewUpstreamError(res *http.Response, err error) *RequestError {
+	e := NewRequestError(statusErrorCode(res.StatusCode), err)
+	e.UpstreamStatus = res.StatusCode
+	if delay, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+		e.RetryAfter = delay
+	}
+	return e
+}
+
+// errorReason returns the default reason of the error code and whether it is retryable.
+func errorReason(statusCode int) (string, bool) {
+	switch statusCode {
+	case MarshalError, BuildRequestError, UnknownAPIVersion:
+		return ReasonInvalidRequest, false
+	case InvalidInputError:
+		return ReasonInvalidInput, false
+	case UnknownModelError:
+		return ReasonUnknownModel, false
+	case SendRequestError:
+		return ReasonConnectionFailed, true
+	case ReadResponseError, UnmarshalResponseError:
+		return ReasonBadUpstreamResponse, true
+	case UpstreamServerError:
+		return ReasonUpstreamError, true
+	case UpstreamAuthError:
+		// The API key of the agent is invalid, which can't be fixed by the client
+		return ReasonUpstreamAuth, false
+	case RateLimitedError:
+		return ReasonRateLimited, true
+	case UnavailableError:
+		return ReasonUnavailable, true
+	case TimeoutError:
+		return ReasonTimeout, true
+	case CanceledError:
+		return ReasonCanceled, false
+	case CircuitOpenError:
+		return ReasonCircuitOpen, true
+	case UnsupportedError:
+		return ReasonUnsupported, false
 	}
+	return ReasonInternal, false
 }
 
 func (r *RequestError) Error() string {
 	return fmt.Sprintf("status %d: %v", r.StatusCode, r.Err)
 }
+
+// sendErrorCode returns the error code for the error returned by `http.Client.Do`.
+func sendErrorCode(err error) int {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return TimeoutError
+	}
+	return SendRequestError
+}
+
+// contextErrorCode returns the error code when the context is done,
+// i.e., TimeoutError if the deadline is exceeded, otherwise CanceledError.
+func contextErrorCode(ctx context.Context) int {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return TimeoutError
+	}
+	return CanceledError
+}
+
+// statusErrorCode returns the error code for a non-successful response status code.
+func statusErrorCode(statusCode int) int {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return RateLimitedError
+	case statusCode == http.StatusServiceUnavailable:
+		return UnavailableError
+	case statusCode == http.StatusNotFound:
+		return UnknownModelError
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return UpstreamAuthError
+	case statusCode >= http.StatusInternalServerError:
+		return UpstreamServerError
+	}
+	return InvalidInputError
+}
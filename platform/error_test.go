@@ -0,0 +1,63 @@
+package platform_test
+
+import (
+	"errors"
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewUpstreamError(t *testing.T) {
+	testCases := []struct {
+		name       string
+		status     int
+		retryAfter string
+		code       int
+		reason     string
+		retryable  bool
+		delay      time.Duration
+	}{
+		{name: "Bad request", status: 400, code: platform.InvalidInputError, reason: platform.ReasonInvalidInput},
+		{name: "Unprocessable", status: 422, code: platform.InvalidInputError, reason: platform.ReasonInvalidInput},
+		{
+			name: "Unauthorized", status: 401, code: platform.UpstreamAuthError,
+			reason: platform.ReasonUpstreamAuth,
+		},
+		{
+			name: "Forbidden", status: 403, code: platform.UpstreamAuthError,
+			reason: platform.ReasonUpstreamAuth,
+		},
+		{name: "Not found", status: 404, code: platform.UnknownModelError, reason: platform.ReasonUnknownModel},
+		{
+			name: "Rate limited", status: 429, retryAfter: "3", code: platform.RateLimitedError,
+			reason: platform.ReasonRateLimited, retryable: true, delay: 3 * time.Second,
+		},
+		{
+			name: "Unavailable", status: 503, retryAfter: "invalid", code: platform.UnavailableError,
+			reason: platform.ReasonUnavailable, retryable: true,
+		},
+		{
+			name: "Server error", status: 500, code: platform.UpstreamServerError,
+			reason: platform.ReasonUpstreamError, retryable: true,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			res := &http.Response{StatusCode: tc.status, Header: http.Header{}}
+			if tc.retryAfter != "" {
+				res.Header.Set("Retry-After", tc.retryAfter)
+			}
+			e := platform.NewUpstreamError(res, errors.New("failed"))
+			require.Equal(t, tc.code, e.StatusCode)
+			require.Equal(t, tc.status, e.UpstreamStatus)
+			require.Equal(t, tc.reason, e.Reason)
+			require.Equal(t, tc.retryable, e.Retryable)
+			require.Equal(t, tc.delay, e.RetryAfter)
+		})
+	}
+}
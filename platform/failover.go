@@ -0,0 +1,214 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"strings"
+)
+
+// Failover tries the backends in order, e.g., a KServe cluster and then Replicate.
+// A request is retried on the next backend if the current one cannot be reached,
+// returns 5xx or times out. The job submitted to the failed backend is canceled first, so that the request
+// isn't billed twice. The backend serving the request is recorded as `served_by` in the outputs, or sent
+// as the last message of the stream.
+type Failover struct {
+	names    []string
+	backends []Platform
+}
+
+func NewFailover(config utils.Config, limits RateLimitStore) (Platform, error) {
+	return newFailover("failover", config, limits)
+}
+
+func newFailover(route string, config utils.Config, limits RateLimitStore) (Platform, error) {
+	names := make([]string, 0)
+	for _, name := range strings.Split(config.FailoverPlatforms, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("FAILOVER_PLATFORMS is not set")
+	}
+	backends := make([]Platform, len(names))
+	for i, name := range names {
+		if name == "failover" || name == "router" {
+			return nil, fmt.Errorf("a failover platform cannot contain %s", name)
+		}
+		backend, err := newPlatform(route, name, config, limits)
+		if err != nil {
+			return nil, err
+		}
+		backends[i] = backend
+	}
+	return NewFailoverFromBackends(names, backends), nil
+}
+
+// NewFailoverFromBackends creates a failover platform given the backends ordered by priority.
+func NewFailoverFromBackends(names []string, backends []Platform) *Failover {
+	return &Failover{
+		names:    names,
+		backends: backends,
+	}
+}
+
+// ShouldFailover returns true if the error is caused by an unavailable backend instead of the request itself.
+// The authentication errors are not, since the other backends can't fix the config of the agent.
+func ShouldFailover(err *RequestError) bool {
+	switch err.StatusCode {
+	case SendRequestError, UpstreamServerError, TimeoutError, CircuitOpenError, RateLimitedError, UnavailableError:
+		return true
+	}
+	return false
+}
+
+// copyRequest copies the request for the backend. The upstream ID reported by the backend is saved
+// in `upstreamID`, and reported to the caller prefixed with the backend name so that `Cancel` knows
+// where the job is running.
+func copyRequest(request *InferRequest, name string, upstreamID *string) *InferRequest {
+	inputs := make(map[string]interface{}, len(request.Inputs))
+	for key, value := range request.Inputs {
+		inputs[key] = value
+	}
+	backendRequest := &InferRequest{ModelName: request.ModelName, Inputs: inputs}
+	backendRequest.OnSubmitted = func(id string) {
+		*upstreamID = id
+		if request.OnSubmitted != nil {
+			request.OnSubmitted(name + ":" + id)
+		}
+	}
+	return backendRequest
+}
+
+// cancelSubmitted cancels the job submitted to the failed backend before failing over.
+// It returns false if the job may still be running, in which case it doesn't fail over.
+func (service *Failover) cancelSubmitted(i int, modelName string, upstreamID string) bool {
+	if upstreamID == "" {
+		return true
+	}
+	cancelRequest := CancelRequest{ModelName: modelName, UpstreamID: upstreamID}
+	if e := service.backends[i].Cancel(&cancelRequest); e != nil {
+		log.Error().Msgf("model-name: %s, failed to cancel job %s on platform %s: %v",
+			modelName, upstreamID, service.names[i], e)
+		return false
+	}
+	return true
+}
+
+func (service *Failover) Predict(
+	ctx context.Context,
+	request *InferRequest,
+	version string,
+) (*InferResponse, *RequestError) {
+	var e *RequestError
+	for i, backend := range service.backends {
+		// Each backend gets a copy of the request, since the backends may modify the inputs
+		var response *InferResponse
+		var upstreamID string
+		response, e = backend.Predict(ctx, copyRequest(request, service.names[i], &upstreamID), version)
+		if e == nil {
+			failoverRequests.WithLabelValues(service.names[i], "succeeded").Inc()
+			if response.Outputs == nil {
+				response.Outputs = make(map[string]interface{})
+			}
+			response.Outputs["served_by"] = service.names[i]
+			return response, nil
+		}
+		// There is no time left for the other backends
+		if !ShouldFailover(e) || ctx.Err() != nil || !service.cancelSubmitted(i, request.ModelName, upstreamID) {
+			failoverRequests.WithLabelValues(service.names[i], "failed").Inc()
+			return nil, e
+		}
+		failoverRequests.WithLabelValues(service.names[i], "failed_over").Inc()
+		log.Warn().Msgf("model-name: %s, platform %s is unavailable: %v",
+			request.ModelName, service.names[i], e)
+	}
+	return nil, e
+}
+
+// flushRecorder records the number of messages sent to the client, since each message is flushed.
+type flushRecorder struct {
+	http.Flusher
+	flushes int
+}
+
+func (recorder *flushRecorder) Flush() {
+	recorder.flushes += 1
+	recorder.Flusher.Flush()
+}
+
+func (service *Failover) Generate(
+	request *InferRequest,
+	version string,
+	ctx context.Context,
+	encoder *json.Encoder,
+	flusher http.Flusher,
+) *RequestError {
+	var e *RequestError
+	for i, backend := range service.backends {
+		recorder := &flushRecorder{Flusher: flusher}
+		var upstreamID string
+		e = backend.Generate(copyRequest(request, service.names[i], &upstreamID), version, ctx, encoder, recorder)
+		if e == nil {
+			failoverRequests.WithLabelValues(service.names[i], "succeeded").Inc()
+			message := StreamingMessage{Id: recorder.flushes, Event: "served_by", Data: service.names[i]}
+			if err := encoder.Encode(message); err != nil {
+				log.Error().Msgf("model-name: %s, failed to encode served_by: %v", request.ModelName, err)
+				return nil
+			}
+			flusher.Flush()
+			return nil
+		}
+		// It cannot fail over once the streaming has started
+		if !ShouldFailover(e) || recorder.flushes > 0 || ctx.Err() != nil ||
+			!service.cancelSubmitted(i, request.ModelName, upstreamID) {
+			failoverRequests.WithLabelValues(service.names[i], "failed").Inc()
+			return e
+		}
+		failoverRequests.WithLabelValues(service.names[i], "failed_over").Inc()
+		log.Warn().Msgf("model-name: %s, platform %s is unavailable: %v",
+			request.ModelName, service.names[i], e)
+	}
+	return e
+}
+
+func (service *Failover) Docs(request *DocsRequest) (*ModelSchema, *RequestError) {
+	var e *RequestError
+	for i, backend := range service.backends {
+		var outputs *ModelSchema
+		outputs, e = backend.Docs(request)
+		if e == nil {
+			return outputs, nil
+		}
+		if !ShouldFailover(e) {
+			return nil, e
+		}
+		log.Warn().Msgf("model-name: %s, platform %s is unavailable: %v",
+			request.ModelName, service.names[i], e)
+	}
+	return nil, NewRequestError(e.StatusCode, fmt.Errorf("all platforms are unavailable: %v", e.Err))
+}
+
+// Cancel cancels the job on the backend encoded in the upstream ID, i.e., "{platform}:{id}".
+func (service *Failover) Cancel(request *CancelRequest) *RequestError {
+	name, upstreamID, found := strings.Cut(request.UpstreamID, ":")
+	if found {
+		for i, backend := range service.backends {
+			if service.names[i] == name {
+				return backend.Cancel(&CancelRequest{ModelName: request.ModelName, UpstreamID: upstreamID})
+			}
+		}
+	}
+	return NewRequestError(InvalidInputError,
+		fmt.Errorf("invalid upstream id: %s", request.UpstreamID))
+}
+
+// CheckHealth returns an error if none of the backends is healthy.
+func (service *Failover) CheckHealth(ctx context.Context) error {
+	return checkAnyHealthy(ctx, service.names, service.backends)
+}
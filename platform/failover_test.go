@@ -0,0 +1,203 @@
+package platform_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/HyperGAI/serving-agent/platform"
+	mockplatform "github.com/HyperGAI/serving-agent/platform/mock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFailoverPredict(t *testing.T) {
+	testCases := []struct {
+		name          string
+		buildStubs    func(primary *mockplatform.MockPlatform, secondary *mockplatform.MockPlatform)
+		checkResponse func(response *platform.InferResponse, err *platform.RequestError)
+	}{
+		{
+			name: "Primary OK",
+			buildStubs: func(primary *mockplatform.MockPlatform, secondary *mockplatform.MockPlatform) {
+				primary.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Return(&platform.InferResponse{Outputs: map[string]interface{}{"output": 1}}, nil)
+				secondary.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.Nil(t, err)
+				require.Equal(t, "kserve", response.Outputs["served_by"])
+			},
+		},
+		{
+			name: "Primary unavailable",
+			buildStubs: func(primary *mockplatform.MockPlatform, secondary *mockplatform.MockPlatform) {
+				primary.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Return(nil, platform.NewRequestError(platform.UpstreamServerError, errors.New("503")))
+				secondary.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Return(&platform.InferResponse{}, nil)
+			},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.Nil(t, err)
+				require.Equal(t, "replicate", response.Outputs["served_by"])
+			},
+		},
+		{
+			name: "Invalid inputs",
+			buildStubs: func(primary *mockplatform.MockPlatform, secondary *mockplatform.MockPlatform) {
+				primary.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Return(nil, platform.NewRequestError(platform.InvalidInputError, errors.New("400")))
+				secondary.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.NotNil(t, err)
+				require.Equal(t, platform.InvalidInputError, err.StatusCode)
+			},
+		},
+		{
+			name: "Submitted job timed out",
+			buildStubs: func(primary *mockplatform.MockPlatform, secondary *mockplatform.MockPlatform) {
+				primary.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(ctx context.Context, request *platform.InferRequest, version string) (*platform.InferResponse, *platform.RequestError) {
+						request.OnSubmitted("job")
+						return nil, platform.NewRequestError(platform.TimeoutError, errors.New("timeout"))
+					})
+				// The job is canceled so that the request isn't billed twice
+				primary.EXPECT().
+					Cancel(gomock.Eq(&platform.CancelRequest{ModelName: "test", UpstreamID: "job"})).
+					Times(1).
+					Return(nil)
+				secondary.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Return(&platform.InferResponse{}, nil)
+			},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.Nil(t, err)
+				require.Equal(t, "replicate", response.Outputs["served_by"])
+			},
+		},
+		{
+			name: "Submitted job not canceled",
+			buildStubs: func(primary *mockplatform.MockPlatform, secondary *mockplatform.MockPlatform) {
+				primary.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(ctx context.Context, request *platform.InferRequest, version string) (*platform.InferResponse, *platform.RequestError) {
+						request.OnSubmitted("job")
+						return nil, platform.NewRequestError(platform.TimeoutError, errors.New("timeout"))
+					})
+				primary.EXPECT().Cancel(gomock.Any()).Times(1).
+					Return(platform.NewRequestError(platform.SendRequestError, errors.New("failed")))
+				secondary.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.NotNil(t, err)
+				require.Equal(t, platform.TimeoutError, err.StatusCode)
+			},
+		},
+		{
+			name: "All unavailable",
+			buildStubs: func(primary *mockplatform.MockPlatform, secondary *mockplatform.MockPlatform) {
+				primary.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Return(nil, platform.NewRequestError(platform.SendRequestError, errors.New("failed")))
+				secondary.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Return(nil, platform.NewRequestError(platform.TimeoutError, errors.New("timeout")))
+			},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.NotNil(t, err)
+				require.Equal(t, platform.TimeoutError, err.StatusCode)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			primary := mockplatform.NewMockPlatform(ctrl)
+			secondary := mockplatform.NewMockPlatform(ctrl)
+			tc.buildStubs(primary, secondary)
+
+			service := platform.NewFailoverFromBackends(
+				[]string{"kserve", "replicate"}, []platform.Platform{primary, secondary})
+			request := &platform.InferRequest{ModelName: "test", Inputs: map[string]interface{}{}}
+			response, err := service.Predict(context.Background(), request, "v1")
+			tc.checkResponse(response, err)
+		})
+	}
+}
+
+func TestFailoverGenerate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := mockplatform.NewMockPlatform(ctrl)
+	secondary := mockplatform.NewMockPlatform(ctrl)
+	primary.EXPECT().Generate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+		Return(platform.NewRequestError(platform.SendRequestError, errors.New("failed")))
+	secondary.EXPECT().Generate(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+		DoAndReturn(func(request *platform.InferRequest, version string, ctx context.Context,
+			encoder *json.Encoder, flusher http.Flusher) *platform.RequestError {
+			require.NoError(t, encoder.Encode(platform.StreamingMessage{Id: 0, Data: "Hello"}))
+			flusher.Flush()
+			return nil
+		})
+
+	service := platform.NewFailoverFromBackends(
+		[]string{"kserve", "replicate"}, []platform.Platform{primary, secondary})
+	recorder := httptest.NewRecorder()
+	request := &platform.InferRequest{ModelName: "test", Inputs: map[string]interface{}{}}
+	err := service.Generate(request, "v1", context.Background(), json.NewEncoder(recorder), recorder)
+	require.Nil(t, err)
+
+	// The backend serving the stream is sent as the last message
+	decoder := json.NewDecoder(strings.NewReader(recorder.Body.String()))
+	var messages []platform.StreamingMessage
+	for decoder.More() {
+		var m platform.StreamingMessage
+		require.NoError(t, decoder.Decode(&m))
+		messages = append(messages, m)
+	}
+	require.Equal(t, []platform.StreamingMessage{
+		{Id: 0, Data: "Hello"},
+		{Id: 1, Event: "served_by", Data: "replicate"},
+	}, messages)
+}
+
+func TestFailoverCancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	primary := mockplatform.NewMockPlatform(ctrl)
+	secondary := mockplatform.NewMockPlatform(ctrl)
+	primary.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+		Return(nil, platform.NewRequestError(platform.TimeoutError, errors.New("timeout")))
+	secondary.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+		DoAndReturn(func(ctx context.Context, request *platform.InferRequest, version string) (*platform.InferResponse, *platform.RequestError) {
+			request.OnSubmitted("job")
+			return &platform.InferResponse{}, nil
+		})
+	secondary.EXPECT().
+		Cancel(gomock.Eq(&platform.CancelRequest{ModelName: "test", UpstreamID: "job"})).
+		Times(1).
+		Return(nil)
+
+	service := platform.NewFailoverFromBackends(
+		[]string{"kserve", "replicate"}, []platform.Platform{primary, secondary})
+	var upstreamID string
+	request := &platform.InferRequest{
+		ModelName:   "test",
+		Inputs:      map[string]interface{}{},
+		OnSubmitted: func(id string) { upstreamID = id },
+	}
+	_, err := service.Predict(context.Background(), request, "v1")
+	require.Nil(t, err)
+	require.Equal(t, "replicate:job", upstreamID)
+	require.Nil(t, service.Cancel(&platform.CancelRequest{ModelName: "test", UpstreamID: upstreamID}))
+
+	err = service.Cancel(&platform.CancelRequest{ModelName: "test", UpstreamID: "job"})
+	require.NotNil(t, err)
+}
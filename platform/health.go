@@ -0,0 +1,72 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HealthChecker is implemented by the platforms that can check whether the backend is able to serve.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// CheckHealth checks the platform if it implements HealthChecker, otherwise the platform is assumed healthy.
+func CheckHealth(ctx context.Context, platform Platform) error {
+	if checker, ok := platform.(HealthChecker); ok {
+		return checker.CheckHealth(ctx)
+	}
+	return nil
+}
+
+// probe sends the health check request without retries and returns the status code and the body.
+// The error is only returned if the request cannot be sent.
+func probe(transport http.RoundTripper, req *http.Request) (int, []byte, error) {
+	client := http.Client{Transport: transport, Timeout: 10 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<16))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return res.StatusCode, body, nil
+}
+
+// probeOK checks that the GET request to the url returns 200.
+func probeOK(ctx context.Context, transport http.RoundTripper, url string, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	status, body, err := probe(transport, req)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("url: %s, status-code: %d, error: %s", url, status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// checkAnyHealthy returns nil if any of the backends is healthy, otherwise the errors of all the backends.
+func checkAnyHealthy(ctx context.Context, names []string, backends []Platform) error {
+	errs := make([]error, 0, len(backends))
+	for i, backend := range backends {
+		err := CheckHealth(ctx, backend)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", names[i], err))
+	}
+	return errors.Join(errs...)
+}
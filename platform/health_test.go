@@ -0,0 +1,111 @@
+package platform_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/platform"
+	mockplatform "github.com/HyperGAI/serving-agent/platform/mock"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestKServeCheckHealth(t *testing.T) {
+	testCases := []struct {
+		name      string
+		modelName string
+		response  string
+		status    int
+		checkErr  func(err error)
+	}{
+		{
+			name:      "Ready",
+			modelName: "test_model",
+			response:  `{"name": "test_model", "ready": true}`,
+			status:    http.StatusOK,
+			checkErr: func(err error) {
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:      "Not ready",
+			modelName: "test_model",
+			response:  `{"name": "test_model", "ready": false}`,
+			status:    http.StatusOK,
+			checkErr: func(err error) {
+				require.ErrorContains(t, err, "model is not ready")
+			},
+		},
+		{
+			name:      "Not found",
+			modelName: "test_model",
+			status:    http.StatusNotFound,
+			checkErr: func(err error) {
+				require.ErrorContains(t, err, "status-code: 404")
+			},
+		},
+		{
+			name:   "Model name not set",
+			status: http.StatusInternalServerError,
+			checkErr: func(err error) {
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "/v1/models/"+tc.modelName, r.URL.Path)
+				require.Equal(t, tc.modelName+".default.example.com", r.Host)
+				w.WriteHeader(tc.status)
+				_, _ = fmt.Fprint(w, tc.response)
+			}))
+			defer server.Close()
+
+			service := platform.NewKServe(utils.Config{
+				KServeAddress:      strings.TrimPrefix(server.URL, "http://"),
+				KServeNamespace:    "default",
+				KServeCustomDomain: "example.com",
+				ModelName:          tc.modelName,
+			})
+			tc.checkErr(platform.CheckHealth(context.Background(), service))
+		})
+	}
+}
+
+// healthyPlatform is a platform with the given health check result.
+type healthyPlatform struct {
+	*mockplatform.MockPlatform
+	err error
+}
+
+func (p healthyPlatform) CheckHealth(ctx context.Context) error {
+	return p.err
+}
+
+func TestFailoverCheckHealth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	down := healthyPlatform{mockplatform.NewMockPlatform(ctrl), errors.New("down")}
+	up := healthyPlatform{mockplatform.NewMockPlatform(ctrl), nil}
+
+	failover := platform.NewFailoverFromBackends([]string{"kserve", "replicate"}, []platform.Platform{down, up})
+	require.NoError(t, platform.CheckHealth(context.Background(), failover))
+
+	failover = platform.NewFailoverFromBackends([]string{"kserve", "replicate"}, []platform.Platform{down, down})
+	err := platform.CheckHealth(context.Background(), failover)
+	require.ErrorContains(t, err, "kserve: down")
+	require.ErrorContains(t, err, "replicate: down")
+
+	// The platforms without health checks are assumed healthy
+	require.NoError(t, platform.CheckHealth(context.Background(), mockplatform.NewMockPlatform(ctrl)))
+}
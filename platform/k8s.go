@@ -14,36 +14,47 @@ import (
 )
 
 type K8sPlugin struct {
-	address string
-	timeout int
+	address   string
+	timeout   int
+	retry     *RetryPolicy
+	transport http.RoundTripper
 }
 
 func NewK8sPlugin(config utils.Config) Platform {
 	return &K8sPlugin{
 		address: config.K8sPluginAddress,
 		timeout: config.K8sPluginRequestTimeout,
+		retry: NewRetryPolicy("k8s-plugin",
+			config.K8sPluginRetryAttempts, config.K8sPluginRetryBackoff, config).Idempotent(),
+		transport: SharedTransport(config),
 	}
 }
 
 func (service *K8sPlugin) sendRequest(
+	ctx context.Context,
 	method string,
 	url string,
 	body io.Reader,
 	timeout time.Duration,
 ) (*http.Response, *RequestError) {
 	// Build a new prediction request
-	req, err := http.NewRequest(method, url, body)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, NewRequestError(BuildRequestError,
 			errors.New("failed to build request"))
 	}
 	req.Header.Set("Content-Type", "application/json")
+	setRequestTimeout(ctx, req)
 
 	// Send the prediction request
-	client := http.Client{Timeout: timeout}
-	res, err := client.Do(req)
+	client := http.Client{Transport: service.transport, Timeout: timeout}
+	res, err := service.retry.Do(&client, req)
 	if err != nil {
-		return nil, NewRequestError(SendRequestError,
+		if ctx.Err() != nil {
+			return nil, NewRequestError(contextErrorCode(ctx),
+				fmt.Errorf("url: %s, request aborted: %v", url, ctx.Err()))
+		}
+		return nil, NewRequestError(sendErrorCode(err),
 			fmt.Errorf("url: %s, failed to send request, model not ready", url))
 	}
 	if res.StatusCode != 200 {
@@ -55,16 +66,20 @@ func (service *K8sPlugin) sendRequest(
 			log.Error().Msgf("url: %s, failed to read error message: %v", url, e)
 		}
 		res.Body.Close()
-		return nil, NewRequestError(InvalidInputError,
+		return nil, NewUpstreamError(res,
 			fmt.Errorf("url: %s, status-code: %d, invalid inputs: %v",
 				url, res.StatusCode, errorMessage))
 	}
 	return res, nil
 }
 
-func (service *K8sPlugin) Predict(request *InferRequest, version string) (*InferResponse, *RequestError) {
+func (service *K8sPlugin) Predict(
+	ctx context.Context,
+	request *InferRequest,
+	version string,
+) (*InferResponse, *RequestError) {
 	if version == "v1" {
-		return service.predictV1(request)
+		return service.predictV1(ctx, request)
 	}
 	return nil, NewRequestError(UnknownAPIVersion,
 		errors.New("prediction API version is not supported"))
@@ -81,7 +96,7 @@ func (service *K8sPlugin) Generate(
 		errors.New("generation API for k8s is not supported"))
 }
 
-func (service *K8sPlugin) predictV1(request *InferRequest) (*InferResponse, *RequestError) {
+func (service *K8sPlugin) predictV1(ctx context.Context, request *InferRequest) (*InferResponse, *RequestError) {
 	// Marshal the input data
 	data, err := json.Marshal(request)
 	if err != nil {
@@ -91,7 +106,7 @@ func (service *K8sPlugin) predictV1(request *InferRequest) (*InferResponse, *Req
 	// Send a new prediction request
 	url := fmt.Sprintf("http://%s/v1/predict", service.address)
 	res, e := service.sendRequest(
-		"POST", url, bytes.NewReader(data),
+		ctx, "POST", url, bytes.NewReader(data),
 		time.Duration(service.timeout)*time.Second,
 	)
 	if e != nil {
@@ -115,14 +130,15 @@ func (service *K8sPlugin) predictV1(request *InferRequest) (*InferResponse, *Req
 	return &response, nil
 }
 
-func (service *K8sPlugin) Docs(request *DocsRequest) (interface{}, *RequestError) {
+// Docs returns the model schema converted from the document served by `/v1/docs`.
+func (service *K8sPlugin) Docs(request *DocsRequest) (*ModelSchema, *RequestError) {
 	data, err := json.Marshal(request)
 	if err != nil {
 		return nil, NewRequestError(MarshalError,
 			errors.New("failed to marshal request"))
 	}
 	url := fmt.Sprintf("http://%s/v1/docs", service.address)
-	res, e := service.sendRequest("GET", url, bytes.NewReader(data), 10*time.Second)
+	res, e := service.sendRequest(context.Background(), "GET", url, bytes.NewReader(data), 10*time.Second)
 	if e != nil {
 		return nil, e
 	}
@@ -139,5 +155,27 @@ func (service *K8sPlugin) Docs(request *DocsRequest) (interface{}, *RequestError
 		return nil, NewRequestError(UnmarshalResponseError,
 			errors.New("failed to unmarshal response body"))
 	}
-	return outputs, nil
+	return newModelSchema(request.ModelName, "k8s-plugin", outputs), nil
+}
+
+// CheckHealth checks if the plugin server is up via `/health`. 404 is accepted for the servers
+// without the endpoint, since they are reachable anyway.
+func (service *K8sPlugin) CheckHealth(ctx context.Context) error {
+	url := fmt.Sprintf("http://%s/health", service.address)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	status, _, err := probe(service.transport, req)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusNotFound {
+		return fmt.Errorf("url: %s, status-code: %d", url, status)
+	}
+	return nil
+}
+
+func (service *K8sPlugin) Cancel(request *CancelRequest) *RequestError {
+	return cancelNotSupported()
 }
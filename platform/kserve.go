@@ -10,6 +10,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -19,6 +20,10 @@ type KServe struct {
 	customDomain string
 	namespace    string
 	timeout      int
+	modelName    string
+	retry        *RetryPolicy
+	transport    http.RoundTripper
+	metadata     sync.Map
 }
 
 func NewKServe(config utils.Config) Platform {
@@ -28,62 +33,57 @@ func NewKServe(config utils.Config) Platform {
 		customDomain: config.KServeCustomDomain,
 		namespace:    config.KServeNamespace,
 		timeout:      config.KServeRequestTimeout,
+		modelName:    config.ModelName,
+		retry: NewRetryPolicy("kserve",
+			config.KServeRetryAttempts, config.KServeRetryBackoff, config).Idempotent(),
+		transport: SharedTransport(config),
 	}
 }
 
 func (service *KServe) sendRequest(
+	ctx context.Context,
 	modelName string,
 	method string,
 	url string,
 	data []byte,
 	timeout time.Duration,
 ) (*http.Response, *RequestError) {
-	numRetries := 5
-	for i := 0; i < numRetries; i++ {
-		// Build a new prediction request
-		req, err := http.NewRequest(method, url, bytes.NewReader(data))
-		if err != nil {
-			return nil, NewRequestError(BuildRequestError,
-				errors.New("failed to build request"))
-		}
-		req.Header.Set("Content-Type", "application/json")
-		req.Host = fmt.Sprintf("%s.%s.%s",
-			modelName, service.namespace, service.customDomain)
+	// Build a new prediction request
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, NewRequestError(BuildRequestError,
+			errors.New("failed to build request"))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Host = fmt.Sprintf("%s.%s.%s",
+		modelName, service.namespace, service.customDomain)
+	setRequestTimeout(ctx, req)
 
-		// Send the prediction request
-		client := http.Client{Timeout: timeout}
-		res, err := client.Do(req)
-		if err != nil {
-			if i < numRetries-1 {
-				log.Warn().Msgf("model-name: %s, failed to send request: %v, retry: %d", modelName, err, i+1)
-				time.Sleep(time.Duration((i+1)*2) * time.Second)
-				continue
-			}
-			return nil, NewRequestError(SendRequestError,
-				fmt.Errorf("model-name: %s, failed to send request: %v", modelName, err))
+	// Send the prediction request
+	client := http.Client{Transport: service.transport, Timeout: timeout}
+	res, err := service.retry.Do(&client, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, NewRequestError(contextErrorCode(ctx),
+				fmt.Errorf("model-name: %s, request aborted: %v", modelName, ctx.Err()))
 		}
-		if res.StatusCode != 200 {
-			if (res.StatusCode >= 502 && res.StatusCode <= 504) && i < numRetries-1 {
-				res.Body.Close()
-				log.Warn().Msgf("model-name: %s, status-code: %d, retry: %d", modelName, res.StatusCode, i+1)
-				time.Sleep(time.Duration((i+1)*2) * time.Second)
-				continue
-			}
-			var errorMessage interface{}
-			data, e := io.ReadAll(res.Body)
-			if e == nil {
-				_ = json.Unmarshal(data, &errorMessage)
-			} else {
-				log.Error().Msgf("model-name: %s, failed to read error message: %v", modelName, e)
-			}
-			res.Body.Close()
-			return nil, NewRequestError(InvalidInputError,
-				fmt.Errorf("model-name: %s, status-code: %d, error: %v, retries: %d",
-					modelName, res.StatusCode, errorMessage, i))
+		return nil, NewRequestError(sendErrorCode(err),
+			fmt.Errorf("model-name: %s, failed to send request: %v", modelName, err))
+	}
+	if res.StatusCode != 200 {
+		var errorMessage interface{}
+		data, e := io.ReadAll(res.Body)
+		if e == nil {
+			_ = json.Unmarshal(data, &errorMessage)
+		} else {
+			log.Error().Msgf("model-name: %s, failed to read error message: %v", modelName, e)
 		}
-		return res, nil
+		res.Body.Close()
+		return nil, NewUpstreamError(res,
+			fmt.Errorf("model-name: %s, status-code: %d, error: %v",
+				modelName, res.StatusCode, errorMessage))
 	}
-	return nil, NewRequestError(InternalError, fmt.Errorf("shouldn't be here"))
+	return res, nil
 }
 
 func (service *KServe) sendStreamingRequest(
@@ -96,8 +96,8 @@ func (service *KServe) sendStreamingRequest(
 	flusher http.Flusher,
 	timeout time.Duration,
 ) *RequestError {
-	// TODO: Retires
-	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	// Only the connection establishment is retried, not the streaming itself
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
 	if err != nil {
 		return NewRequestError(BuildRequestError,
 			errors.New("failed to build request"))
@@ -105,17 +105,24 @@ func (service *KServe) sendStreamingRequest(
 	req.Header.Set("Content-Type", "application/json")
 	req.Host = fmt.Sprintf("%s.%s.%s",
 		modelName, service.namespace, service.customDomain)
+	setRequestTimeout(ctx, req)
 
-	client := http.Client{Timeout: timeout}
-	res, err := client.Do(req)
+	client := http.Client{Transport: service.transport, Timeout: timeout}
+	res, err := service.retry.Do(&client, req)
 	if err != nil {
-		return NewRequestError(SendRequestError,
+		if ctx.Err() != nil {
+			log.Info().Msgf("client stopped listening")
+			return NewRequestError(SendRequestError,
+				fmt.Errorf("model-name: %s, client stopped listening", modelName))
+		}
+		return NewRequestError(sendErrorCode(err),
 			fmt.Errorf("model-name: %s, failed to send request: %v", modelName, err))
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		return NewRequestError(InvalidInputError,
+		drainBody(res)
+		return NewUpstreamError(res,
 			fmt.Errorf("model-name: %s, status-code: %d", modelName, res.StatusCode))
 	}
 	decoder := json.NewDecoder(res.Body)
@@ -144,9 +151,15 @@ func (service *KServe) sendStreamingRequest(
 	}
 }
 
-func (service *KServe) Predict(request *InferRequest, version string) (*InferResponse, *RequestError) {
+func (service *KServe) Predict(
+	ctx context.Context,
+	request *InferRequest,
+	version string,
+) (*InferResponse, *RequestError) {
 	if version == "v1" {
-		return service.predictV1(request)
+		return service.predictV1(ctx, request)
+	} else if version == "v2" {
+		return service.predictV2(ctx, request)
 	}
 	return nil, NewRequestError(UnknownAPIVersion,
 		errors.New("prediction API version is not supported"))
@@ -166,7 +179,7 @@ func (service *KServe) Generate(
 		errors.New("generation API version is not supported"))
 }
 
-func (service *KServe) predictV1(request *InferRequest) (*InferResponse, *RequestError) {
+func (service *KServe) predictV1(ctx context.Context, request *InferRequest) (*InferResponse, *RequestError) {
 	modelName := request.ModelName
 	inputs := request.Inputs
 
@@ -179,7 +192,7 @@ func (service *KServe) predictV1(request *InferRequest) (*InferResponse, *Reques
 	// Send a new prediction request
 	url := fmt.Sprintf("http://%s/v1/models/%s:predict", service.address, modelName)
 	res, e := service.sendRequest(
-		modelName, "POST", url, data,
+		ctx, modelName, "POST", url, data,
 		time.Duration(service.timeout)*time.Second,
 	)
 	if e != nil {
@@ -237,10 +250,11 @@ func (service *KServe) generateV1(
 	)
 }
 
-func (service *KServe) Docs(request *DocsRequest) (interface{}, *RequestError) {
+// Docs returns the model schema converted from the document served by `/v1/docs`.
+func (service *KServe) Docs(request *DocsRequest) (*ModelSchema, *RequestError) {
 	modelName := request.ModelName
 	url := fmt.Sprintf("http://%s/v1/docs/%s", service.address, modelName)
-	res, e := service.sendRequest(modelName, "GET", url, nil, 10*time.Second)
+	res, e := service.sendRequest(context.Background(), modelName, "GET", url, nil, 10*time.Second)
 	if e != nil {
 		return nil, e
 	}
@@ -257,5 +271,40 @@ func (service *KServe) Docs(request *DocsRequest) (interface{}, *RequestError) {
 		return nil, NewRequestError(UnmarshalResponseError,
 			errors.New("failed to unmarshal response body"))
 	}
-	return outputs, nil
+	return newModelSchema(request.ModelName, "kserve", outputs), nil
+}
+
+// CheckHealth checks if the model `MODEL_NAME` is ready via `/v1/models/{name}`.
+// The check is skipped if `MODEL_NAME` is not set.
+func (service *KServe) CheckHealth(ctx context.Context) error {
+	if service.modelName == "" {
+		return nil
+	}
+	url := fmt.Sprintf("http://%s/v1/models/%s", service.address, service.modelName)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Host = fmt.Sprintf("%s.%s.%s",
+		service.modelName, service.namespace, service.customDomain)
+	status, body, err := probe(service.transport, req)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("model-name: %s, status-code: %d", service.modelName, status)
+	}
+	var outputs struct {
+		Ready *bool `json:"ready"`
+	}
+	if err := json.Unmarshal(body, &outputs); err == nil && outputs.Ready != nil && !*outputs.Ready {
+		return fmt.Errorf("model-name: %s, model is not ready", service.modelName)
+	}
+	return nil
+}
+
+// Cancel is not supported since a prediction is a synchronous request without an upstream job.
+// The request stops when the task times out or the client disconnects.
+func (service *KServe) Cancel(request *CancelRequest) *RequestError {
+	return cancelNotSupported()
 }
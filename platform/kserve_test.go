@@ -0,0 +1,199 @@
+package platform_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBuildInferRequestV2(t *testing.T) {
+	metadata := &platform.ModelMetadataV2{
+		Inputs: []platform.TensorMetadata{{Name: "input_0", Datatype: "FP16", Shape: []int{-1, 2}}},
+	}
+	testCases := []struct {
+		name          string
+		inputs        string
+		checkResponse func(request *platform.InferRequestV2, err error)
+	}{
+		{
+			name:   "Infer shape and datatype",
+			inputs: `{"input_0": [[1, 2], [3, 4]], "input_1": [1, 2, 3], "input_2": "text", "upload_webhook": "url"}`,
+			checkResponse: func(request *platform.InferRequestV2, err error) {
+				require.NoError(t, err)
+				require.Len(t, request.Inputs, 3)
+				require.Equal(t, "FP16", request.Inputs[0].Datatype)
+				require.Equal(t, []int{2, 2}, request.Inputs[0].Shape)
+				require.Equal(t, []interface{}{1.0, 2.0, 3.0, 4.0}, request.Inputs[0].Data)
+				require.Equal(t, "INT64", request.Inputs[1].Datatype)
+				require.Equal(t, []int{3}, request.Inputs[1].Shape)
+				require.Equal(t, "BYTES", request.Inputs[2].Datatype)
+				require.Equal(t, []int{1}, request.Inputs[2].Shape)
+				require.Equal(t, "url", request.Parameters["upload_webhook"])
+			},
+		},
+		{
+			name:   "Explicit tensor",
+			inputs: `{"input_1": {"data": [0.5, 1, 2, 3], "datatype": "FP64", "shape": [2, 2]}}`,
+			checkResponse: func(request *platform.InferRequestV2, err error) {
+				require.NoError(t, err)
+				require.Equal(t, "FP64", request.Inputs[0].Datatype)
+				require.Equal(t, []int{2, 2}, request.Inputs[0].Shape)
+			},
+		},
+		{
+			name:   "Tensor list",
+			inputs: `{"inputs": [{"name": "x", "datatype": "FP32", "shape": [1], "data": [0.5]}]}`,
+			checkResponse: func(request *platform.InferRequestV2, err error) {
+				require.NoError(t, err)
+				require.Len(t, request.Inputs, 1)
+				require.Equal(t, "x", request.Inputs[0].Name)
+			},
+		},
+		{
+			name:   "Ragged lists",
+			inputs: `{"input_1": [[1, 2], [3]]}`,
+			checkResponse: func(request *platform.InferRequestV2, err error) {
+				require.Error(t, err)
+			},
+		},
+		{
+			name:   "Mixed datatypes",
+			inputs: `{"input_1": [1, "a"]}`,
+			checkResponse: func(request *platform.InferRequestV2, err error) {
+				require.Error(t, err)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			var inputs map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(tc.inputs), &inputs))
+			request, err := platform.BuildInferRequestV2(inputs, metadata)
+			tc.checkResponse(request, err)
+		})
+	}
+}
+
+func TestKServePredictV2(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/ready"):
+			w.WriteHeader(http.StatusOK)
+		case strings.HasSuffix(r.URL.Path, "/infer"):
+			var request platform.InferRequestV2
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+			require.Equal(t, "INPUT0", request.Inputs[0].Name)
+			require.Equal(t, "FP32", request.Inputs[0].Datatype)
+			_, _ = fmt.Fprint(w, `{"model_name": "test_model", "outputs": [
+				{"name": "OUTPUT0", "datatype": "FP32", "shape": [2, 2], "data": [1, 2, 3, 4]}]}`)
+		default:
+			_, _ = fmt.Fprint(w, `{"name": "test_model", "inputs": [
+				{"name": "INPUT0", "datatype": "FP32", "shape": [-1, 2]}]}`)
+		}
+	}))
+	defer server.Close()
+
+	service := platform.NewKServe(utils.Config{
+		KServeAddress:        strings.TrimPrefix(server.URL, "http://"),
+		KServeRequestTimeout: 10,
+	})
+	request := &platform.InferRequest{
+		ModelName: "test_model",
+		Inputs:    map[string]interface{}{"INPUT0": []interface{}{[]interface{}{1.0, 2.0}}},
+	}
+	response, err := service.Predict(context.Background(), request, "v2")
+	require.Nil(t, err)
+	require.Equal(t, []interface{}{
+		[]interface{}{1.0, 2.0},
+		[]interface{}{3.0, 4.0},
+	}, response.Outputs["OUTPUT0"])
+
+	_, err = service.Predict(context.Background(), request, "v3")
+	require.NotNil(t, err)
+	require.Equal(t, platform.UnknownAPIVersion, err.StatusCode)
+}
+
+func TestKServePredictRetry(t *testing.T) {
+	var numRequests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The model server is restarting in the first attempt
+		if atomic.AddInt32(&numRequests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"predictions": [1]}`)
+	}))
+	defer server.Close()
+
+	service := platform.NewKServe(utils.Config{
+		KServeAddress:        strings.TrimPrefix(server.URL, "http://"),
+		KServeRequestTimeout: 10,
+		KServeRetryAttempts:  3,
+		KServeRetryBackoff:   0.01,
+	})
+	request := &platform.InferRequest{ModelName: "test_model", Inputs: map[string]interface{}{}}
+	response, err := service.Predict(context.Background(), request, "v1")
+	require.Nil(t, err)
+	require.Equal(t, []interface{}{1.0}, response.Outputs["predictions"])
+	require.Equal(t, int32(2), atomic.LoadInt32(&numRequests))
+}
+
+func TestKServeCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"predictions": [1]}`)
+	}))
+	defer server.Close()
+
+	service := platform.NewKServe(utils.Config{
+		KServeAddress:        strings.TrimPrefix(server.URL, "http://"),
+		KServeRequestTimeout: 10,
+	})
+	// No upstream ID is reported since there is no job which can be canceled from another agent
+	request := &platform.InferRequest{
+		ModelName: "test_model",
+		Inputs:    map[string]interface{}{},
+		OnSubmitted: func(upstreamID string) {
+			require.Fail(t, "unexpected upstream ID", upstreamID)
+		},
+	}
+	_, err := service.Predict(context.Background(), request, "v1")
+	require.Nil(t, err)
+
+	err = service.Cancel(&platform.CancelRequest{ModelName: "test_model", UpstreamID: "abc"})
+	require.NotNil(t, err)
+	require.Equal(t, platform.UnsupportedError, err.StatusCode)
+}
+
+func TestKServePredictDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The remaining budget is forwarded to the model server
+		require.NotEmpty(t, r.Header.Get(platform.RequestTimeoutHeader))
+		_, _ = io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	service := platform.NewKServe(utils.Config{
+		KServeAddress:        strings.TrimPrefix(server.URL, "http://"),
+		KServeRequestTimeout: 10,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	request := &platform.InferRequest{ModelName: "test_model", Inputs: map[string]interface{}{}}
+	_, err := service.Predict(ctx, request, "v1")
+	require.NotNil(t, err)
+	require.Equal(t, platform.TimeoutError, err.StatusCode)
+}
@@ -0,0 +1,370 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// The Open Inference Protocol (V2), see
+// https://kserve.github.io/website/latest/modelserving/data_plane/v2_protocol
+
+type InferTensor struct {
+	Name       string                 `json:"name"`
+	Datatype   string                 `json:"datatype"`
+	Shape      []int                  `json:"shape"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Data       interface{}            `json:"data"`
+}
+
+type TensorMetadata struct {
+	Name     string `json:"name"`
+	Datatype string `json:"datatype"`
+	Shape    []int  `json:"shape"`
+}
+
+type ModelMetadataV2 struct {
+	Name     string           `json:"name"`
+	Versions []string         `json:"versions"`
+	Platform string           `json:"platform"`
+	Inputs   []TensorMetadata `json:"inputs"`
+	Outputs  []TensorMetadata `json:"outputs"`
+}
+
+type InferRequestV2 struct {
+	ID         string                 `json:"id,omitempty"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	Inputs     []InferTensor          `json:"inputs"`
+}
+
+type InferResponseV2 struct {
+	ID           string                 `json:"id"`
+	ModelName    string                 `json:"model_name"`
+	ModelVersion string                 `json:"model_version"`
+	Parameters   map[string]interface{} `json:"parameters"`
+	Outputs      []InferTensor          `json:"outputs"`
+}
+
+func (service *KServe) predictV2(ctx context.Context, request *InferRequest) (*InferResponse, *RequestError) {
+	modelName := request.ModelName
+	metadata, e := service.getMetadataV2(ctx, modelName)
+	if e != nil {
+		return nil, e
+	}
+	body, err := BuildInferRequestV2(request.Inputs, metadata)
+	if err != nil {
+		return nil, NewRequestError(InvalidInputError,
+			fmt.Errorf("model-name: %s, %v", modelName, err))
+	}
+
+	// Marshal the input data
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, NewRequestError(MarshalError,
+			errors.New("failed to marshal request"))
+	}
+	// Send a new prediction request
+	url := fmt.Sprintf("http://%s/v2/models/%s/infer", service.address, modelName)
+	startTime := time.Now()
+	res, e := service.sendRequest(
+		ctx, modelName, "POST", url, data,
+		time.Duration(service.timeout)*time.Second,
+	)
+	if e != nil {
+		// The model may be redeployed with a different signature
+		service.metadata.Delete(modelName)
+		return nil, e
+	}
+
+	// Parse the response
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, NewRequestError(ReadResponseError,
+			errors.New("failed to read response body"))
+	}
+	var outputs InferResponseV2
+	err = json.Unmarshal(resBody, &outputs)
+	if err != nil {
+		return nil, NewRequestError(UnmarshalResponseError,
+			errors.New("failed to unmarshal response body"))
+	}
+	response := InferResponse{Outputs: TensorsToOutputs(outputs.Outputs)}
+	response.Outputs["running_time"] = fmt.Sprintf("%fs", time.Since(startTime).Seconds())
+	return &response, nil
+}
+
+// getMetadataV2 checks if the model is ready and returns the model metadata.
+// The metadata is cached until a prediction request fails.
+func (service *KServe) getMetadataV2(ctx context.Context, modelName string) (*ModelMetadataV2, *RequestError) {
+	if metadata, ok := service.metadata.Load(modelName); ok {
+		return metadata.(*ModelMetadataV2), nil
+	}
+
+	url := fmt.Sprintf("http://%s/v2/models/%s/ready", service.address, modelName)
+	res, e := service.sendRequest(ctx, modelName, "GET", url, nil, 10*time.Second)
+	if e != nil {
+		if ctx.Err() != nil {
+			return nil, e
+		}
+		return nil, NewRequestError(SendRequestError,
+			fmt.Errorf("model-name: %s, model not ready: %v", modelName, e.Err))
+	}
+	res.Body.Close()
+
+	url = fmt.Sprintf("http://%s/v2/models/%s", service.address, modelName)
+	res, e = service.sendRequest(ctx, modelName, "GET", url, nil, 10*time.Second)
+	if e != nil {
+		return nil, e
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, NewRequestError(ReadResponseError,
+			errors.New("failed to read response body"))
+	}
+	var metadata ModelMetadataV2
+	err = json.Unmarshal(body, &metadata)
+	if err != nil {
+		return nil, NewRequestError(UnmarshalResponseError,
+			errors.New("failed to unmarshal model metadata"))
+	}
+	service.metadata.Store(modelName, &metadata)
+	return &metadata, nil
+}
+
+// BuildInferRequestV2 converts the free-form inputs into a V2 inference request:
+//  1. If `inputs` is already a list of tensors, the inputs are sent as they are.
+//  2. If an input is an object with `data` (and optional `datatype` and `shape`), it is used as the tensor.
+//  3. Otherwise, the shape is inferred from the nested lists and the datatype is taken from the
+//     model metadata or inferred from the values.
+//
+// `upload_webhook` is passed as a request parameter instead of a tensor.
+func BuildInferRequestV2(inputs map[string]interface{}, metadata *ModelMetadataV2) (*InferRequestV2, error) {
+	request := InferRequestV2{}
+	if webhook, ok := inputs["upload_webhook"]; ok {
+		request.Parameters = map[string]interface{}{"upload_webhook": webhook}
+	}
+	if tensors, ok := inputs["inputs"].([]interface{}); ok && isTensorList(tensors) {
+		data, err := json.Marshal(tensors)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tensors: %v", err)
+		}
+		if err := json.Unmarshal(data, &request.Inputs); err != nil {
+			return nil, fmt.Errorf("invalid tensors: %v", err)
+		}
+		if parameters, ok := inputs["parameters"].(map[string]interface{}); ok {
+			if request.Parameters == nil {
+				request.Parameters = map[string]interface{}{}
+			}
+			for key, value := range parameters {
+				request.Parameters[key] = value
+			}
+		}
+		return &request, nil
+	}
+
+	datatypes := make(map[string]string)
+	if metadata != nil {
+		for _, input := range metadata.Inputs {
+			datatypes[input.Name] = input.Datatype
+		}
+	}
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		if name != "upload_webhook" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		tensor, err := buildTensor(name, inputs[name], datatypes[name])
+		if err != nil {
+			return nil, err
+		}
+		request.Inputs = append(request.Inputs, *tensor)
+	}
+	return &request, nil
+}
+
+func isTensorList(values []interface{}) bool {
+	if len(values) == 0 {
+		return false
+	}
+	for i := range values {
+		tensor, ok := values[i].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := tensor["name"]; !ok {
+			return false
+		}
+		if _, ok := tensor["datatype"]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func buildTensor(name string, value interface{}, datatype string) (*InferTensor, error) {
+	if object, ok := value.(map[string]interface{}); ok {
+		data, ok := object["data"]
+		if !ok {
+			return nil, fmt.Errorf("input %s: object inputs must contain `data`", name)
+		}
+		if t, ok := object["datatype"].(string); ok {
+			datatype = t
+		}
+		tensor, err := buildTensor(name, data, datatype)
+		if err != nil {
+			return nil, err
+		}
+		if shape, ok := object["shape"].([]interface{}); ok {
+			tensor.Shape = make([]int, len(shape))
+			for i := range shape {
+				dim, ok := shape[i].(float64)
+				if !ok {
+					return nil, fmt.Errorf("input %s: invalid shape", name)
+				}
+				tensor.Shape[i] = int(dim)
+			}
+		}
+		return tensor, nil
+	}
+
+	shape, err := inferShape(value)
+	if err != nil {
+		return nil, fmt.Errorf("input %s: %v", name, err)
+	}
+	data := flatten(value, nil)
+	if len(shape) == 0 {
+		shape = []int{1}
+	}
+	if datatype == "" {
+		datatype, err = inferDatatype(data)
+		if err != nil {
+			return nil, fmt.Errorf("input %s: %v", name, err)
+		}
+	}
+	return &InferTensor{Name: name, Datatype: datatype, Shape: shape, Data: data}, nil
+}
+
+// inferShape returns the shape of nested lists, which must not be ragged.
+func inferShape(value interface{}) ([]int, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return []int{}, nil
+	}
+	if len(list) == 0 {
+		return []int{0}, nil
+	}
+	inner, err := inferShape(list[0])
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(list); i++ {
+		s, err := inferShape(list[i])
+		if err != nil {
+			return nil, err
+		}
+		if len(s) != len(inner) {
+			return nil, errors.New("ragged nested lists are not supported")
+		}
+		for j := range s {
+			if s[j] != inner[j] {
+				return nil, errors.New("ragged nested lists are not supported")
+			}
+		}
+	}
+	return append([]int{len(list)}, inner...), nil
+}
+
+func flatten(value interface{}, data []interface{}) []interface{} {
+	list, ok := value.([]interface{})
+	if !ok {
+		return append(data, value)
+	}
+	for i := range list {
+		data = flatten(list[i], data)
+	}
+	return data
+}
+
+func inferDatatype(data []interface{}) (string, error) {
+	if len(data) == 0 {
+		return "FP32", nil
+	}
+	switch data[0].(type) {
+	case bool:
+		for i := range data {
+			if _, ok := data[i].(bool); !ok {
+				return "", errors.New("mixed datatypes are not supported")
+			}
+		}
+		return "BOOL", nil
+	case string:
+		for i := range data {
+			if _, ok := data[i].(string); !ok {
+				return "", errors.New("mixed datatypes are not supported")
+			}
+		}
+		return "BYTES", nil
+	case float64:
+		integral := true
+		for i := range data {
+			v, ok := data[i].(float64)
+			if !ok {
+				return "", errors.New("mixed datatypes are not supported")
+			}
+			if v != math.Trunc(v) {
+				integral = false
+			}
+		}
+		if integral {
+			return "INT64", nil
+		}
+		return "FP32", nil
+	}
+	return "", fmt.Errorf("unsupported datatype %T", data[0])
+}
+
+// TensorsToOutputs converts the output tensors into a map from the tensor names
+// to the nested lists of the tensor data.
+func TensorsToOutputs(tensors []InferTensor) map[string]interface{} {
+	outputs := make(map[string]interface{}, len(tensors))
+	for _, tensor := range tensors {
+		data, ok := tensor.Data.([]interface{})
+		if !ok {
+			outputs[tensor.Name] = tensor.Data
+			continue
+		}
+		size := 1
+		for _, dim := range tensor.Shape {
+			size *= dim
+		}
+		if len(tensor.Shape) == 0 || size != len(data) {
+			outputs[tensor.Name] = data
+			continue
+		}
+		outputs[tensor.Name] = reshape(data, tensor.Shape)
+	}
+	return outputs
+}
+
+func reshape(data []interface{}, shape []int) interface{} {
+	if len(shape) <= 1 || len(data) == 0 {
+		return data
+	}
+	step := len(data) / shape[0]
+	outputs := make([]interface{}, shape[0])
+	for i := 0; i < shape[0]; i++ {
+		outputs[i] = reshape(data[i*step:(i+1)*step], shape[1:])
+	}
+	return outputs
+}
@@ -0,0 +1,64 @@
+package platform
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var failoverRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "failover_requests_total",
+		Help: "Number of requests handled by each backend of the failover platform",
+	},
+	[]string{"platform", "status"},
+)
+
+var circuitBreakerState = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "circuit_breaker_state",
+		Help: "State of the circuit breaker of each platform (0: closed, 1: half-open, 2: open)",
+	},
+	[]string{"platform"},
+)
+
+var platformRetries = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "platform_request_retries_total",
+		Help: "Number of retried requests sent to each platform by reason, i.e., error or status code",
+	},
+	[]string{"platform", "reason"},
+)
+
+var openConnections = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "http_open_connections",
+		Help: "Number of open connections of the shared HTTP transport by host",
+	},
+	[]string{"host"},
+)
+
+var connectionRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "http_connection_requests_total",
+		Help: "Number of requests sent by the shared HTTP transport by host and whether the connection is reused",
+	},
+	[]string{"host", "reused"},
+)
+
+var dynamicBatchSize = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "dynamic_batch_size",
+		Help:    "Number of instances in each backend call coalesced by the dynamic batcher",
+		Buckets: []float64{1, 2, 4, 8, 16, 32, 64, 128},
+	},
+	[]string{"model"},
+)
+
+var dynamicBatchWait = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "dynamic_batch_wait_seconds",
+		Help:    "Time a request waits in the dynamic batcher before the backend call is sent",
+		Buckets: []float64{0.001, 0.002, 0.005, 0.01, 0.02, 0.05, 0.1, 0.2, 0.5},
+	},
+	[]string{"model"},
+)
@@ -37,11 +37,25 @@ func (m *MockPlatform) EXPECT() *MockPlatformMockRecorder {
 	return m.recorder
 }
 
+// Cancel mocks base method.
+func (m *MockPlatform) Cancel(arg0 *platform.CancelRequest) *platform.RequestError {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Cancel", arg0)
+	ret0, _ := ret[0].(*platform.RequestError)
+	return ret0
+}
+
+// Cancel indicates an expected call of Cancel.
+func (mr *MockPlatformMockRecorder) Cancel(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Cancel", reflect.TypeOf((*MockPlatform)(nil).Cancel), arg0)
+}
+
 // Docs mocks base method.
-func (m *MockPlatform) Docs(arg0 *platform.DocsRequest) (interface{}, *platform.RequestError) {
+func (m *MockPlatform) Docs(arg0 *platform.DocsRequest) (*platform.ModelSchema, *platform.RequestError) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Docs", arg0)
-	ret0, _ := ret[0].(interface{})
+	ret0, _ := ret[0].(*platform.ModelSchema)
 	ret1, _ := ret[1].(*platform.RequestError)
 	return ret0, ret1
 }
@@ -67,16 +81,16 @@ func (mr *MockPlatformMockRecorder) Generate(arg0, arg1, arg2, arg3, arg4 interf
 }
 
 // Predict mocks base method.
-func (m *MockPlatform) Predict(arg0 *platform.InferRequest, arg1 string) (*platform.InferResponse, *platform.RequestError) {
+func (m *MockPlatform) Predict(arg0 context.Context, arg1 *platform.InferRequest, arg2 string) (*platform.InferResponse, *platform.RequestError) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Predict", arg0, arg1)
+	ret := m.ctrl.Call(m, "Predict", arg0, arg1, arg2)
 	ret0, _ := ret[0].(*platform.InferResponse)
 	ret1, _ := ret[1].(*platform.RequestError)
 	return ret0, ret1
 }
 
 // Predict indicates an expected call of Predict.
-func (mr *MockPlatformMockRecorder) Predict(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockPlatformMockRecorder) Predict(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Predict", reflect.TypeOf((*MockPlatform)(nil).Predict), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Predict", reflect.TypeOf((*MockPlatform)(nil).Predict), arg0, arg1, arg2)
 }
@@ -5,6 +5,7 @@
 package mockplatform
 
 import (
+	context "context"
 	http "net/http"
 	reflect "reflect"
 	time "time"
@@ -36,6 +37,34 @@ func (m *MockWebhook) EXPECT() *MockWebhookMockRecorder {
 	return m.recorder
 }
 
+// CheckHealth mocks base method.
+func (m *MockWebhook) CheckHealth(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckHealth", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckHealth indicates an expected call of CheckHealth.
+func (mr *MockWebhookMockRecorder) CheckHealth(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckHealth", reflect.TypeOf((*MockWebhook)(nil).CheckHealth), arg0)
+}
+
+// CreateNewBatch mocks base method.
+func (m *MockWebhook) CreateNewBatch(arg0, arg1, arg2 string, arg3 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateNewBatch", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateNewBatch indicates an expected call of CreateNewBatch.
+func (mr *MockWebhookMockRecorder) CreateNewBatch(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateNewBatch", reflect.TypeOf((*MockWebhook)(nil).CreateNewBatch), arg0, arg1, arg2, arg3)
+}
+
 // CreateNewTask mocks base method.
 func (m *MockWebhook) CreateNewTask(arg0, arg1, arg2, arg3 string, arg4 int) (string, error) {
 	m.ctrl.T.Helper()
@@ -51,6 +80,21 @@ func (mr *MockWebhookMockRecorder) CreateNewTask(arg0, arg1, arg2, arg3, arg4 in
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateNewTask", reflect.TypeOf((*MockWebhook)(nil).CreateNewTask), arg0, arg1, arg2, arg3, arg4)
 }
 
+// GetBatchInfo mocks base method.
+func (m *MockWebhook) GetBatchInfo(arg0 string) (*platform.BatchInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBatchInfo", arg0)
+	ret0, _ := ret[0].(*platform.BatchInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBatchInfo indicates an expected call of GetBatchInfo.
+func (mr *MockWebhookMockRecorder) GetBatchInfo(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBatchInfo", reflect.TypeOf((*MockWebhook)(nil).GetBatchInfo), arg0)
+}
+
 // GetTaskIDByModelStatus mocks base method.
 func (m *MockWebhook) GetTaskIDByModelStatus(arg0, arg1 string) ([]string, error) {
 	m.ctrl.T.Helper()
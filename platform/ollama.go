@@ -0,0 +1,306 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Ollama supports the models served locally by Ollama, e.g., small models running on CPUs.
+// https://github.com/ollama/ollama/blob/main/docs/api.md
+type Ollama struct {
+	address   string
+	timeout   int
+	retry     *RetryPolicy
+	transport http.RoundTripper
+}
+
+// ollamaResponse is the response of `/api/generate` or `/api/chat`, or a chunk of the stream.
+type ollamaResponse struct {
+	Model           string         `json:"model"`
+	Response        string         `json:"response"`
+	Message         *openAIMessage `json:"message"`
+	Done            bool           `json:"done"`
+	DoneReason      string         `json:"done_reason"`
+	PromptEvalCount int            `json:"prompt_eval_count"`
+	EvalCount       int            `json:"eval_count"`
+	Error           string         `json:"error"`
+}
+
+func (response *ollamaResponse) content() string {
+	if response.Message != nil {
+		return response.Message.Content
+	}
+	return response.Response
+}
+
+func NewOllama(config utils.Config) Platform {
+	return &Ollama{
+		address: config.OllamaAddress,
+		timeout: config.OllamaRequestTimeout,
+		retry: NewRetryPolicy("ollama",
+			config.OllamaRetryAttempts, config.OllamaRetryBackoff, config).Idempotent(),
+		transport: SharedTransport(config),
+	}
+}
+
+func (service *Ollama) sendRequest(
+	ctx context.Context,
+	method string,
+	url string,
+	data []byte,
+	timeout time.Duration,
+) (*http.Response, *RequestError) {
+	// Build a new prediction request
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, NewRequestError(BuildRequestError,
+			errors.New("failed to build request"))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setRequestTimeout(ctx, req)
+
+	// Send the prediction request
+	client := http.Client{Transport: service.transport, Timeout: timeout}
+	res, err := service.retry.Do(&client, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, NewRequestError(contextErrorCode(ctx),
+				fmt.Errorf("url: %s, request aborted: %v", url, ctx.Err()))
+		}
+		return nil, NewRequestError(sendErrorCode(err),
+			fmt.Errorf("url: %s, failed to send request: %v", url, err))
+	}
+	if res.StatusCode != http.StatusOK {
+		var errorMessage interface{}
+		data, e := io.ReadAll(res.Body)
+		if e == nil {
+			_ = json.Unmarshal(data, &errorMessage)
+		} else {
+			log.Error().Msgf("url: %s, failed to read error message: %v", url, e)
+		}
+		res.Body.Close()
+		// Ollama returns 404 if the model is not pulled, i.e., UnknownModelError
+		return nil, NewUpstreamError(res,
+			fmt.Errorf("url: %s, status-code: %d, error: %v", url, res.StatusCode, errorMessage))
+	}
+	return res, nil
+}
+
+// buildInputs converts the inputs into a chat request if `messages` is set, otherwise a generate request.
+func (service *Ollama) buildInputs(request *InferRequest, stream bool) (string, []byte, *RequestError) {
+	chat, data, e := buildChatInputs(request, stream)
+	if e != nil {
+		return "", nil, e
+	}
+	if chat {
+		return fmt.Sprintf("%s/api/chat", service.address), data, nil
+	}
+	return fmt.Sprintf("%s/api/generate", service.address), data, nil
+}
+
+func (service *Ollama) Predict(
+	ctx context.Context,
+	request *InferRequest,
+	version string,
+) (*InferResponse, *RequestError) {
+	if version == "v1" {
+		return service.predictV1(ctx, request)
+	}
+	return nil, NewRequestError(UnknownAPIVersion,
+		errors.New("prediction API version is not supported"))
+}
+
+func (service *Ollama) Generate(
+	request *InferRequest,
+	version string,
+	ctx context.Context,
+	encoder *json.Encoder,
+	flusher http.Flusher,
+) *RequestError {
+	if version == "v1" {
+		return service.generateV1(request, ctx, encoder, flusher)
+	}
+	return NewRequestError(UnknownAPIVersion,
+		errors.New("generation API version is not supported"))
+}
+
+func (service *Ollama) predictV1(ctx context.Context, request *InferRequest) (*InferResponse, *RequestError) {
+	url, data, e := service.buildInputs(request, false)
+	if e != nil {
+		return nil, e
+	}
+
+	// Send a new prediction request
+	startTime := time.Now()
+	res, e := service.sendRequest(ctx, "POST", url, data, time.Duration(service.timeout)*time.Second)
+	if e != nil {
+		return nil, e
+	}
+
+	// Parse the response
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, NewRequestError(ReadResponseError,
+			errors.New("failed to read response body"))
+	}
+	var outputs ollamaResponse
+	err = json.Unmarshal(body, &outputs)
+	if err != nil {
+		return nil, NewRequestError(UnmarshalResponseError,
+			errors.New("failed to unmarshal response body"))
+	}
+	response := InferResponse{
+		Outputs: map[string]interface{}{
+			"output":        outputs.content(),
+			"finish_reason": outputs.DoneReason,
+			"usage": map[string]int{
+				"prompt_tokens":     outputs.PromptEvalCount,
+				"completion_tokens": outputs.EvalCount,
+				"total_tokens":      outputs.PromptEvalCount + outputs.EvalCount,
+			},
+			"running_time": fmt.Sprintf("%fs", time.Since(startTime).Seconds()),
+		},
+	}
+	return &response, nil
+}
+
+func (service *Ollama) generateV1(
+	request *InferRequest,
+	ctx context.Context,
+	encoder *json.Encoder,
+	flusher http.Flusher,
+) *RequestError {
+	modelName := request.ModelName
+	url, data, e := service.buildInputs(request, true)
+	if e != nil {
+		return e
+	}
+
+	// The request is bound to the context so that it stops when the client disconnects.
+	// The client has no timeout, which would cut off long streams.
+	res, e := service.sendRequest(ctx, "POST", url, data, 0)
+	if e != nil {
+		return e
+	}
+	defer res.Body.Close()
+
+	// The stream is newline-delimited JSON, one chunk per line
+	decoder := json.NewDecoder(res.Body)
+	for id := 0; ; {
+		if ctx.Err() != nil {
+			log.Info().Msgf("client stopped listening")
+			return NewRequestError(SendRequestError,
+				fmt.Errorf("model-name: %s, client stopped listening", modelName))
+		}
+		var chunk ollamaResponse
+		if err := decoder.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			if ctx.Err() != nil {
+				log.Info().Msgf("client stopped listening")
+				return NewRequestError(SendRequestError,
+					fmt.Errorf("model-name: %s, client stopped listening", modelName))
+			}
+			return NewRequestError(SendRequestError,
+				fmt.Errorf("model-name: %s, failed to decode chunk: %v", modelName, err))
+		}
+		if chunk.Error != "" {
+			return NewRequestError(UpstreamServerError,
+				fmt.Errorf("model-name: %s, error: %s", modelName, chunk.Error))
+		}
+		if content := chunk.content(); content != "" {
+			if err := encoder.Encode(StreamingMessage{Id: id, Data: content}); err != nil {
+				return NewRequestError(SendRequestError,
+					fmt.Errorf("model-name: %s, failed to encode chunk: %v", modelName, err))
+			}
+			flusher.Flush()
+			id += 1
+		}
+		if chunk.Done {
+			return nil
+		}
+	}
+}
+
+// Docs returns the schema of the generate and chat APIs, with the model details returned by
+// `/api/show` as the metadata.
+func (service *Ollama) Docs(request *DocsRequest) (*ModelSchema, *RequestError) {
+	data, err := json.Marshal(map[string]string{"model": request.ModelName})
+	if err != nil {
+		return nil, NewRequestError(MarshalError,
+			errors.New("failed to marshal request"))
+	}
+	url := fmt.Sprintf("%s/api/show", service.address)
+	res, e := service.sendRequest(context.Background(), "POST", url, data, 10*time.Second)
+	if e != nil {
+		return nil, e
+	}
+
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, NewRequestError(ReadResponseError,
+			errors.New("failed to read response body"))
+	}
+	var outputs map[string]interface{}
+	err = json.Unmarshal(body, &outputs)
+	if err != nil {
+		return nil, NewRequestError(UnmarshalResponseError,
+			errors.New("failed to unmarshal response body"))
+	}
+	schema := ollamaSchema(request.ModelName)
+	schema.Metadata = make(map[string]interface{})
+	for _, key := range []string{"details", "parameters", "template", "model_info", "modified_at"} {
+		if value, ok := outputs[key]; ok {
+			schema.Metadata[key] = value
+		}
+	}
+	return schema, nil
+}
+
+// ollamaSchema returns the schema of the generate (`prompt`) and chat (`messages`) APIs.
+// Either `messages` or `prompt` must be set.
+func ollamaSchema(modelName string) *ModelSchema {
+	return &ModelSchema{
+		ModelName:   modelName,
+		Platform:    "ollama",
+		Description: "Ollama chat (`messages`) or generate (`prompt`) API",
+		Inputs: []FieldSchema{
+			{Name: "messages", Type: "array", Description: "The messages of the conversation",
+				Items: &FieldSchema{Type: "object"}},
+			{Name: "prompt", Type: "string", Description: "The prompt to generate a response for"},
+			{Name: "system", Type: "string", Description: "The system message"},
+			{Name: "images", Type: "array", Description: "The base64-encoded images for multimodal models",
+				Items: &FieldSchema{Type: "string"}},
+			{Name: "format", Description: "The format of the response, `json` or a JSON schema"},
+			{Name: "options", Type: "object", Description: "The model parameters, e.g., temperature"},
+			{Name: "keep_alive", Description: "How long the model stays loaded after the request"},
+		},
+		Outputs: []FieldSchema{
+			{Name: "output", Type: "string", Description: "The generated text"},
+			{Name: "finish_reason", Type: "string"},
+			{Name: "usage", Type: "object"},
+		},
+	}
+}
+
+// CheckHealth checks if the server is up via `/api/version`.
+func (service *Ollama) CheckHealth(ctx context.Context) error {
+	return probeOK(ctx, service.transport, fmt.Sprintf("%s/api/version", service.address), nil)
+}
+
+// Cancel is not supported since a request has no upstream job. The generation stops when
+// the task times out or the client disconnects.
+func (service *Ollama) Cancel(request *CancelRequest) *RequestError {
+	return cancelNotSupported()
+}
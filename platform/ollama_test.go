@@ -0,0 +1,177 @@
+package platform_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newOllamaServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var inputs map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&inputs))
+		if inputs["model"] != "test_model" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprintf(w, `{"error":"model '%v' not found"}`, inputs["model"])
+			return
+		}
+		require.NotContains(t, inputs, "upload_webhook")
+
+		if inputs["stream"] == true {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			for _, token := range []string{"Hello", ",", " world"} {
+				_, _ = fmt.Fprintf(w, "{\"model\":\"test_model\",\"response\":%q,\"done\":false}\n", token)
+			}
+			_, _ = fmt.Fprint(w, "{\"model\":\"test_model\",\"response\":\"\",\"done\":true,\"done_reason\":\"stop\"}\n")
+			return
+		}
+		switch r.URL.Path {
+		case "/api/chat":
+			_, _ = fmt.Fprint(w, `{"message":{"role":"assistant","content":"Hello"},"done":true,"done_reason":"stop",`+
+				`"prompt_eval_count":5,"eval_count":2}`)
+		case "/api/generate":
+			_, _ = fmt.Fprint(w, `{"response":"World","done":true,"done_reason":"length"}`)
+		case "/api/show":
+			_, _ = fmt.Fprint(w, `{"parameters":"stop \"<|eot_id|>\"",`+
+				`"details":{"family":"llama","parameter_size":"1.2B","quantization_level":"Q8_0"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestOllamaPredict(t *testing.T) {
+	server := newOllamaServer(t)
+	defer server.Close()
+	service, err := platform.NewPlatform("ollama", utils.Config{OllamaAddress: server.URL, OllamaRequestTimeout: 10}, nil)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		modelName     string
+		inputs        map[string]interface{}
+		checkResponse func(response *platform.InferResponse, err *platform.RequestError)
+	}{
+		{
+			name:      "Chat",
+			modelName: "test_model",
+			inputs: map[string]interface{}{
+				"messages":       []map[string]string{{"role": "user", "content": "Hi"}},
+				"upload_webhook": "http://localhost/upload",
+			},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.Nil(t, err)
+				require.Equal(t, "Hello", response.Outputs["output"])
+				require.Equal(t, "stop", response.Outputs["finish_reason"])
+				require.Equal(t, 7, response.Outputs["usage"].(map[string]int)["total_tokens"])
+			},
+		},
+		{
+			name:      "Generate",
+			modelName: "test_model",
+			inputs:    map[string]interface{}{"prompt": "Hi"},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.Nil(t, err)
+				require.Equal(t, "World", response.Outputs["output"])
+			},
+		},
+		{
+			name:      "Invalid inputs",
+			modelName: "test_model",
+			inputs:    map[string]interface{}{"text": "Hi"},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.NotNil(t, err)
+				require.Equal(t, platform.InvalidInputError, err.StatusCode)
+			},
+		},
+		{
+			name:      "Model not pulled",
+			modelName: "unknown_model",
+			inputs:    map[string]interface{}{"prompt": "Hi"},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.NotNil(t, err)
+				require.Equal(t, platform.UnknownModelError, err.StatusCode)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			request := &platform.InferRequest{ModelName: tc.modelName, Inputs: tc.inputs}
+			response, err := service.Predict(context.Background(), request, "v1")
+			tc.checkResponse(response, err)
+		})
+	}
+}
+
+func TestOllamaGenerate(t *testing.T) {
+	server := newOllamaServer(t)
+	defer server.Close()
+	service := platform.NewOllama(utils.Config{OllamaAddress: server.URL, OllamaRequestTimeout: 10})
+
+	recorder := httptest.NewRecorder()
+	request := &platform.InferRequest{
+		ModelName: "test_model",
+		Inputs:    map[string]interface{}{"prompt": "Hi"},
+	}
+	err := service.Generate(request, "v1", context.Background(), json.NewEncoder(recorder), recorder)
+	require.Nil(t, err)
+
+	decoder := json.NewDecoder(strings.NewReader(recorder.Body.String()))
+	var tokens []string
+	for decoder.More() {
+		var m platform.StreamingMessage
+		require.NoError(t, decoder.Decode(&m))
+		require.Equal(t, len(tokens), m.Id)
+		tokens = append(tokens, m.Data)
+	}
+	require.Equal(t, "Hello, world", strings.Join(tokens, ""))
+}
+
+func TestOllamaGenerateLongStream(t *testing.T) {
+	// The stream lasts longer than the request timeout
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = fmt.Fprint(w, "{\"model\":\"test_model\",\"response\":\"Hello\",\"done\":false}\n")
+		w.(http.Flusher).Flush()
+		time.Sleep(1500 * time.Millisecond)
+		_, _ = fmt.Fprint(w, "{\"model\":\"test_model\",\"response\":\" world\",\"done\":true}\n")
+	}))
+	defer server.Close()
+	service := platform.NewOllama(utils.Config{OllamaAddress: server.URL, OllamaRequestTimeout: 1})
+
+	recorder := httptest.NewRecorder()
+	request := &platform.InferRequest{
+		ModelName: "test_model",
+		Inputs:    map[string]interface{}{"prompt": "Hi"},
+	}
+	err := service.Generate(request, "v1", context.Background(), json.NewEncoder(recorder), recorder)
+	require.Nil(t, err)
+	require.Contains(t, recorder.Body.String(), " world")
+}
+
+func TestOllamaDocs(t *testing.T) {
+	server := newOllamaServer(t)
+	defer server.Close()
+	service := platform.NewOllama(utils.Config{OllamaAddress: server.URL, OllamaRequestTimeout: 10})
+
+	schema, err := service.Docs(&platform.DocsRequest{ModelName: "test_model"})
+	require.Nil(t, err)
+	require.Equal(t, "ollama", schema.Platform)
+	require.NotEmpty(t, schema.Inputs)
+	require.Equal(t, "llama", schema.Metadata["details"].(map[string]interface{})["family"])
+
+	_, err = service.Docs(&platform.DocsRequest{ModelName: "unknown_model"})
+	require.NotNil(t, err)
+	require.Equal(t, platform.UnknownModelError, err.StatusCode)
+}
@@ -0,0 +1,379 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"time"
+)
+
+// OpenAI supports the servers implementing the OpenAI-compatible APIs, e.g., vLLM or TGI.
+// https://platform.openai.com/docs/api-reference/chat
+type OpenAI struct {
+	address   string
+	apikey    string
+	timeout   int
+	retry     *RetryPolicy
+	transport http.RoundTripper
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIChoice struct {
+	Index        int            `json:"index"`
+	Text         string         `json:"text"`
+	Message      *openAIMessage `json:"message"`
+	Delta        *openAIMessage `json:"delta"`
+	FinishReason string         `json:"finish_reason"`
+}
+
+func (choice *openAIChoice) content() string {
+	if choice.Message != nil {
+		return choice.Message.Content
+	}
+	if choice.Delta != nil {
+		return choice.Delta.Content
+	}
+	return choice.Text
+}
+
+type openAIResponse struct {
+	ID      string         `json:"id"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   interface{}    `json:"usage"`
+}
+
+func NewOpenAI(config utils.Config) Platform {
+	return &OpenAI{
+		address: config.OpenAIAddress,
+		apikey:  config.OpenAIAPIKey,
+		timeout: config.OpenAIRequestTimeout,
+		retry: NewRetryPolicy("openai",
+			config.OpenAIRetryAttempts, config.OpenAIRetryBackoff, config).Idempotent(),
+		transport: SharedTransport(config),
+	}
+}
+
+func (service *OpenAI) buildRequest(
+	ctx context.Context,
+	method string,
+	url string,
+	body io.Reader,
+) (*http.Request, *RequestError) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, NewRequestError(BuildRequestError,
+			errors.New("failed to build request"))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if service.apikey != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", service.apikey))
+	}
+	return req, nil
+}
+
+func (service *OpenAI) sendRequest(
+	ctx context.Context,
+	method string,
+	url string,
+	body io.Reader,
+	timeout time.Duration,
+) (*http.Response, *RequestError) {
+	// Build a new prediction request
+	req, e := service.buildRequest(ctx, method, url, body)
+	if e != nil {
+		return nil, e
+	}
+
+	// Send the prediction request
+	setRequestTimeout(ctx, req)
+	client := http.Client{Transport: service.transport, Timeout: timeout}
+	res, err := service.retry.Do(&client, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, NewRequestError(contextErrorCode(ctx),
+				fmt.Errorf("url: %s, request aborted: %v", url, ctx.Err()))
+		}
+		return nil, NewRequestError(sendErrorCode(err),
+			fmt.Errorf("url: %s, failed to send request: %v", url, err))
+	}
+	if res.StatusCode != http.StatusOK {
+		var errorMessage interface{}
+		data, e := io.ReadAll(res.Body)
+		if e == nil {
+			_ = json.Unmarshal(data, &errorMessage)
+		} else {
+			log.Error().Msgf("url: %s, failed to read error message: %v", url, e)
+		}
+		res.Body.Close()
+		return nil, NewUpstreamError(res,
+			fmt.Errorf("url: %s, status-code: %d, error: %v", url, res.StatusCode, errorMessage))
+	}
+	return res, nil
+}
+
+// buildChatInputs marshals the inputs of a chat request if `messages` is set, otherwise a completion request,
+// which is shared by OpenAI and Ollama. The model name is used as `model` if it is not specified.
+// It returns true if it is a chat request.
+func buildChatInputs(request *InferRequest, stream bool) (bool, []byte, *RequestError) {
+	inputs := make(map[string]interface{}, len(request.Inputs)+2)
+	for key, value := range request.Inputs {
+		inputs[key] = value
+	}
+	if _, ok := inputs["model"]; !ok {
+		inputs["model"] = request.ModelName
+	}
+	inputs["stream"] = stream
+
+	_, chat := inputs["messages"]
+	if _, ok := inputs["prompt"]; !chat && !ok {
+		return false, nil, NewRequestError(InvalidInputError,
+			errors.New("either `messages` or `prompt` must be set"))
+	}
+	data, err := json.Marshal(inputs)
+	if err != nil {
+		return false, nil, NewRequestError(MarshalError,
+			errors.New("failed to marshal request"))
+	}
+	return chat, data, nil
+}
+
+// buildInputs converts the inputs into a chat completion request if `messages` is set,
+// otherwise a completion request.
+func (service *OpenAI) buildInputs(request *InferRequest, stream bool) (string, []byte, *RequestError) {
+	chat, data, e := buildChatInputs(request, stream)
+	if e != nil {
+		return "", nil, e
+	}
+	if chat {
+		return fmt.Sprintf("%s/v1/chat/completions", service.address), data, nil
+	}
+	return fmt.Sprintf("%s/v1/completions", service.address), data, nil
+}
+
+func (service *OpenAI) Predict(
+	ctx context.Context,
+	request *InferRequest,
+	version string,
+) (*InferResponse, *RequestError) {
+	if version == "v1" {
+		return service.predictV1(ctx, request)
+	}
+	return nil, NewRequestError(UnknownAPIVersion,
+		errors.New("prediction API version is not supported"))
+}
+
+func (service *OpenAI) Generate(
+	request *InferRequest,
+	version string,
+	ctx context.Context,
+	encoder *json.Encoder,
+	flusher http.Flusher,
+) *RequestError {
+	if version == "v1" {
+		return service.generateV1(request, ctx, encoder, flusher)
+	}
+	return NewRequestError(UnknownAPIVersion,
+		errors.New("generation API version is not supported"))
+}
+
+func (service *OpenAI) predictV1(ctx context.Context, request *InferRequest) (*InferResponse, *RequestError) {
+	url, data, e := service.buildInputs(request, false)
+	if e != nil {
+		return nil, e
+	}
+
+	// Send a new prediction request
+	startTime := time.Now()
+	res, e := service.sendRequest(
+		ctx, "POST", url, bytes.NewReader(data),
+		time.Duration(service.timeout)*time.Second,
+	)
+	if e != nil {
+		return nil, e
+	}
+
+	// Parse the response
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, NewRequestError(ReadResponseError,
+			errors.New("failed to read response body"))
+	}
+	var outputs openAIResponse
+	err = json.Unmarshal(body, &outputs)
+	if err != nil {
+		return nil, NewRequestError(UnmarshalResponseError,
+			errors.New("failed to unmarshal response body"))
+	}
+	if len(outputs.Choices) == 0 {
+		return nil, NewRequestError(ReadResponseError,
+			errors.New("no choices in the response"))
+	}
+
+	response := InferResponse{
+		Outputs: map[string]interface{}{
+			"output":        outputs.Choices[0].content(),
+			"finish_reason": outputs.Choices[0].FinishReason,
+			"usage":         outputs.Usage,
+			"running_time":  fmt.Sprintf("%fs", time.Since(startTime).Seconds()),
+		},
+	}
+	if len(outputs.Choices) > 1 {
+		choices := make([]string, len(outputs.Choices))
+		for i := range outputs.Choices {
+			choices[i] = outputs.Choices[i].content()
+		}
+		response.Outputs["choices"] = choices
+	}
+	return &response, nil
+}
+
+func (service *OpenAI) generateV1(
+	request *InferRequest,
+	ctx context.Context,
+	encoder *json.Encoder,
+	flusher http.Flusher,
+) *RequestError {
+	modelName := request.ModelName
+	url, data, e := service.buildInputs(request, true)
+	if e != nil {
+		return e
+	}
+
+	// The request is bound to the context so that it stops when the client disconnects.
+	// The client has no timeout, which would cut off long streams.
+	res, e := service.sendRequest(ctx, "POST", url, bytes.NewReader(data), 0)
+	if e != nil {
+		return e
+	}
+	defer res.Body.Close()
+
+	id := 0
+	err := readEvents(ctx, res.Body, func(event string, data string) (bool, error) {
+		if data == "[DONE]" {
+			return false, nil
+		}
+		var chunk openAIResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, fmt.Errorf("failed to decode chunk: %v", err)
+		}
+		for i := range chunk.Choices {
+			content := chunk.Choices[i].content()
+			if content == "" {
+				continue
+			}
+			if err := encoder.Encode(StreamingMessage{Id: id, Data: content}); err != nil {
+				return false, fmt.Errorf("failed to encode chunk: %v", err)
+			}
+			flusher.Flush()
+			id += 1
+		}
+		return true, nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Info().Msgf("client stopped listening")
+			return NewRequestError(SendRequestError,
+				fmt.Errorf("model-name: %s, client stopped listening", modelName))
+		}
+		return NewRequestError(SendRequestError,
+			fmt.Errorf("model-name: %s, %v", modelName, err))
+	}
+	return nil
+}
+
+// Docs returns the schema of the completion APIs, with the model card listed by `/v1/models`
+// as the metadata.
+func (service *OpenAI) Docs(request *DocsRequest) (*ModelSchema, *RequestError) {
+	url := fmt.Sprintf("%s/v1/models", service.address)
+	res, e := service.sendRequest(context.Background(), "GET", url, nil, 10*time.Second)
+	if e != nil {
+		return nil, e
+	}
+
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, NewRequestError(ReadResponseError,
+			errors.New("failed to read response body"))
+	}
+	var outputs struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	err = json.Unmarshal(body, &outputs)
+	if err != nil {
+		return nil, NewRequestError(UnmarshalResponseError,
+			errors.New("failed to unmarshal response body"))
+	}
+	for _, model := range outputs.Data {
+		if model["id"] == request.ModelName {
+			schema := openAISchema(request.ModelName)
+			schema.Metadata = model
+			return schema, nil
+		}
+	}
+	return nil, NewRequestError(UnknownModelError,
+		fmt.Errorf("model %s is not found", request.ModelName))
+}
+
+// openAISchema returns the schema of the commonly used parameters of the completion APIs.
+// Either `messages` or `prompt` must be set.
+func openAISchema(modelName string) *ModelSchema {
+	bound := func(value float64) *float64 {
+		return &value
+	}
+	return &ModelSchema{
+		ModelName:   modelName,
+		Platform:    "openai",
+		Description: "OpenAI-compatible chat completion (`messages`) or completion (`prompt`) API",
+		Inputs: []FieldSchema{
+			{Name: "messages", Type: "array", Description: "The messages of the conversation",
+				Items: &FieldSchema{Type: "object"}},
+			{Name: "prompt", Type: "string", Description: "The prompt to complete"},
+			{Name: "max_tokens", Type: "integer", Description: "The maximum number of tokens to generate",
+				Minimum: bound(1)},
+			{Name: "temperature", Type: "number", Description: "The sampling temperature",
+				Default: 1.0, Minimum: bound(0), Maximum: bound(2)},
+			{Name: "top_p", Type: "number", Description: "The nucleus sampling probability",
+				Default: 1.0, Minimum: bound(0), Maximum: bound(1)},
+			{Name: "n", Type: "integer", Description: "The number of choices to generate",
+				Default: 1, Minimum: bound(1)},
+			{Name: "stop", Description: "The sequence or sequences (string or array) where the generation stops",
+				Items: &FieldSchema{Type: "string"}},
+			{Name: "presence_penalty", Type: "number", Default: 0.0, Minimum: bound(-2), Maximum: bound(2)},
+			{Name: "frequency_penalty", Type: "number", Default: 0.0, Minimum: bound(-2), Maximum: bound(2)},
+			{Name: "seed", Type: "integer", Description: "The random seed"},
+		},
+		Outputs: []FieldSchema{
+			{Name: "output", Type: "string", Description: "The generated text of the first choice"},
+			{Name: "finish_reason", Type: "string"},
+			{Name: "usage", Type: "object"},
+			{Name: "choices", Type: "array", Description: "The generated texts if n > 1",
+				Items: &FieldSchema{Type: "string"}},
+		},
+	}
+}
+
+// CheckHealth checks if the server is up via `/v1/models`.
+func (service *OpenAI) CheckHealth(ctx context.Context) error {
+	header := make(http.Header)
+	if service.apikey != "" {
+		header.Set("Authorization", fmt.Sprintf("Bearer %s", service.apikey))
+	}
+	return probeOK(ctx, service.transport, fmt.Sprintf("%s/v1/models", service.address), header)
+}
+
+func (service *OpenAI) Cancel(request *CancelRequest) *RequestError {
+	return cancelNotSupported()
+}
@@ -0,0 +1,161 @@
+package platform_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newOpenAIServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var inputs map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&inputs))
+		require.Equal(t, "test_model", inputs["model"])
+		require.NotContains(t, inputs, "upload_webhook")
+
+		if inputs["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, token := range []string{"Hello", ",", " world"} {
+				_, _ = fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", token)
+			}
+			_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			_, _ = fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}]}`)
+		case "/v1/completions":
+			_, _ = fmt.Fprint(w, `{"choices":[{"index":0,"text":"World","finish_reason":"length"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestOpenAIPredict(t *testing.T) {
+	server := newOpenAIServer(t)
+	defer server.Close()
+	service, err := platform.NewPlatform("openai", utils.Config{OpenAIAddress: server.URL, OpenAIRequestTimeout: 10}, nil)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		inputs        map[string]interface{}
+		checkResponse func(response *platform.InferResponse, err *platform.RequestError)
+	}{
+		{
+			name: "Chat",
+			inputs: map[string]interface{}{
+				"messages":       []map[string]string{{"role": "user", "content": "Hi"}},
+				"upload_webhook": "http://localhost/upload",
+			},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.Nil(t, err)
+				require.Equal(t, "Hello", response.Outputs["output"])
+				require.Equal(t, "stop", response.Outputs["finish_reason"])
+			},
+		},
+		{
+			name:   "Completion",
+			inputs: map[string]interface{}{"prompt": "Hi"},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.Nil(t, err)
+				require.Equal(t, "World", response.Outputs["output"])
+			},
+		},
+		{
+			name:   "Invalid inputs",
+			inputs: map[string]interface{}{"text": "Hi"},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.NotNil(t, err)
+				require.Equal(t, platform.InvalidInputError, err.StatusCode)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			request := &platform.InferRequest{ModelName: "test_model", Inputs: tc.inputs}
+			response, err := service.Predict(context.Background(), request, "v1")
+			tc.checkResponse(response, err)
+		})
+	}
+}
+
+func TestOpenAIGenerate(t *testing.T) {
+	server := newOpenAIServer(t)
+	defer server.Close()
+	service := platform.NewOpenAI(utils.Config{OpenAIAddress: server.URL, OpenAIRequestTimeout: 10})
+
+	recorder := httptest.NewRecorder()
+	request := &platform.InferRequest{
+		ModelName: "test_model",
+		Inputs:    map[string]interface{}{"prompt": "Hi"},
+	}
+	err := service.Generate(request, "v1", context.Background(), json.NewEncoder(recorder), recorder)
+	require.Nil(t, err)
+
+	decoder := json.NewDecoder(strings.NewReader(recorder.Body.String()))
+	var tokens []string
+	for decoder.More() {
+		var m platform.StreamingMessage
+		require.NoError(t, decoder.Decode(&m))
+		require.Equal(t, len(tokens), m.Id)
+		tokens = append(tokens, m.Data)
+	}
+	require.Equal(t, "Hello, world", strings.Join(tokens, ""))
+}
+
+func TestOpenAIGenerateLongStream(t *testing.T) {
+	// The stream lasts longer than the request timeout
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hello\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		time.Sleep(1500 * time.Millisecond)
+		_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\" world\"}}]}\n\n")
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+	service := platform.NewOpenAI(utils.Config{OpenAIAddress: server.URL, OpenAIRequestTimeout: 1})
+
+	recorder := httptest.NewRecorder()
+	request := &platform.InferRequest{
+		ModelName: "test_model",
+		Inputs:    map[string]interface{}{"prompt": "Hi"},
+	}
+	err := service.Generate(request, "v1", context.Background(), json.NewEncoder(recorder), recorder)
+	require.Nil(t, err)
+	require.Contains(t, recorder.Body.String(), " world")
+}
+
+func TestOpenAIDocs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/models", r.URL.Path)
+		_, _ = fmt.Fprint(w, `{"object":"list","data":[{"id":"test_model","object":"model","owned_by":"vllm"}]}`)
+	}))
+	defer server.Close()
+	service := platform.NewOpenAI(utils.Config{OpenAIAddress: server.URL, OpenAIRequestTimeout: 10})
+
+	schema, err := service.Docs(&platform.DocsRequest{ModelName: "test_model"})
+	require.Nil(t, err)
+	require.Equal(t, "vllm", schema.Metadata["owned_by"])
+	// `stop` is either a string or an array of strings
+	require.Empty(t, platform.ValidateInputs(schema, map[string]interface{}{"stop": "\n"}, false))
+	require.Empty(t, platform.ValidateInputs(schema, map[string]interface{}{"stop": []interface{}{"\n"}}, false))
+	require.Len(t, platform.ValidateInputs(schema, map[string]interface{}{"stop": []interface{}{1.0}}, false), 1)
+
+	_, err = service.Docs(&platform.DocsRequest{ModelName: "unknown"})
+	require.NotNil(t, err)
+	require.Equal(t, platform.UnknownModelError, err.StatusCode)
+}
@@ -0,0 +1,355 @@
+package platform
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The request classes shaped by the rate limiter
+const (
+	RateLimitCreate = "create"
+	RateLimitPoll   = "poll"
+)
+
+// The maximum time to wait for a token if the request has no deadline
+const defaultMaxRateLimitWait = time.Minute
+
+// The time to stop sending requests after a 429 response without `Retry-After`
+const defaultRateLimitBackoff = time.Second
+
+var rateLimitWaitSeconds = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "platform_rate_limit_wait_seconds",
+		Help:    "Time waiting for the rate limiter before sending a request to the platform",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 2, 5, 10, 30, 60},
+	},
+	[]string{"platform", "class"},
+)
+
+var rateLimitRejections = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "platform_rate_limit_rejections_total",
+		Help: "Number of the requests rejected by the rate limiter since the wait exceeds the deadline",
+	},
+	[]string{"platform", "class"},
+)
+
+// RateLimitError is returned by the rate limited transport if the request cannot be sent before its deadline.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (err *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded, retry after %v", err.RetryAfter)
+}
+
+// rateLimitRequestError converts the error returned by `http.Client.Do` if it is caused by the rate limiter.
+func rateLimitRequestError(err error) (*RequestError, bool) {
+	var limitErr *RateLimitError
+	if !errors.As(err, &limitErr) {
+		return nil, false
+	}
+	e := NewRequestError(RateLimitedError, limitErr)
+	e.RetryAfter = limitErr.RetryAfter
+	return e, true
+}
+
+// waitThrottledPoll waits after a poll request is throttled, so that the running job isn't abandoned.
+// It returns the error to give up with, i.e., `e` if it isn't caused by rate limiting, or the context error.
+func waitThrottledPoll(ctx context.Context, e *RequestError) *RequestError {
+	if e.StatusCode != RateLimitedError {
+		return e
+	}
+	if !sleepContext(ctx, max(e.RetryAfter, defaultRateLimitBackoff)) {
+		return NewRequestError(contextErrorCode(ctx),
+			fmt.Errorf("predict aborted: %v", ctx.Err()))
+	}
+	return nil
+}
+
+// RateLimitStore keeps the token buckets, i.e., redis shared by the agent replicas, or the memory of a replica.
+type RateLimitStore interface {
+	// Reserve takes a token from the bucket and returns the time to wait before sending the request.
+	// If the wait would exceed `maxWait`, no token is taken, and it returns the wait and false.
+	Reserve(ctx context.Context, key string, rate float64, burst int, maxWait time.Duration) (time.Duration, bool, error)
+	// Block stops handing out the tokens of the bucket for the duration, e.g., after a 429 response.
+	Block(ctx context.Context, key string, duration time.Duration) error
+}
+
+// The token bucket in a redis hash. The time of redis is used so that the replicas agree on it.
+// Tokens are reserved ahead, i.e., the balance goes negative, so that the waiting requests are served in order.
+var reserveScript = redis.NewScript(`
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local rate = tonumber(ARGV[1]) / 1000
+local burst = tonumber(ARGV[2])
+local max_wait = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts', 'blocked')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+local blocked = tonumber(state[3]) or 0
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local wait = math.max(0, blocked - now)
+if tokens < 1 then
+  wait = math.max(wait, math.ceil((1 - tokens) / rate))
+end
+if wait > max_wait then
+  return {wait, 0}
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens - 1), 'ts', now, 'blocked', blocked)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate) + wait + 1000)
+return {wait, 1}
+`)
+
+var blockScript = redis.NewScript(`
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local blocked = now + tonumber(ARGV[1])
+local current = tonumber(redis.call('HGET', KEYS[1], 'blocked')) or 0
+if blocked > current then
+  redis.call('HSET', KEYS[1], 'blocked', blocked)
+  if redis.call('PTTL', KEYS[1]) < tonumber(ARGV[1]) + 1000 then
+    redis.call('PEXPIRE', KEYS[1], tonumber(ARGV[1]) + 1000)
+  end
+end
+return 0
+`)
+
+type redisRateLimitStore struct {
+	client redis.UniversalClient
+	// Whether redis runs in the pod of the agent, i.e., it is not shared by the replicas
+	local bool
+}
+
+func (store *redisRateLimitStore) Reserve(
+	ctx context.Context,
+	key string,
+	rate float64,
+	burst int,
+	maxWait time.Duration,
+) (time.Duration, bool, error) {
+	result, err := reserveScript.Run(ctx, store.client, []string{key},
+		rate, burst, maxWait.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	return time.Duration(result[0]) * time.Millisecond, result[1] == 1, nil
+}
+
+func (store *redisRateLimitStore) Block(ctx context.Context, key string, duration time.Duration) error {
+	return blockScript.Run(ctx, store.client, []string{key}, duration.Milliseconds()).Err()
+}
+
+// memoryBucket is full if it has never been updated.
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	blocked time.Time
+}
+
+// MemoryRateLimitStore keeps the token buckets in memory, which is used if redis is not configured.
+type MemoryRateLimitStore struct {
+	mutex   sync.Mutex
+	buckets map[string]*memoryBucket
+	now     func() time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*memoryBucket), now: time.Now}
+}
+
+func (store *MemoryRateLimitStore) bucket(key string) *memoryBucket {
+	bucket, ok := store.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{}
+		store.buckets[key] = bucket
+	}
+	return bucket
+}
+
+func (store *MemoryRateLimitStore) Reserve(
+	ctx context.Context,
+	key string,
+	rate float64,
+	burst int,
+	maxWait time.Duration,
+) (time.Duration, bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	now := store.now()
+	bucket := store.bucket(key)
+	tokens := float64(burst)
+	if !bucket.updated.IsZero() {
+		tokens = math.Min(tokens, bucket.tokens+math.Max(0, now.Sub(bucket.updated).Seconds())*rate)
+	}
+	wait := max(bucket.blocked.Sub(now), 0)
+	if tokens < 1 {
+		wait = max(wait, time.Duration(math.Ceil((1-tokens)/rate*1000))*time.Millisecond)
+	}
+	if wait > maxWait {
+		return wait, false, nil
+	}
+	bucket.tokens, bucket.updated = tokens-1, now
+	return wait, true, nil
+}
+
+func (store *MemoryRateLimitStore) Block(ctx context.Context, key string, duration time.Duration) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	now := store.now()
+	bucket := store.bucket(key)
+	if blocked := now.Add(duration); blocked.After(bucket.blocked) {
+		bucket.blocked = blocked
+	}
+	return nil
+}
+
+// NewRateLimitStore returns the store in redis if the client is set, otherwise the memory store.
+func NewRateLimitStore(config utils.Config, client redis.UniversalClient) RateLimitStore {
+	if client == nil {
+		return NewMemoryRateLimitStore()
+	}
+	return &redisRateLimitStore{client: client, local: config.UseLocalRedis && !config.RedisClusterMode}
+}
+
+// RateLimitedTransport shapes the requests sent with an upstream API key to the published rate limits
+// of the platform. The requests are classified by `classify`, e.g., creating predictions or polling them,
+// and each class has a token bucket per API key. A request waits for a token until its deadline, and fails
+// with RateLimitError if it cannot be sent in time. The buckets are paused by `Retry-After` of the 429 responses
+// and by the rate limit headers, i.e., `X-RateLimit-Remaining: 0` with `X-RateLimit-Reset`.
+// If the store fails, the requests are sent without rate limiting.
+type RateLimitedTransport struct {
+	platform  string
+	keyPrefix string
+	rates     map[string]float64
+	classify  func(req *http.Request) string
+	store     RateLimitStore
+	base      http.RoundTripper
+}
+
+// NewRateLimitedTransport returns `base` if none of the request classes is rate limited.
+// `rates` are the requests per second of the classes, and the burst is one second of requests.
+func NewRateLimitedTransport(
+	platform string,
+	apikey string,
+	rates map[string]float64,
+	classify func(req *http.Request) string,
+	store RateLimitStore,
+	base http.RoundTripper,
+) http.RoundTripper {
+	enabled := make(map[string]float64)
+	for class, rate := range rates {
+		if rate > 0 {
+			enabled[class] = rate
+		}
+	}
+	if len(enabled) == 0 {
+		return base
+	}
+	if store, ok := store.(*redisRateLimitStore); !ok || store.local {
+		log.Warn().Msgf("platform: %s, the rate limits are applied per agent since redis is not shared "+
+			"by the replicas, divide them by the number of replicas", platform)
+	}
+	// The API key is hashed so that it is not exposed in redis
+	hash := sha256.Sum256([]byte(apikey))
+	return &RateLimitedTransport{
+		platform:  platform,
+		keyPrefix: fmt.Sprintf("ratelimit:%s:%s", platform, hex.EncodeToString(hash[:8])),
+		rates:     enabled,
+		classify:  classify,
+		store:     store,
+		base:      base,
+	}
+}
+
+func (transport *RateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	class := transport.classify(req)
+	rate, ok := transport.rates[class]
+	if !ok {
+		return transport.base.RoundTrip(req)
+	}
+	ctx := req.Context()
+	key := transport.keyPrefix + ":" + class
+	maxWait := defaultMaxRateLimitWait
+	if deadline, ok := ctx.Deadline(); ok {
+		maxWait = time.Until(deadline)
+	}
+	burst := max(int(math.Ceil(rate)), 1)
+	wait, reserved, err := transport.store.Reserve(ctx, key, rate, burst, maxWait)
+	if err != nil {
+		log.Warn().Msgf("platform: %s, rate limiter is unavailable: %v", transport.platform, err)
+	} else if !reserved {
+		rateLimitRejections.WithLabelValues(transport.platform, class).Inc()
+		return nil, &RateLimitError{RetryAfter: wait}
+	} else {
+		rateLimitWaitSeconds.WithLabelValues(transport.platform, class).Observe(wait.Seconds())
+		if !sleepContext(ctx, wait) {
+			return nil, ctx.Err()
+		}
+	}
+
+	res, err := transport.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if pause, ok := rateLimitPause(res); ok {
+		log.Warn().Msgf("platform: %s, %s requests are paused for %v", transport.platform, class, pause)
+		if err := transport.store.Block(ctx, key, pause); err != nil {
+			log.Warn().Msgf("platform: %s, failed to pause the rate limiter: %v", transport.platform, err)
+		}
+	}
+	return res, nil
+}
+
+// rateLimitPause returns how long the requests should be paused according to the response.
+func rateLimitPause(res *http.Response) (time.Duration, bool) {
+	if res.StatusCode == http.StatusTooManyRequests {
+		if delay, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok && delay > 0 {
+			return delay, true
+		}
+		if reset, ok := parseRateLimitReset(res.Header); ok {
+			return reset, true
+		}
+		return defaultRateLimitBackoff, true
+	}
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		if strings.TrimSpace(res.Header.Get(prefix+"Remaining")) == "0" {
+			return parseRateLimitReset(res.Header)
+		}
+	}
+	return 0, false
+}
+
+// parseRateLimitReset parses the reset header, which is either the seconds until the reset or a unix timestamp.
+func parseRateLimitReset(header http.Header) (time.Duration, bool) {
+	for _, name := range []string{"X-RateLimit-Reset", "RateLimit-Reset"} {
+		value, err := strconv.ParseFloat(strings.TrimSpace(header.Get(name)), 64)
+		if err != nil || value <= 0 {
+			continue
+		}
+		delay := time.Duration(value * float64(time.Second))
+		if value > 1e9 {
+			delay = time.Until(time.Unix(int64(value), 0))
+		}
+		if delay > 0 {
+			return delay, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,181 @@
+package platform_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func classifyByMethod(req *http.Request) string {
+	if req.Method == http.MethodPost {
+		return platform.RateLimitCreate
+	}
+	return platform.RateLimitPoll
+}
+
+func TestRateLimitedTransport(t *testing.T) {
+	testCases := []struct {
+		name  string
+		rates map[string]float64
+		check func(t *testing.T, server *httptest.Server, client *http.Client)
+	}{
+		{
+			name:  "Shape requests",
+			rates: map[string]float64{platform.RateLimitCreate: 10},
+			check: func(t *testing.T, server *httptest.Server, client *http.Client) {
+				// The burst is 10 requests, and the other 2 requests wait for 100ms each
+				start := time.Now()
+				for i := 0; i < 12; i++ {
+					res, err := client.Post(server.URL+"/create", "application/json", nil)
+					require.NoError(t, err)
+					res.Body.Close()
+				}
+				require.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+				// The poll requests are not rate limited
+				start = time.Now()
+				for i := 0; i < 20; i++ {
+					res, err := client.Get(server.URL + "/poll")
+					require.NoError(t, err)
+					res.Body.Close()
+				}
+				require.Less(t, time.Since(start), 100*time.Millisecond)
+			},
+		},
+		{
+			name:  "Deadline exceeded",
+			rates: map[string]float64{platform.RateLimitCreate: 1},
+			check: func(t *testing.T, server *httptest.Server, client *http.Client) {
+				res, err := client.Post(server.URL+"/create", "application/json", nil)
+				require.NoError(t, err)
+				res.Body.Close()
+
+				// The next token is available after 1 second
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+				req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/create", nil)
+				require.NoError(t, err)
+				_, err = client.Do(req)
+				var limitErr *platform.RateLimitError
+				require.ErrorAs(t, err, &limitErr)
+				require.Greater(t, limitErr.RetryAfter, 500*time.Millisecond)
+			},
+		},
+		{
+			name:  "Retry-After",
+			rates: map[string]float64{platform.RateLimitPoll: 100},
+			check: func(t *testing.T, server *httptest.Server, client *http.Client) {
+				res, err := client.Get(server.URL + "/throttled")
+				require.NoError(t, err)
+				res.Body.Close()
+				require.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+
+				// The bucket is paused for 2 seconds
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/poll", nil)
+				require.NoError(t, err)
+				_, err = client.Do(req)
+				var limitErr *platform.RateLimitError
+				require.ErrorAs(t, err, &limitErr)
+				require.Greater(t, limitErr.RetryAfter, time.Second)
+			},
+		},
+		{
+			name:  "Rate limit headers",
+			rates: map[string]float64{platform.RateLimitPoll: 100},
+			check: func(t *testing.T, server *httptest.Server, client *http.Client) {
+				res, err := client.Get(server.URL + "/exhausted")
+				require.NoError(t, err)
+				res.Body.Close()
+				require.Equal(t, http.StatusOK, res.StatusCode)
+
+				// The bucket is paused until the reset in 0.2 seconds
+				start := time.Now()
+				res, err = client.Get(server.URL + "/poll")
+				require.NoError(t, err)
+				res.Body.Close()
+				require.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/throttled":
+					w.Header().Set("Retry-After", "2")
+					w.WriteHeader(http.StatusTooManyRequests)
+				case "/exhausted":
+					w.Header().Set("X-RateLimit-Remaining", "0")
+					w.Header().Set("X-RateLimit-Reset", "0.2")
+				}
+			}))
+			defer server.Close()
+
+			transport := platform.NewRateLimitedTransport("test", "key", tc.rates, classifyByMethod,
+				platform.NewMemoryRateLimitStore(), http.DefaultTransport)
+			tc.check(t, server, &http.Client{Transport: transport})
+		})
+	}
+}
+
+func TestRateLimitedTransportDisabled(t *testing.T) {
+	transport := platform.NewRateLimitedTransport("test", "key",
+		map[string]float64{platform.RateLimitCreate: 0}, classifyByMethod,
+		platform.NewMemoryRateLimitStore(), http.DefaultTransport)
+	require.Equal(t, http.DefaultTransport, transport)
+}
+
+func TestReplicateRateLimit(t *testing.T) {
+	var polls atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/predictions":
+			_, _ = fmt.Fprintf(w, `{"id": "abc", "urls": {"get": "%s/predictions/abc"}}`, server.URL)
+		case "/predictions/abc":
+			// The first poll is throttled
+			if polls.Add(1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			_, _ = fmt.Fprint(w, `{"status": "succeeded", "output": ["a.png"], "metrics": {"predict_time": 1.5}}`)
+		}
+	}))
+	defer server.Close()
+
+	service := platform.NewReplicate(utils.Config{
+		ReplicateAddress:         server.URL + "/predictions",
+		ReplicateRequestTimeout:  10,
+		ReplicateCreateRateLimit: 0.5,
+		ReplicatePollRateLimit:   50,
+	}, platform.NewMemoryRateLimitStore())
+	request := &platform.InferRequest{ModelName: "test_model", Inputs: map[string]interface{}{"prompt": "Hi"}}
+	start := time.Now()
+	response, e := service.Predict(context.Background(), request, "v1")
+	require.Nil(t, e)
+	require.Equal(t, []interface{}{"a.png"}, response.Outputs["output"])
+	require.Equal(t, int32(2), polls.Load())
+	require.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	// The create request is rejected if it cannot be sent before the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, e = service.Predict(ctx, request, "v1")
+	require.NotNil(t, e)
+	require.Equal(t, platform.RateLimitedError, e.StatusCode)
+	require.Greater(t, e.RetryAfter, 500*time.Millisecond)
+	require.Equal(t, int32(2), polls.Load())
+}
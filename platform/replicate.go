@@ -10,45 +10,75 @@ import (
 	"github.com/rs/zerolog/log"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type Replicate struct {
-	address string
-	apikey  string
-	modelID string
-	timeout int
+	address   string
+	apikey    string
+	modelID   string
+	modelName string
+	timeout   int
+	retry     *RetryPolicy
+	transport http.RoundTripper
 }
 
-func NewReplicate(config utils.Config) Platform {
+func NewReplicate(config utils.Config, limits RateLimitStore) Platform {
 	return &Replicate{
-		address: config.ReplicateAddress,
-		apikey:  config.ReplicateAPIKey,
-		modelID: config.ReplicateModelID,
-		timeout: config.ReplicateRequestTimeout,
+		address:   config.ReplicateAddress,
+		apikey:    config.ReplicateAPIKey,
+		modelID:   config.ReplicateModelID,
+		modelName: config.ReplicateModelName,
+		timeout:   config.ReplicateRequestTimeout,
+		retry: NewRetryPolicy("replicate",
+			config.ReplicateRetryAttempts, config.ReplicateRetryBackoff, config),
+		transport: NewRateLimitedTransport("replicate", config.ReplicateAPIKey, map[string]float64{
+			RateLimitCreate: config.ReplicateCreateRateLimit,
+			RateLimitPoll:   config.ReplicatePollRateLimit,
+		}, classifyReplicateRequest, limits, SharedTransport(config)),
 	}
 }
 
+// classifyReplicateRequest returns the rate limit class of the request. Replicate limits creating
+// predictions and the other endpoints separately.
+// https://replicate.com/docs/topics/predictions/rate-limits
+func classifyReplicateRequest(req *http.Request) string {
+	if req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/predictions") {
+		return RateLimitCreate
+	}
+	return RateLimitPoll
+}
+
 func (service *Replicate) sendRequest(
+	ctx context.Context,
 	method string,
 	address string,
 	body io.Reader,
 	timeout time.Duration,
 ) (*http.Response, *RequestError) {
 	// Build a new prediction request
-	req, err := http.NewRequest(method, address, body)
+	req, err := http.NewRequestWithContext(ctx, method, address, body)
 	if err != nil {
 		return nil, NewRequestError(BuildRequestError,
 			errors.New("failed to build request"))
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Token %s", service.apikey))
+	setRequestTimeout(ctx, req)
 
 	// Send the prediction request
-	client := http.Client{Timeout: timeout}
-	res, err := client.Do(req)
+	client := http.Client{Transport: service.transport, Timeout: timeout}
+	res, err := service.retry.Do(&client, req)
 	if err != nil {
-		return nil, NewRequestError(SendRequestError,
+		if ctx.Err() != nil {
+			return nil, NewRequestError(contextErrorCode(ctx),
+				fmt.Errorf("request aborted: %v", ctx.Err()))
+		}
+		if e, ok := rateLimitRequestError(err); ok {
+			return nil, e
+		}
+		return nil, NewRequestError(sendErrorCode(err),
 			errors.New("failed to send request, model not ready"))
 	}
 	if res.StatusCode > 300 {
@@ -60,19 +90,27 @@ func (service *Replicate) sendRequest(
 			log.Error().Msgf("failed to read error message: %v", e)
 		}
 		res.Body.Close()
-		return nil, NewRequestError(InvalidInputError,
-			fmt.Errorf("invalid inputs: %v", errorMessage))
+		return nil, NewUpstreamError(res,
+			fmt.Errorf("status-code: %d, error: %v", res.StatusCode, errorMessage))
 	}
 	return res, nil
 }
 
-func (service *Replicate) Predict(request *InferRequest, version string) (*InferResponse, *RequestError) {
+// createPrediction creates a new prediction and returns the prediction object.
+// https://replicate.com/docs/reference/http#predictions.create
+func (service *Replicate) createPrediction(
+	ctx context.Context,
+	request *InferRequest,
+	stream bool,
+) (map[string]interface{}, *RequestError) {
 	inputs := request.Inputs
-	delete(inputs, "upload_webhook")
 	replicateInput := map[string]interface{}{
 		"version": service.modelID,
 		"input":   inputs,
 	}
+	if stream {
+		replicateInput["stream"] = true
+	}
 
 	// Marshal the input data
 	data, err := json.Marshal(replicateInput)
@@ -83,7 +121,7 @@ func (service *Replicate) Predict(request *InferRequest, version string) (*Infer
 
 	// Send a new prediction request
 	res, e := service.sendRequest(
-		"POST", service.address, bytes.NewReader(data),
+		ctx, "POST", service.address, bytes.NewReader(data),
 		time.Duration(service.timeout)*time.Second,
 	)
 	if e != nil {
@@ -107,28 +145,52 @@ func (service *Replicate) Predict(request *InferRequest, version string) (*Infer
 		return nil, NewRequestError(InternalError,
 			fmt.Errorf("predict failed: %s", outputs))
 	}
+	return outputs, nil
+}
 
-	val, ok := outputs["urls"]
+// predictionURL returns the URL for the given key in `urls` of the prediction object, e.g., `get` or `stream`.
+func predictionURL(prediction map[string]interface{}, key string) (string, *RequestError) {
+	urls, ok := prediction["urls"].(map[string]interface{})
 	if !ok {
-		return nil, NewRequestError(ReadResponseError,
+		return "", NewRequestError(ReadResponseError,
 			errors.New("failed to read webhook urls"))
 	}
-	urls := val.(map[string]interface{})
-	url, ok := urls["get"]
+	url, ok := urls[key]
 	if !ok {
-		return nil, NewRequestError(ReadResponseError,
-			errors.New("failed to read webhook 'get' url"))
+		return "", NewRequestError(ReadResponseError,
+			fmt.Errorf("failed to read webhook '%s' url", key))
+	}
+	return fmt.Sprintf("%s", url), nil
+}
+
+func (service *Replicate) Predict(
+	ctx context.Context,
+	request *InferRequest,
+	version string,
+) (*InferResponse, *RequestError) {
+	outputs, e := service.createPrediction(ctx, request, false)
+	if e != nil {
+		return nil, e
+	}
+	getURL, e := predictionURL(outputs, "get")
+	if e != nil {
+		return nil, e
+	}
+	if id, ok := outputs["id"].(string); ok {
+		notifySubmitted(request, id)
 	}
-	getURL := fmt.Sprintf("%s", url)
 
 	// Get prediction status
 	for i := 0; i < service.timeout; i++ {
 		statusResponse, e := service.sendRequest(
-			"GET", getURL, nil,
+			ctx, "GET", getURL, nil,
 			time.Duration(service.timeout)*time.Second,
 		)
 		if e != nil {
-			return nil, e
+			if e = waitThrottledPoll(ctx, e); e != nil {
+				return nil, e
+			}
+			continue
 		}
 
 		// Parse the prediction status
@@ -163,20 +225,27 @@ func (service *Replicate) Predict(request *InferRequest, version string) (*Infer
 			} else if status == "failed" {
 				return nil, NewRequestError(InternalError,
 					fmt.Errorf("predict failed: %s", outputs))
+			} else if status == "canceled" {
+				return nil, NewRequestError(CanceledError,
+					errors.New("prediction canceled"))
+			}
+			if !sleepContext(ctx, time.Second) {
+				return nil, NewRequestError(contextErrorCode(ctx),
+					fmt.Errorf("predict aborted: %v", ctx.Err()))
 			}
-			time.Sleep(time.Second)
 
-		} else if statusResponse.StatusCode == 429 {
-			// Rate limit: Request was throttled
-			time.Sleep(2 * time.Second)
 		} else {
 			return nil, NewRequestError(InternalError,
 				fmt.Errorf("predict failed: %s", outputs))
 		}
 	}
-	return nil, NewRequestError(InternalError, errors.New("predict timeout"))
+	return nil, NewRequestError(TimeoutError, errors.New("predict timeout"))
 }
 
+// Generate creates a prediction with `stream` enabled and forwards the server-sent events
+// from `urls.stream`, i.e., `output`, `logs` and `done`, to the client. The prediction is canceled
+// if the stream ends before it is done, e.g., the client disconnects, so that it is no longer billed.
+// https://replicate.com/docs/streaming
 func (service *Replicate) Generate(
 	request *InferRequest,
 	version string,
@@ -184,10 +253,145 @@ func (service *Replicate) Generate(
 	encoder *json.Encoder,
 	flusher http.Flusher,
 ) *RequestError {
-	return NewRequestError(UnknownAPIVersion,
-		errors.New("generation API for replicate is not supported"))
+	prediction, e := service.createPrediction(ctx, request, true)
+	if e != nil {
+		return e
+	}
+	predictionID, _ := prediction["id"].(string)
+	if predictionID != "" {
+		notifySubmitted(request, predictionID)
+	}
+	finished := false
+	defer func() {
+		if !finished && predictionID != "" {
+			if e := service.Cancel(&CancelRequest{ModelName: request.ModelName, UpstreamID: predictionID}); e != nil {
+				log.Error().Msgf("failed to cancel replicate prediction %s: %v", predictionID, e)
+			}
+		}
+	}()
+	streamURL, e := predictionURL(prediction, "stream")
+	if e != nil {
+		return NewRequestError(InvalidInputError,
+			errors.New("the model doesn't support streaming"))
+	}
+
+	// The request is bound to the context so that it stops when the client disconnects.
+	// The client has no timeout, which would cut off long streams.
+	req, err := http.NewRequestWithContext(ctx, "GET", streamURL, nil)
+	if err != nil {
+		return NewRequestError(BuildRequestError,
+			errors.New("failed to build request"))
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-store")
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", service.apikey))
+
+	client := http.Client{Transport: service.transport}
+	res, err := service.retry.Do(&client, req)
+	if err != nil {
+		return NewRequestError(sendErrorCode(err),
+			fmt.Errorf("failed to send request: %v", err))
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		drainBody(res)
+		return NewUpstreamError(res,
+			fmt.Errorf("status-code: %d, failed to open the stream", res.StatusCode))
+	}
+
+	id := 0
+	var predictErr *RequestError
+	err = readEvents(ctx, res.Body, func(event string, data string) (bool, error) {
+		switch event {
+		case "error":
+			finished = true
+			predictErr = NewRequestError(InternalError,
+				fmt.Errorf("predict failed: %s", data))
+			return false, nil
+		case "output", "logs", "done":
+			if event == "done" {
+				finished = true
+			}
+			if err := encoder.Encode(StreamingMessage{Id: id, Event: event, Data: data}); err != nil {
+				return false, fmt.Errorf("failed to encode request: %v", err)
+			}
+			flusher.Flush()
+			id += 1
+		}
+		return event != "done", nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Info().Msgf("client stopped listening")
+			return NewRequestError(SendRequestError,
+				errors.New("client stopped listening"))
+		}
+		return NewRequestError(SendRequestError, err)
+	}
+	return predictErr
+}
+
+// Docs returns the model schema converted from the OpenAPI schema of the model version.
+// https://replicate.com/docs/reference/http#models.versions.get
+func (service *Replicate) Docs(request *DocsRequest) (*ModelSchema, *RequestError) {
+	if service.modelName == "" {
+		return nil, NewRequestError(InternalError,
+			errors.New("REPLICATE_MODEL_NAME is not set"))
+	}
+	// The predictions API is `{base}/predictions` and the models API is `{base}/models`
+	base := strings.TrimSuffix(service.address, "/predictions")
+	address := fmt.Sprintf("%s/models/%s/versions/%s", base, service.modelName, service.modelID)
+	res, e := service.sendRequest(context.Background(), "GET", address, nil, 10*time.Second)
+	if e != nil {
+		return nil, e
+	}
+
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, NewRequestError(ReadResponseError,
+			errors.New("failed to read response body"))
+	}
+	var version struct {
+		ID            string                 `json:"id"`
+		CreatedAt     string                 `json:"created_at"`
+		CogVersion    string                 `json:"cog_version"`
+		OpenAPISchema map[string]interface{} `json:"openapi_schema"`
+	}
+	err = json.Unmarshal(body, &version)
+	if err != nil {
+		return nil, NewRequestError(UnmarshalResponseError,
+			errors.New("failed to unmarshal response body"))
+	}
+	schema := newModelSchema(request.ModelName, "replicate", version.OpenAPISchema)
+	if schema.Metadata == nil {
+		schema.Metadata = make(map[string]interface{})
+	}
+	schema.Metadata["model"] = service.modelName
+	schema.Metadata["version"] = version.ID
+	schema.Metadata["created_at"] = version.CreatedAt
+	schema.Metadata["cog_version"] = version.CogVersion
+	return schema, nil
 }
 
-func (service *Replicate) Docs(request *DocsRequest) (interface{}, *RequestError) {
-	return "", nil
+// CheckHealth checks if the API is reachable and the API token is valid via `/account`.
+func (service *Replicate) CheckHealth(ctx context.Context) error {
+	url := fmt.Sprintf("%s/account", strings.TrimSuffix(service.address, "/predictions"))
+	header := http.Header{"Authorization": []string{fmt.Sprintf("Token %s", service.apikey)}}
+	return probeOK(ctx, service.transport, url, header)
+}
+
+// Cancel cancels the running prediction. It is detached from the caller, e.g., the client has disconnected.
+// https://replicate.com/docs/reference/http#predictions.cancel
+func (service *Replicate) Cancel(request *CancelRequest) *RequestError {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	address := fmt.Sprintf("%s/%s/cancel", service.address, request.UpstreamID)
+	res, e := service.sendRequest(ctx, "POST", address, nil, 10*time.Second)
+	if e != nil {
+		return e
+	}
+	res.Body.Close()
+	log.Info().Msgf("canceled replicate prediction %s", request.UpstreamID)
+	return nil
 }
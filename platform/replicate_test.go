@@ -0,0 +1,164 @@
+package platform_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReplicateGenerate(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/predictions":
+			var inputs map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&inputs))
+			require.Equal(t, true, inputs["stream"])
+			_, _ = fmt.Fprintf(w, `{"id": "abc", "urls": {"stream": "%s/stream/abc"}}`, server.URL)
+		case "/stream/abc":
+			require.Equal(t, "text/event-stream", r.Header.Get("Accept"))
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprint(w, "event: logs\ndata: loading\n\n")
+			_, _ = fmt.Fprint(w, "event: output\ndata: Hello\n\n")
+			_, _ = fmt.Fprint(w, "event: output\ndata:  world\n\n")
+			_, _ = fmt.Fprint(w, "event: done\ndata: {}\n\n")
+		default:
+			// The finished prediction is not canceled
+			w.WriteHeader(http.StatusNotFound)
+			require.Fail(t, "unexpected request", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	service := platform.NewReplicate(utils.Config{
+		ReplicateAddress:        server.URL + "/predictions",
+		ReplicateRequestTimeout: 10,
+	}, nil)
+	recorder := httptest.NewRecorder()
+	var upstreamID string
+	request := &platform.InferRequest{
+		ModelName:   "test_model",
+		Inputs:      map[string]interface{}{"prompt": "Hi"},
+		OnSubmitted: func(id string) { upstreamID = id },
+	}
+	err := service.Generate(request, "v1", context.Background(), json.NewEncoder(recorder), recorder)
+	require.Nil(t, err)
+	require.Equal(t, "abc", upstreamID)
+
+	decoder := json.NewDecoder(strings.NewReader(recorder.Body.String()))
+	var messages []platform.StreamingMessage
+	for decoder.More() {
+		var m platform.StreamingMessage
+		require.NoError(t, decoder.Decode(&m))
+		messages = append(messages, m)
+	}
+	require.Len(t, messages, 4)
+	require.Equal(t, "logs", messages[0].Event)
+	require.Equal(t, "Hello", messages[1].Data)
+	require.Equal(t, " world", messages[2].Data)
+	require.Equal(t, "done", messages[3].Event)
+}
+
+func TestReplicateGenerateCanceled(t *testing.T) {
+	testCases := []struct {
+		name   string
+		stream bool
+	}{
+		{name: "Client disconnected", stream: true},
+		{name: "Streaming not supported", stream: false},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			var numCanceled int32
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/predictions":
+					if tc.stream {
+						_, _ = fmt.Fprintf(w, `{"id": "abc", "urls": {"stream": "%s/stream/abc"}}`, server.URL)
+					} else {
+						_, _ = fmt.Fprint(w, `{"id": "abc", "urls": {}}`)
+					}
+				case "/stream/abc":
+					w.Header().Set("Content-Type", "text/event-stream")
+					_, _ = fmt.Fprint(w, "event: output\ndata: Hello\n\n")
+					w.(http.Flusher).Flush()
+					<-r.Context().Done()
+				case "/predictions/abc/cancel":
+					atomic.AddInt32(&numCanceled, 1)
+					_, _ = fmt.Fprint(w, `{"id": "abc", "status": "canceled"}`)
+				}
+			}))
+			defer server.Close()
+
+			service := platform.NewReplicate(utils.Config{
+				ReplicateAddress:        server.URL + "/predictions",
+				ReplicateRequestTimeout: 10,
+			}, nil)
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			recorder := httptest.NewRecorder()
+			request := &platform.InferRequest{ModelName: "test_model", Inputs: map[string]interface{}{}}
+			err := service.Generate(request, "v1", ctx, json.NewEncoder(recorder), recorder)
+			require.NotNil(t, err)
+			// The prediction is no longer billed
+			require.Equal(t, int32(1), atomic.LoadInt32(&numCanceled))
+		})
+	}
+}
+
+func TestReplicateDocs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/models/stability-ai/sdxl/versions/abc", r.URL.Path)
+		_, _ = fmt.Fprint(w, `{"id": "abc", "cog_version": "0.8.6", "openapi_schema": {
+			"info": {"title": "Cog", "version": "0.1.0"},
+			"components": {"schemas": {
+				"Input": {"type": "object", "required": ["prompt"], "properties": {
+					"prompt": {"type": "string", "title": "Prompt", "x-order": 0},
+					"scheduler": {"allOf": [{"$ref": "#/components/schemas/scheduler"}],
+						"default": "DDIM", "x-order": 2},
+					"num_outputs": {"type": "integer", "default": 1, "minimum": 1, "maximum": 4, "x-order": 1}
+				}},
+				"Output": {"type": "array", "items": {"type": "string", "format": "uri"}},
+				"scheduler": {"enum": ["DDIM", "K_EULER"], "type": "string", "title": "scheduler"}
+			}}
+		}}`)
+	}))
+	defer server.Close()
+
+	service := platform.NewReplicate(utils.Config{
+		ReplicateAddress:   server.URL + "/predictions",
+		ReplicateModelID:   "abc",
+		ReplicateModelName: "stability-ai/sdxl",
+	}, nil)
+	schema, err := service.Docs(&platform.DocsRequest{ModelName: "sdxl"})
+	require.Nil(t, err)
+	require.Equal(t, "replicate", schema.Platform)
+	require.Equal(t, "abc", schema.Metadata["version"])
+
+	require.Len(t, schema.Inputs, 3)
+	require.Equal(t, "prompt", schema.Inputs[0].Name)
+	require.True(t, schema.Inputs[0].Required)
+	require.Equal(t, "num_outputs", schema.Inputs[1].Name)
+	require.Equal(t, 4.0, *schema.Inputs[1].Maximum)
+	require.Equal(t, "scheduler", schema.Inputs[2].Name)
+	require.Equal(t, "string", schema.Inputs[2].Type)
+	require.Equal(t, []interface{}{"DDIM", "K_EULER"}, schema.Inputs[2].Enum)
+	require.Equal(t, "DDIM", schema.Inputs[2].Default)
+
+	require.Len(t, schema.Outputs, 1)
+	require.Equal(t, "array", schema.Outputs[0].Type)
+	require.Equal(t, "uri", schema.Outputs[0].Items.Format)
+}
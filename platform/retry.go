@@ -0,0 +1,188 @@
+package platform
+
+import (
+	"errors"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/rs/zerolog/log"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var defaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy retries the requests failed due to connection errors or the retryable status codes
+// with exponential backoff and jitter. `Retry-After` returned by the server is honored.
+// The requests which are not replayable, e.g., creating a billed prediction with POST, are only retried
+// if they provably never reached the server, i.e., the connection failed or the server returned 429,
+// unless the policy is `Idempotent`.
+type RetryPolicy struct {
+	platform    string
+	attempts    int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	statusCodes map[int]bool
+	idempotent  bool
+}
+
+// NewRetryPolicy creates the retry policy of the platform. `attempts` is the maximum number of attempts
+// including the first one, and `backoff` is the seconds to wait before the first retry.
+// The maximum backoff and the retryable status codes are shared by all the platforms.
+func NewRetryPolicy(platform string, attempts int, backoff float64, config utils.Config) *RetryPolicy {
+	if attempts < 1 {
+		attempts = 1
+	}
+	policy := &RetryPolicy{
+		platform:    platform,
+		attempts:    attempts,
+		backoff:     time.Duration(backoff * float64(time.Second)),
+		maxBackoff:  time.Duration(config.RetryMaxBackoff * float64(time.Second)),
+		statusCodes: make(map[int]bool),
+	}
+	if policy.maxBackoff <= 0 {
+		policy.maxBackoff = 30 * time.Second
+	}
+	if config.RetryStatusCodes == "" {
+		for _, code := range defaultRetryStatusCodes {
+			policy.statusCodes[code] = true
+		}
+	}
+	for _, s := range strings.Split(config.RetryStatusCodes, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		code, err := strconv.Atoi(s)
+		if err != nil {
+			log.Warn().Msgf("invalid retryable status code: %s", s)
+			continue
+		}
+		policy.statusCodes[code] = true
+	}
+	return policy
+}
+
+// Idempotent marks all the requests of the platform as replayable, e.g., the inference POSTs of
+// a model server which have no side effects, so that they are retried on the retryable status codes too.
+func (policy *RetryPolicy) Idempotent() *RetryPolicy {
+	policy.idempotent = true
+	return policy
+}
+
+// Do sends the request and retries it according to the policy. The request body must be
+// rewindable, i.e., `GetBody` is set, which is true for the requests with a `bytes.Reader` body.
+// It returns the last response if the retries run out, or the context error if the context is done.
+func (policy *RetryPolicy) Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	replayable := policy.idempotent || isReplayable(req)
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			req = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req.Body = body
+			}
+		}
+		res, err := client.Do(req)
+		if attempt >= policy.attempts || ctx.Err() != nil {
+			return res, err
+		}
+		if _, ok := rateLimitRequestError(err); ok {
+			// The rate limiter has waited as long as possible
+			return res, err
+		}
+
+		var delay time.Duration
+		var reason string
+		if err != nil {
+			if !replayable && !isDialError(err) {
+				return res, err
+			}
+			delay = policy.delay(attempt, nil)
+			reason = "error"
+			log.Warn().Msgf("platform: %s, failed to send request: %v, retry: %d", policy.platform, err, attempt)
+		} else if policy.statusCodes[res.StatusCode] &&
+			(replayable || res.StatusCode == http.StatusTooManyRequests) {
+			delay = policy.delay(attempt, res)
+			reason = strconv.Itoa(res.StatusCode)
+			log.Warn().Msgf("platform: %s, status-code: %d, retry: %d", policy.platform, res.StatusCode, attempt)
+			drainBody(res)
+		} else {
+			return res, nil
+		}
+		platformRetries.WithLabelValues(policy.platform, reason).Inc()
+		if !sleepContext(ctx, delay) {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// isReplayable returns true if the request can be sent again after it may have reached the server,
+// i.e., the method is idempotent or the request has an idempotency key, as `http.Transport` does.
+func isReplayable(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// isDialError returns true if the connection couldn't be established, so the request wasn't sent.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// delay returns the time to wait before the next attempt, which is `Retry-After` if it is set,
+// otherwise the exponential backoff with jitter.
+func (policy *RetryPolicy) delay(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if delay, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+			return min(delay, policy.maxBackoff)
+		}
+	}
+	delay := policy.maxBackoff
+	if attempt <= 30 {
+		delay = policy.backoff << (attempt - 1)
+	}
+	if delay < 0 || delay > policy.maxBackoff {
+		delay = policy.maxBackoff
+	}
+	// Equal jitter: half of the delay is fixed and the other half is random
+	half := int64(delay / 2)
+	if half == 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half))
+}
+
+// parseRetryAfter parses `Retry-After` in either delay-seconds or HTTP-date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// drainBody reads the rest of the response body and closes it so that the connection can be reused.
+func drainBody(res *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+	res.Body.Close()
+}
@@ -0,0 +1,200 @@
+package platform_test
+
+import (
+	"context"
+	"errors"
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	config := utils.Config{RetryMaxBackoff: 1, RetryStatusCodes: "429,503"}
+	testCases := []struct {
+		name          string
+		method        string
+		attempts      int
+		statusCodes   []int
+		retryAfter    string
+		checkResponse func(res *http.Response, err error, numRequests int32, elapsed time.Duration)
+	}{
+		{
+			name:        "Retry until success",
+			method:      "PUT",
+			attempts:    3,
+			statusCodes: []int{503, 503, 200},
+			checkResponse: func(res *http.Response, err error, numRequests int32, elapsed time.Duration) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.Equal(t, int32(3), numRequests)
+			},
+		},
+		{
+			name:        "Retries run out",
+			method:      "PUT",
+			attempts:    2,
+			statusCodes: []int{503, 503, 200},
+			checkResponse: func(res *http.Response, err error, numRequests int32, elapsed time.Duration) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+				require.Equal(t, int32(2), numRequests)
+			},
+		},
+		{
+			name:        "Not retryable",
+			method:      "PUT",
+			attempts:    3,
+			statusCodes: []int{502, 200},
+			checkResponse: func(res *http.Response, err error, numRequests int32, elapsed time.Duration) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusBadGateway, res.StatusCode)
+				require.Equal(t, int32(1), numRequests)
+			},
+		},
+		{
+			name:        "Retry-After",
+			method:      "PUT",
+			attempts:    2,
+			statusCodes: []int{429, 200},
+			retryAfter:  "1",
+			checkResponse: func(res *http.Response, err error, numRequests int32, elapsed time.Duration) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.GreaterOrEqual(t, elapsed, time.Second)
+			},
+		},
+		{
+			name:        "POST not replayed",
+			method:      "POST",
+			attempts:    3,
+			statusCodes: []int{503, 200},
+			checkResponse: func(res *http.Response, err error, numRequests int32, elapsed time.Duration) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+				require.Equal(t, int32(1), numRequests)
+			},
+		},
+		{
+			name:        "POST rejected by 429",
+			method:      "POST",
+			attempts:    3,
+			statusCodes: []int{429, 200},
+			checkResponse: func(res *http.Response, err error, numRequests int32, elapsed time.Duration) {
+				require.NoError(t, err)
+				require.Equal(t, http.StatusOK, res.StatusCode)
+				require.Equal(t, int32(2), numRequests)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			var numRequests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// The body is sent again in each attempt
+				body, _ := io.ReadAll(r.Body)
+				require.Equal(t, "data", string(body))
+				n := atomic.AddInt32(&numRequests, 1)
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				w.WriteHeader(tc.statusCodes[n-1])
+			}))
+			defer server.Close()
+
+			policy := platform.NewRetryPolicy("test", tc.attempts, 0.01, config)
+			req, err := http.NewRequestWithContext(
+				context.Background(), tc.method, server.URL, strings.NewReader("data"))
+			require.NoError(t, err)
+			startTime := time.Now()
+			res, err := policy.Do(&http.Client{}, req)
+			if res != nil {
+				defer res.Body.Close()
+			}
+			tc.checkResponse(res, err, atomic.LoadInt32(&numRequests), time.Since(startTime))
+		})
+	}
+}
+
+func TestRetryPolicyConnectionError(t *testing.T) {
+	config := utils.Config{RetryMaxBackoff: 1}
+	testCases := []struct {
+		name          string
+		method        string
+		failDial      bool
+		checkResponse func(err error, numRequests int32, numDials int32)
+	}{
+		{
+			name:   "POST not replayed after the body was sent",
+			method: "POST",
+			checkResponse: func(err error, numRequests int32, numDials int32) {
+				require.Error(t, err)
+				require.Equal(t, int32(1), numRequests)
+			},
+		},
+		{
+			name:   "GET retried",
+			method: "GET",
+			checkResponse: func(err error, numRequests int32, numDials int32) {
+				require.Error(t, err)
+				require.Equal(t, int32(3), numRequests)
+			},
+		},
+		{
+			name:     "POST retried after a dial error",
+			method:   "POST",
+			failDial: true,
+			checkResponse: func(err error, numRequests int32, numDials int32) {
+				require.Error(t, err)
+				require.Equal(t, int32(0), numRequests)
+				require.Equal(t, int32(3), numDials)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			var numRequests, numDials int32
+			// The connection is closed after the request is read, e.g., the response header timed out
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.ReadAll(r.Body)
+				atomic.AddInt32(&numRequests, 1)
+				conn, _, err := w.(http.Hijacker).Hijack()
+				require.NoError(t, err)
+				conn.Close()
+			}))
+			defer server.Close()
+
+			transport := &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					atomic.AddInt32(&numDials, 1)
+					if tc.failDial {
+						return nil, &net.OpError{Op: "dial", Net: network, Err: errors.New("connection refused")}
+					}
+					return (&net.Dialer{}).DialContext(ctx, network, addr)
+				},
+			}
+			policy := platform.NewRetryPolicy("test", 3, 0.01, config)
+			req, err := http.NewRequestWithContext(
+				context.Background(), tc.method, server.URL, strings.NewReader("data"))
+			require.NoError(t, err)
+			res, err := policy.Do(&http.Client{Transport: transport}, req)
+			if res != nil {
+				res.Body.Close()
+			}
+			tc.checkResponse(err, atomic.LoadInt32(&numRequests), atomic.LoadInt32(&numDials))
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+)
+
+// Route maps a model name or a glob pattern (e.g., `sdxl-*`) to a platform name.
+type Route struct {
+	Model    string `json:"model"`
+	Platform string `json:"platform"`
+}
+
+// RoutingTable is loaded from the JSON file specified by `ROUTER_CONFIG_PATH`, e.g.,
+//
+//	{
+//	  "routes": [
+//	    {"model": "llama-2-7b", "platform": "openai"},
+//	    {"model": "sdxl-*", "platform": "kserve"}
+//	  ],
+//	  "default": "replicate"
+//	}
+type RoutingTable struct {
+	Routes  []Route `json:"routes"`
+	Default string  `json:"default"`
+}
+
+// Router dispatches each request to one of the configured backends by the model name.
+// Exact matches take precedence over glob patterns, which are checked in order.
+type Router struct {
+	exact    map[string]Platform
+	patterns []patternRoute
+	fallback Platform
+	// The backends indexed by the platform name
+	backends map[string]Platform
+}
+
+type patternRoute struct {
+	pattern  string
+	platform Platform
+}
+
+func LoadRoutingTable(filepath string) (*RoutingTable, error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing table: %w", err)
+	}
+	var table RoutingTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("failed to parse routing table: %w", err)
+	}
+	return &table, nil
+}
+
+func NewRouter(config utils.Config, limits RateLimitStore) (Platform, error) {
+	return newRouter("router", config, limits)
+}
+
+func newRouter(route string, config utils.Config, limits RateLimitStore) (Platform, error) {
+	if config.RouterConfigPath == "" {
+		return nil, errors.New("ROUTER_CONFIG_PATH is not set")
+	}
+	table, err := LoadRoutingTable(config.RouterConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewRouterFromTable(table, func(name string) (Platform, error) {
+		if name == "router" {
+			return nil, errors.New("a router cannot route to another router")
+		}
+		return newPlatform(route, name, config, limits)
+	})
+}
+
+// NewRouterFromTable creates a router given the routing table and the function
+// creating a backend by the platform name. Each backend is only created once.
+func NewRouterFromTable(table *RoutingTable, newPlatform func(name string) (Platform, error)) (*Router, error) {
+	router := Router{exact: make(map[string]Platform)}
+	platforms := make(map[string]Platform)
+	getPlatform := func(name string) (Platform, error) {
+		if p, ok := platforms[name]; ok {
+			return p, nil
+		}
+		p, err := newPlatform(name)
+		if err != nil {
+			return nil, err
+		}
+		platforms[name] = p
+		return p, nil
+	}
+
+	for _, route := range table.Routes {
+		if route.Model == "" || route.Platform == "" {
+			return nil, errors.New("both `model` and `platform` must be set in a route")
+		}
+		if _, err := path.Match(route.Model, ""); err != nil {
+			return nil, fmt.Errorf("invalid model pattern %s: %w", route.Model, err)
+		}
+		p, err := getPlatform(route.Platform)
+		if err != nil {
+			return nil, err
+		}
+		if isPattern(route.Model) {
+			router.patterns = append(router.patterns, patternRoute{pattern: route.Model, platform: p})
+		} else {
+			router.exact[route.Model] = p
+		}
+		log.Info().Msgf("route model %s to %s", route.Model, route.Platform)
+	}
+	if table.Default != "" {
+		p, err := getPlatform(table.Default)
+		if err != nil {
+			return nil, err
+		}
+		router.fallback = p
+		log.Info().Msgf("route the other models to %s", table.Default)
+	}
+	router.backends = platforms
+	return &router, nil
+}
+
+func isPattern(model string) bool {
+	for i := 0; i < len(model); i++ {
+		switch model[i] {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+	return false
+}
+
+func (router *Router) route(modelName string) (Platform, *RequestError) {
+	if p, ok := router.exact[modelName]; ok {
+		return p, nil
+	}
+	for _, r := range router.patterns {
+		if matched, _ := path.Match(r.pattern, modelName); matched {
+			return r.platform, nil
+		}
+	}
+	if router.fallback != nil {
+		return router.fallback, nil
+	}
+	return nil, NewRequestError(UnknownModelError,
+		fmt.Errorf("model-name: %s, no platform is configured for this model", modelName))
+}
+
+func (router *Router) Predict(
+	ctx context.Context,
+	request *InferRequest,
+	version string,
+) (*InferResponse, *RequestError) {
+	p, e := router.route(request.ModelName)
+	if e != nil {
+		return nil, e
+	}
+	return p.Predict(ctx, request, version)
+}
+
+func (router *Router) Generate(
+	request *InferRequest,
+	version string,
+	ctx context.Context,
+	encoder *json.Encoder,
+	flusher http.Flusher,
+) *RequestError {
+	p, e := router.route(request.ModelName)
+	if e != nil {
+		return e
+	}
+	return p.Generate(request, version, ctx, encoder, flusher)
+}
+
+func (router *Router) Docs(request *DocsRequest) (*ModelSchema, *RequestError) {
+	p, e := router.route(request.ModelName)
+	if e != nil {
+		return nil, e
+	}
+	return p.Docs(request)
+}
+
+func (router *Router) Cancel(request *CancelRequest) *RequestError {
+	p, e := router.route(request.ModelName)
+	if e != nil {
+		return e
+	}
+	return p.Cancel(request)
+}
+
+// CheckHealth returns an error if none of the backends is healthy,
+// since the healthy ones can still serve the requests.
+func (router *Router) CheckHealth(ctx context.Context) error {
+	names := make([]string, 0, len(router.backends))
+	for name := range router.backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	backends := make([]Platform, len(names))
+	for i, name := range names {
+		backends[i] = router.backends[name]
+	}
+	return checkAnyHealthy(ctx, names, backends)
+}
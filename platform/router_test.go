@@ -0,0 +1,171 @@
+package platform_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/platform"
+	mockplatform "github.com/HyperGAI/serving-agent/platform/mock"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	table := &platform.RoutingTable{
+		Routes: []platform.Route{
+			{Model: "llama-*", Platform: "openai"},
+			{Model: "llama-sd", Platform: "kserve"},
+			{Model: "sdxl-?", Platform: "kserve"},
+		},
+	}
+	testCases := []struct {
+		name          string
+		modelName     string
+		fallback      string
+		buildStubs    func(backends map[string]*mockplatform.MockPlatform)
+		checkResponse func(err *platform.RequestError)
+	}{
+		{
+			name:      "Exact match",
+			modelName: "llama-sd",
+			buildStubs: func(backends map[string]*mockplatform.MockPlatform) {
+				backends["kserve"].EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(1).
+					Return(&platform.InferResponse{}, nil)
+				backends["openai"].EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(err *platform.RequestError) {
+				require.Nil(t, err)
+			},
+		},
+		{
+			name:      "Pattern match",
+			modelName: "llama-2-7b",
+			buildStubs: func(backends map[string]*mockplatform.MockPlatform) {
+				backends["openai"].EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(1).
+					Return(&platform.InferResponse{}, nil)
+				backends["kserve"].EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(err *platform.RequestError) {
+				require.Nil(t, err)
+			},
+		},
+		{
+			name:      "Default",
+			modelName: "sdxl-10",
+			fallback:  "replicate",
+			buildStubs: func(backends map[string]*mockplatform.MockPlatform) {
+				backends["replicate"].EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(1).
+					Return(&platform.InferResponse{}, nil)
+			},
+			checkResponse: func(err *platform.RequestError) {
+				require.Nil(t, err)
+			},
+		},
+		{
+			name:      "Unknown model",
+			modelName: "sdxl-10",
+			buildStubs: func(backends map[string]*mockplatform.MockPlatform) {
+				backends["kserve"].EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(err *platform.RequestError) {
+				require.NotNil(t, err)
+				require.Equal(t, platform.UnknownModelError, err.StatusCode)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			backends := map[string]*mockplatform.MockPlatform{
+				"openai":    mockplatform.NewMockPlatform(ctrl),
+				"kserve":    mockplatform.NewMockPlatform(ctrl),
+				"replicate": mockplatform.NewMockPlatform(ctrl),
+			}
+			tc.buildStubs(backends)
+
+			table.Default = tc.fallback
+			router, err := platform.NewRouterFromTable(table, func(name string) (platform.Platform, error) {
+				return backends[name], nil
+			})
+			require.NoError(t, err)
+			_, e := router.Predict(context.Background(), &platform.InferRequest{ModelName: tc.modelName}, "v1")
+			tc.checkResponse(e)
+		})
+	}
+}
+
+func TestRouterBackends(t *testing.T) {
+	kserve := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// KServe models upload the files by themselves
+		var inputs map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&inputs))
+		require.Equal(t, "http://localhost:12000/upload", inputs["upload_webhook"])
+		_, _ = fmt.Fprint(w, `{"predictions": [1]}`)
+	}))
+	defer kserve.Close()
+	openai := newOpenAIServer(t)
+	defer openai.Close()
+
+	tablePath := filepath.Join(t.TempDir(), "router.json")
+	table := `{"routes": [{"model": "sdxl", "platform": "kserve"}, {"model": "test_model", "platform": "failover"}]}`
+	require.NoError(t, os.WriteFile(tablePath, []byte(table), 0644))
+	config := utils.Config{
+		RouterConfigPath:          tablePath,
+		FailoverPlatforms:         "openai,kserve",
+		KServeAddress:             strings.TrimPrefix(kserve.URL, "http://"),
+		KServeRequestTimeout:      10,
+		OpenAIAddress:             openai.URL,
+		OpenAIRequestTimeout:      10,
+		UploadWebhookAddress:      "localhost:12000",
+		CircuitBreakerThreshold:   5,
+		CircuitBreakerOpenTimeout: 30,
+	}
+	router, err := platform.NewPlatform("router", config, nil)
+	require.NoError(t, err)
+	service, err := platform.NewTransformer(config, router)
+	require.NoError(t, err)
+
+	// The upload webhook is only passed to the backend serving the model if it uses it
+	for _, modelName := range []string{"sdxl", "test_model"} {
+		request := &platform.InferRequest{
+			ModelName: modelName,
+			Inputs:    map[string]interface{}{"messages": []map[string]string{{"role": "user", "content": "Hi"}}},
+		}
+		_, e := service.Predict(context.Background(), request, "v1")
+		require.Nil(t, e)
+	}
+
+	// KServe has a circuit breaker in each route
+	states := platform.CircuitBreakerStates()
+	for _, name := range []string{"router/kserve", "router/failover/openai", "router/failover/kserve"} {
+		require.Equal(t, platform.CircuitClosed, states[name])
+	}
+}
+
+func TestRouterInvalidTable(t *testing.T) {
+	newPlatform := func(name string) (platform.Platform, error) {
+		return nil, errors.New("unknown platform")
+	}
+	_, err := platform.NewRouterFromTable(&platform.RoutingTable{
+		Routes: []platform.Route{{Model: "test", Platform: "unknown"}},
+	}, newPlatform)
+	require.Error(t, err)
+
+	_, err = platform.NewRouterFromTable(&platform.RoutingTable{
+		Routes: []platform.Route{{Model: "[test", Platform: "kserve"}},
+	}, newPlatform)
+	require.Error(t, err)
+}
@@ -10,45 +10,77 @@ import (
 	"github.com/rs/zerolog/log"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
 type RunPod struct {
-	address string
-	apikey  string
-	modelID string
-	timeout int
+	address   string
+	apikey    string
+	modelID   string
+	schemaDir string
+	timeout   int
+	retry     *RetryPolicy
+	transport http.RoundTripper
 }
 
-func NewRunPod(config utils.Config) Platform {
+func NewRunPod(config utils.Config, limits RateLimitStore) Platform {
 	return &RunPod{
-		address: config.RunPodAddress,
-		apikey:  config.RunPodAPIKey,
-		modelID: config.RunPodModelID,
-		timeout: config.RunPodRequestTimeout,
+		address:   config.RunPodAddress,
+		apikey:    config.RunPodAPIKey,
+		modelID:   config.RunPodModelID,
+		schemaDir: config.RunPodSchemaDir,
+		timeout:   config.RunPodRequestTimeout,
+		retry: NewRetryPolicy("runpod",
+			config.RunPodRetryAttempts, config.RunPodRetryBackoff, config),
+		transport: NewRateLimitedTransport("runpod", config.RunPodAPIKey, map[string]float64{
+			RateLimitCreate: config.RunPodCreateRateLimit,
+			RateLimitPoll:   config.RunPodPollRateLimit,
+		}, classifyRunPodRequest, limits, SharedTransport(config)),
 	}
 }
 
+// classifyRunPodRequest returns the rate limit class of the request. RunPod limits `/run` and `/runsync`
+// separately from `/status` and the other operations.
+// https://docs.runpod.io/serverless/endpoints/send-requests
+func classifyRunPodRequest(req *http.Request) string {
+	if strings.HasSuffix(req.URL.Path, "/run") || strings.HasSuffix(req.URL.Path, "/runsync") {
+		return RateLimitCreate
+	}
+	return RateLimitPoll
+}
+
 func (service *RunPod) sendRequest(
+	ctx context.Context,
 	method string,
 	address string,
 	body io.Reader,
 	timeout time.Duration,
 ) (*http.Response, *RequestError) {
 	// Build a new prediction request
-	req, err := http.NewRequest(method, address, body)
+	req, err := http.NewRequestWithContext(ctx, method, address, body)
 	if err != nil {
 		return nil, NewRequestError(BuildRequestError,
 			errors.New("failed to build request"))
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", service.apikey))
+	setRequestTimeout(ctx, req)
 
 	// Send the prediction request
-	client := http.Client{Timeout: timeout}
-	res, err := client.Do(req)
+	client := http.Client{Transport: service.transport, Timeout: timeout}
+	res, err := service.retry.Do(&client, req)
 	if err != nil {
-		return nil, NewRequestError(SendRequestError,
+		if ctx.Err() != nil {
+			return nil, NewRequestError(contextErrorCode(ctx),
+				fmt.Errorf("request aborted: %v", ctx.Err()))
+		}
+		if e, ok := rateLimitRequestError(err); ok {
+			return nil, e
+		}
+		return nil, NewRequestError(sendErrorCode(err),
 			errors.New("failed to send request, model not ready"))
 	}
 	if res.StatusCode > 300 {
@@ -60,15 +92,15 @@ func (service *RunPod) sendRequest(
 			log.Error().Msgf("failed to read error message: %v", e)
 		}
 		res.Body.Close()
-		return nil, NewRequestError(InvalidInputError,
-			fmt.Errorf("invalid inputs: %v", errorMessage))
+		return nil, NewUpstreamError(res,
+			fmt.Errorf("status-code: %d, error: %v", res.StatusCode, errorMessage))
 	}
 	return res, nil
 }
 
-func (service *RunPod) Predict(request *InferRequest, version string) (*InferResponse, *RequestError) {
+// submitJob submits a new job via `/run` and returns the job ID.
+func (service *RunPod) submitJob(ctx context.Context, request *InferRequest) (string, *RequestError) {
 	inputs := request.Inputs
-	delete(inputs, "upload_webhook")
 	replicateInput := map[string]interface{}{
 		"input": inputs,
 	}
@@ -76,54 +108,86 @@ func (service *RunPod) Predict(request *InferRequest, version string) (*InferRes
 	// Marshal the input data
 	data, err := json.Marshal(replicateInput)
 	if err != nil {
-		return nil, NewRequestError(MarshalError,
+		return "", NewRequestError(MarshalError,
 			errors.New("failed to marshal request"))
 	}
 
 	// Send a new prediction request
 	address := fmt.Sprintf("%s/%s/run", service.address, service.modelID)
 	res, e := service.sendRequest(
-		"POST", address, bytes.NewReader(data),
+		ctx, "POST", address, bytes.NewReader(data),
 		time.Duration(service.timeout)*time.Second,
 	)
 	if e != nil {
-		return nil, e
+		return "", e
 	}
 
 	// Parse the response
 	defer res.Body.Close()
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		return nil, NewRequestError(ReadResponseError,
+		return "", NewRequestError(ReadResponseError,
 			errors.New("failed to read response body"))
 	}
 	var outputs map[string]interface{}
 	err = json.Unmarshal(body, &outputs)
 	if err != nil {
-		return nil, NewRequestError(UnmarshalResponseError,
+		return "", NewRequestError(UnmarshalResponseError,
 			errors.New("failed to unmarshal response body"))
 	}
 	if res.StatusCode >= 300 {
-		return nil, NewRequestError(InternalError,
+		return "", NewRequestError(InternalError,
 			fmt.Errorf("predict failed: %s", outputs))
 	}
 
 	val, ok := outputs["id"]
 	if !ok {
-		return nil, NewRequestError(ReadResponseError,
+		return "", NewRequestError(ReadResponseError,
 			errors.New("failed to read runpod job id"))
 	}
-	jobID := fmt.Sprintf("%s", val)
+	return fmt.Sprintf("%s", val), nil
+}
+
+// cancelJob cancels the job so that it is no longer billed. It is detached from the caller,
+// e.g., the client has disconnected.
+func (service *RunPod) cancelJob(jobID string) *RequestError {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	address := fmt.Sprintf("%s/%s/cancel/%s", service.address, service.modelID, jobID)
+	res, e := service.sendRequest(ctx, "POST", address, nil, 10*time.Second)
+	if e != nil {
+		log.Error().Msgf("failed to cancel runpod job %s: %v", jobID, e)
+		return e
+	}
+	res.Body.Close()
+	log.Info().Msgf("canceled runpod job %s", jobID)
+	return nil
+}
+
+func (service *RunPod) Predict(
+	ctx context.Context,
+	request *InferRequest,
+	version string,
+) (*InferResponse, *RequestError) {
+	jobID, e := service.submitJob(ctx, request)
+	if e != nil {
+		return nil, e
+	}
+	notifySubmitted(request, jobID)
+	var outputs map[string]interface{}
 	// https://api.runpod.ai/v2/stable-diffusion-v1/status/c80ffee4-f315-4e25-a146-0f3d
 	statusURL := fmt.Sprintf("%s/%s/status/%s", service.address, service.modelID, jobID)
 
 	for i := 0; i < service.timeout; i++ {
 		statusResponse, e := service.sendRequest(
-			"GET", statusURL, nil,
+			ctx, "GET", statusURL, nil,
 			time.Duration(service.timeout)*time.Second,
 		)
 		if e != nil {
-			return nil, e
+			if e = waitThrottledPoll(ctx, e); e != nil {
+				return nil, e
+			}
+			continue
 		}
 
 		// Parse the prediction status
@@ -158,17 +222,37 @@ func (service *RunPod) Predict(request *InferRequest, version string) (*InferRes
 			} else if status == "FAILED" {
 				return nil, NewRequestError(InternalError,
 					fmt.Errorf("predict failed: %s", outputs))
+			} else if status == "CANCELLED" {
+				return nil, NewRequestError(CanceledError,
+					errors.New("job canceled"))
+			} else if status == "TIMED_OUT" {
+				return nil, NewRequestError(TimeoutError,
+					errors.New("job timed out"))
+			}
+			if !sleepContext(ctx, time.Second) {
+				return nil, NewRequestError(contextErrorCode(ctx),
+					fmt.Errorf("predict aborted: %v", ctx.Err()))
 			}
-			time.Sleep(time.Second)
 
 		} else {
 			return nil, NewRequestError(InternalError,
 				fmt.Errorf("predict failed: %s", outputs))
 		}
 	}
-	return nil, NewRequestError(InternalError, errors.New("predict timeout"))
+	return nil, NewRequestError(TimeoutError, errors.New("predict timeout"))
+}
+
+type runPodStreamResponse struct {
+	Status string `json:"status"`
+	Stream []struct {
+		Output interface{} `json:"output"`
+	} `json:"stream"`
+	Error interface{} `json:"error"`
 }
 
+// Generate submits a job via `/run` and polls `/stream/{job_id}` for the incremental outputs
+// until the job finishes. The job is canceled if the client disconnects.
+// https://docs.runpod.io/serverless/endpoints/job-operations#stream-results
 func (service *RunPod) Generate(
 	request *InferRequest,
 	version string,
@@ -176,10 +260,116 @@ func (service *RunPod) Generate(
 	encoder *json.Encoder,
 	flusher http.Flusher,
 ) *RequestError {
-	return NewRequestError(UnknownAPIVersion,
-		errors.New("generation API for RunPod is not supported"))
+	jobID, e := service.submitJob(ctx, request)
+	if e != nil {
+		return e
+	}
+	notifySubmitted(request, jobID)
+	streamURL := fmt.Sprintf("%s/%s/stream/%s", service.address, service.modelID, jobID)
+	deadline := time.Now().Add(time.Duration(service.timeout) * time.Second)
+
+	id := 0
+	for time.Now().Before(deadline) {
+		if ctx.Err() != nil {
+			log.Info().Msgf("client stopped listening")
+			service.cancelJob(jobID)
+			return NewRequestError(SendRequestError,
+				errors.New("client stopped listening"))
+		}
+
+		res, e := service.sendRequest(
+			ctx, "GET", streamURL, nil,
+			time.Duration(service.timeout)*time.Second,
+		)
+		if e != nil {
+			service.cancelJob(jobID)
+			return e
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			service.cancelJob(jobID)
+			return NewRequestError(ReadResponseError,
+				errors.New("failed to read response body"))
+		}
+		var outputs runPodStreamResponse
+		if err := json.Unmarshal(body, &outputs); err != nil {
+			service.cancelJob(jobID)
+			return NewRequestError(UnmarshalResponseError,
+				errors.New("failed to unmarshal response body"))
+		}
+
+		for _, chunk := range outputs.Stream {
+			var data string
+			if text, ok := chunk.Output.(string); ok {
+				data = text
+			} else {
+				b, _ := json.Marshal(chunk.Output)
+				data = string(b)
+			}
+			if err := encoder.Encode(StreamingMessage{Id: id, Event: "output", Data: data}); err != nil {
+				service.cancelJob(jobID)
+				return NewRequestError(SendRequestError,
+					fmt.Errorf("failed to encode request: %v", err))
+			}
+			flusher.Flush()
+			id += 1
+		}
+
+		switch outputs.Status {
+		case "COMPLETED":
+			return nil
+		case "FAILED":
+			return NewRequestError(InternalError,
+				fmt.Errorf("predict failed: %v", outputs.Error))
+		case "CANCELLED":
+			return NewRequestError(CanceledError,
+				errors.New("job canceled"))
+		case "TIMED_OUT":
+			return NewRequestError(TimeoutError,
+				fmt.Errorf("job timed out: %v", outputs.Error))
+		}
+		// Wait for a while if there are no new outputs, the context is checked in the next iteration
+		if len(outputs.Stream) == 0 {
+			sleepContext(ctx, 500*time.Millisecond)
+		}
+	}
+	service.cancelJob(jobID)
+	return NewRequestError(TimeoutError, errors.New("predict timeout"))
+}
+
+// Docs returns the model schema read from `{RUNPOD_SCHEMA_DIR}/{endpoint}.json`, since RunPod
+// doesn't provide the schemas of the endpoints.
+func (service *RunPod) Docs(request *DocsRequest) (*ModelSchema, *RequestError) {
+	if service.schemaDir == "" {
+		return nil, NewRequestError(InternalError,
+			errors.New("RUNPOD_SCHEMA_DIR is not set"))
+	}
+	data, err := os.ReadFile(filepath.Join(service.schemaDir, service.modelID+".json"))
+	if err != nil {
+		return nil, NewRequestError(InternalError,
+			fmt.Errorf("failed to read the schema of endpoint %s: %v", service.modelID, err))
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, NewRequestError(UnmarshalResponseError,
+			fmt.Errorf("failed to unmarshal the schema of endpoint %s: %v", service.modelID, err))
+	}
+	schema := newModelSchema(request.ModelName, "runpod", document)
+	if schema.Metadata == nil {
+		schema.Metadata = make(map[string]interface{})
+	}
+	schema.Metadata["endpoint"] = service.modelID
+	return schema, nil
+}
+
+// CheckHealth checks if the endpoint is reachable via `/{endpoint}/health`.
+func (service *RunPod) CheckHealth(ctx context.Context) error {
+	url := fmt.Sprintf("%s/%s/health", service.address, service.modelID)
+	header := http.Header{"Authorization": []string{fmt.Sprintf("Bearer %s", service.apikey)}}
+	return probeOK(ctx, service.transport, url, header)
 }
 
-func (service *RunPod) Docs(request *DocsRequest) (interface{}, *RequestError) {
-	return "", nil
+func (service *RunPod) Cancel(request *CancelRequest) *RequestError {
+	return service.cancelJob(request.UpstreamID)
 }
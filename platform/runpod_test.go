@@ -0,0 +1,138 @@
+package platform_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunPodGenerate(t *testing.T) {
+	var numPolls, numCancels int32
+	// Simulates a client disconnecting after the job is submitted
+	var disconnect context.CancelFunc
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/endpoint/run":
+			_, _ = fmt.Fprint(w, `{"id": "job", "status": "IN_QUEUE"}`)
+		case "/endpoint/stream/job":
+			if disconnect != nil {
+				disconnect()
+				_, _ = fmt.Fprint(w, `{"status": "IN_PROGRESS", "stream": []}`)
+			} else if atomic.AddInt32(&numPolls, 1) == 1 {
+				_, _ = fmt.Fprint(w, `{"status": "IN_PROGRESS", "stream": [{"output": "Hello"}]}`)
+			} else {
+				_, _ = fmt.Fprint(w, `{"status": "COMPLETED", "stream": [{"output": " world"}]}`)
+			}
+		case "/endpoint/cancel/job":
+			atomic.AddInt32(&numCancels, 1)
+			_, _ = fmt.Fprint(w, `{"id": "job", "status": "CANCELLED"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	service := platform.NewRunPod(utils.Config{
+		RunPodAddress:        server.URL,
+		RunPodModelID:        "endpoint",
+		RunPodRequestTimeout: 10,
+	}, nil)
+	var upstreamID string
+	request := &platform.InferRequest{
+		ModelName:   "test_model",
+		Inputs:      map[string]interface{}{"prompt": "Hi"},
+		OnSubmitted: func(id string) { upstreamID = id },
+	}
+
+	recorder := httptest.NewRecorder()
+	err := service.Generate(request, "v1", context.Background(), json.NewEncoder(recorder), recorder)
+	require.Nil(t, err)
+	require.Equal(t, "job", upstreamID)
+	decoder := json.NewDecoder(strings.NewReader(recorder.Body.String()))
+	var tokens []string
+	for decoder.More() {
+		var m platform.StreamingMessage
+		require.NoError(t, decoder.Decode(&m))
+		tokens = append(tokens, m.Data)
+	}
+	require.Equal(t, []string{"Hello", " world"}, tokens)
+	require.Equal(t, int32(0), atomic.LoadInt32(&numCancels))
+
+	// The job is canceled if the client disconnects
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	disconnect = cancel
+	recorder = httptest.NewRecorder()
+	err = service.Generate(request, "v1", ctx, json.NewEncoder(recorder), recorder)
+	require.NotNil(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&numCancels))
+}
+
+func TestRunPodGenerateStatus(t *testing.T) {
+	testCases := []struct {
+		status     string
+		statusCode int
+	}{
+		{status: "FAILED", statusCode: platform.InternalError},
+		{status: "CANCELLED", statusCode: platform.CanceledError},
+		{status: "TIMED_OUT", statusCode: platform.TimeoutError},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.status, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/endpoint/run":
+					_, _ = fmt.Fprint(w, `{"id": "job", "status": "IN_QUEUE"}`)
+				case "/endpoint/stream/job":
+					_, _ = fmt.Fprintf(w, `{"status": "%s", "stream": []}`, tc.status)
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer server.Close()
+
+			service := platform.NewRunPod(utils.Config{
+				RunPodAddress:        server.URL,
+				RunPodModelID:        "endpoint",
+				RunPodRequestTimeout: 10,
+			}, nil)
+			request := &platform.InferRequest{ModelName: "test_model", Inputs: map[string]interface{}{}}
+			recorder := httptest.NewRecorder()
+			err := service.Generate(request, "v1", context.Background(), json.NewEncoder(recorder), recorder)
+			require.NotNil(t, err)
+			require.Equal(t, tc.statusCode, err.StatusCode)
+		})
+	}
+}
+
+func TestRunPodDocs(t *testing.T) {
+	dir := t.TempDir()
+	document := `{"inputs": {"type": "object", "properties": {"prompt": {"type": "string"}}, "required": ["prompt"]},
+		"outputs": {"type": "object", "properties": {"image": {"type": "string", "format": "uri"}}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "endpoint.json"), []byte(document), 0644))
+
+	service := platform.NewRunPod(utils.Config{RunPodModelID: "endpoint", RunPodSchemaDir: dir}, nil)
+	schema, err := service.Docs(&platform.DocsRequest{ModelName: "test_model"})
+	require.Nil(t, err)
+	require.Equal(t, []platform.FieldSchema{{Name: "prompt", Type: "string", Required: true}}, schema.Inputs)
+	require.Equal(t, []platform.FieldSchema{{Name: "image", Type: "string", Format: "uri"}}, schema.Outputs)
+
+	// The missing schema is a config error of the agent instead of an invalid request
+	service = platform.NewRunPod(utils.Config{RunPodModelID: "unknown", RunPodSchemaDir: dir}, nil)
+	_, err = service.Docs(&platform.DocsRequest{ModelName: "test_model"})
+	require.NotNil(t, err)
+	require.Equal(t, platform.InternalError, err.StatusCode)
+}
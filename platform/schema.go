@@ -0,0 +1,203 @@
+package platform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ModelSchema is the model schema returned by `Docs`, which has the same shape for all the platforms
+// so that the input forms can be rendered regardless of the backend.
+type ModelSchema struct {
+	ModelName   string        `json:"model_name"`
+	Platform    string        `json:"platform"`
+	Description string        `json:"description,omitempty"`
+	Inputs      []FieldSchema `json:"inputs"`
+	Outputs     []FieldSchema `json:"outputs"`
+	// The platform-specific information, e.g., the original document returned by the platform
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// FieldSchema describes an input or output field. `Type` is one of the JSON schema types, i.e.,
+// string, integer, number, boolean, array or object. Files are strings with the `uri` format.
+type FieldSchema struct {
+	Name        string        `json:"name"`
+	Type        string        `json:"type,omitempty"`
+	Format      string        `json:"format,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Required    bool          `json:"required"`
+	Default     interface{}   `json:"default,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+	Minimum     *float64      `json:"minimum,omitempty"`
+	Maximum     *float64      `json:"maximum,omitempty"`
+	Items       *FieldSchema  `json:"items,omitempty"`
+}
+
+// ParseModelSchema converts a schema document into the fields. The document can be
+//  1. An OpenAPI document with `Input` and `Output` components, e.g., generated by Cog.
+//  2. A JSON schema object of the inputs, i.e., with `properties`.
+//  3. An object with `inputs` and `outputs` JSON schemas.
+//
+// It returns false if the document is none of them.
+func ParseModelSchema(document map[string]interface{}) ([]FieldSchema, []FieldSchema, bool) {
+	if components, ok := lookup(document, "components", "schemas").(map[string]interface{}); ok {
+		input, hasInput := components["Input"].(map[string]interface{})
+		output, hasOutput := components["Output"].(map[string]interface{})
+		if hasInput || hasOutput {
+			return objectFields(input, components), outputFields(output, components), true
+		}
+	}
+	if _, ok := document["properties"]; ok {
+		return objectFields(document, nil), []FieldSchema{}, true
+	}
+	input, hasInput := document["inputs"].(map[string]interface{})
+	output, hasOutput := document["outputs"].(map[string]interface{})
+	if hasInput || hasOutput {
+		return objectFields(input, nil), outputFields(output, nil), true
+	}
+	return nil, nil, false
+}
+
+// lookup returns the value of the nested keys, or nil if any key is missing.
+func lookup(document map[string]interface{}, keys ...string) interface{} {
+	var value interface{} = document
+	for _, key := range keys {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// objectFields converts the properties of an object schema into fields ordered by `x-order` and names.
+func objectFields(schema map[string]interface{}, components map[string]interface{}) []FieldSchema {
+	fields := make([]FieldSchema, 0)
+	if schema == nil {
+		return fields
+	}
+	schema = resolveSchema(schema, components)
+	properties, _ := schema["properties"].(map[string]interface{})
+	required := make(map[string]bool)
+	if names, ok := schema["required"].([]interface{}); ok {
+		for _, name := range names {
+			required[fmt.Sprint(name)] = true
+		}
+	}
+
+	orders := make(map[string]float64)
+	for name, property := range properties {
+		object, ok := property.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		field := convertField(name, object, components)
+		field.Required = required[name]
+		fields = append(fields, field)
+		if order, ok := object["x-order"].(float64); ok {
+			orders[name] = order
+		} else {
+			orders[name] = float64(len(properties))
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		a, b := fields[i].Name, fields[j].Name
+		if orders[a] != orders[b] {
+			return orders[a] < orders[b]
+		}
+		return a < b
+	})
+	return fields
+}
+
+// outputFields converts the output schema. An object schema is converted into its properties,
+// otherwise the output is a single field named `output`.
+func outputFields(schema map[string]interface{}, components map[string]interface{}) []FieldSchema {
+	if schema == nil {
+		return make([]FieldSchema, 0)
+	}
+	schema = resolveSchema(schema, components)
+	if _, ok := schema["properties"]; ok {
+		return objectFields(schema, components)
+	}
+	return []FieldSchema{convertField("output", schema, components)}
+}
+
+// resolveSchema resolves `$ref` and merges `allOf`, e.g., Cog defines the enums as
+// `{"allOf": [{"$ref": "#/components/schemas/scheduler"}], "default": "DDIM"}`.
+func resolveSchema(schema map[string]interface{}, components map[string]interface{}) map[string]interface{} {
+	resolved := make(map[string]interface{}, len(schema))
+	if ref, ok := schema["$ref"].(string); ok && components != nil {
+		name := ref[strings.LastIndex(ref, "/")+1:]
+		if target, ok := components[name].(map[string]interface{}); ok {
+			for key, value := range resolveSchema(target, components) {
+				resolved[key] = value
+			}
+		}
+	}
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, item := range allOf {
+			if object, ok := item.(map[string]interface{}); ok {
+				for key, value := range resolveSchema(object, components) {
+					resolved[key] = value
+				}
+			}
+		}
+	}
+	for key, value := range schema {
+		if key != "$ref" && key != "allOf" {
+			resolved[key] = value
+		}
+	}
+	return resolved
+}
+
+func convertField(name string, schema map[string]interface{}, components map[string]interface{}) FieldSchema {
+	schema = resolveSchema(schema, components)
+	field := FieldSchema{Name: name, Default: schema["default"]}
+	field.Type, _ = schema["type"].(string)
+	field.Format, _ = schema["format"].(string)
+	field.Description, _ = schema["description"].(string)
+	if field.Description == "" {
+		field.Description, _ = schema["title"].(string)
+	}
+	field.Enum, _ = schema["enum"].([]interface{})
+	if value, ok := schema["minimum"].(float64); ok {
+		field.Minimum = &value
+	}
+	if value, ok := schema["maximum"].(float64); ok {
+		field.Maximum = &value
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		item := convertField("", items, components)
+		field.Items = &item
+	}
+	return field
+}
+
+// newModelSchema builds the model schema from the document returned by the platform.
+// The document is kept in the metadata if it cannot be parsed.
+func newModelSchema(modelName string, platform string, document interface{}) *ModelSchema {
+	schema := &ModelSchema{
+		ModelName: modelName,
+		Platform:  platform,
+		Inputs:    make([]FieldSchema, 0),
+		Outputs:   make([]FieldSchema, 0),
+	}
+	if object, ok := document.(map[string]interface{}); ok {
+		if inputs, outputs, ok := ParseModelSchema(object); ok {
+			schema.Inputs, schema.Outputs = inputs, outputs
+			if description, ok := lookup(object, "info", "description").(string); ok {
+				schema.Description = description
+			} else {
+				schema.Description, _ = object["description"].(string)
+			}
+			return schema
+		}
+	}
+	if document != nil {
+		schema.Metadata = map[string]interface{}{"document": document}
+	}
+	return schema
+}
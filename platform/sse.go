@@ -0,0 +1,60 @@
+package platform
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+)
+
+// readEvents reads server-sent events (https://html.spec.whatwg.org/multipage/server-sent-events.html)
+// from the reader and calls `handle` for each event. It stops when `handle` returns false,
+// the reader reaches EOF or the context is done.
+func readEvents(
+	ctx context.Context,
+	reader io.Reader,
+	handle func(event string, data string) (bool, error),
+) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := scanner.Text()
+		if line == "" {
+			// An empty line dispatches the event
+			if len(data) > 0 {
+				next, err := handle(event, strings.Join(data, "\n"))
+				if err != nil || !next {
+					return err
+				}
+			}
+			event, data = "", data[:0]
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// Comment line, e.g., keep-alive messages
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		_, err := handle(event, strings.Join(data, "\n"))
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package platform
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TransformRule describes how the inputs and the outputs of a model are transformed, so that
+// the models with different I/O contracts can be onboarded without code changes.
+// `Model` is a model name or a glob pattern. The inputs are transformed in this order:
+//  1. `Rename` renames the input fields, i.e., from the name sent by the client to the one expected by the model.
+//  2. `Defaults` sets the fields missing in the inputs.
+//  3. `Drop` deletes the fields, e.g., `upload_webhook` if the model doesn't upload files by itself.
+//
+// `Defaults` and `Drop` use the field names after renaming. `Outputs` maps the output fields to the paths
+// in the outputs returned by the platform, e.g., `{"image": "output[0]", "seed": "metrics.seed"}`.
+// If it is set, only the mapped fields are returned.
+type TransformRule struct {
+	Model    string                 `json:"model"`
+	Rename   map[string]string      `json:"rename"`
+	Defaults map[string]interface{} `json:"defaults"`
+	Drop     []string               `json:"drop"`
+	Outputs  map[string]string      `json:"outputs"`
+}
+
+// TransformConfig is loaded from the JSON file specified by `TRANSFORM_CONFIG_PATH`, e.g.,
+//
+//	{
+//	  "rules": [
+//	    {"model": "sdxl", "rename": {"text": "prompt"}, "outputs": {"image": "output[0]"}},
+//	    {"model": "llama-*", "defaults": {"max_tokens": 512}, "drop": ["upload_webhook"]}
+//	  ]
+//	}
+type TransformConfig struct {
+	Rules []TransformRule `json:"rules"`
+}
+
+// The outputs added by the agent, which are kept after the outputs are transformed
+var agentOutputs = []string{"running_time", "served_by"}
+
+// dropUploadWebhook is the default rule of the backends that don't upload images or files by themselves,
+// e.g., Replicate and OpenAI, which reject or ignore the unknown inputs.
+var dropUploadWebhook = TransformRule{Model: "*", Drop: []string{"upload_webhook"}}
+
+// Transformer wraps a platform and applies the transformation rule of the model around it.
+// Exact model names take precedence over glob patterns, which are checked in order.
+// The default rule, if any, is applied to the inputs of all the models before the rule of the model,
+// but not to the schemas, since it only carries the inputs set by the agent.
+type Transformer struct {
+	platform Platform
+	defaults *TransformRule
+	exact    map[string]*TransformRule
+	patterns []*TransformRule
+}
+
+func LoadTransformConfig(filepath string) (*TransformConfig, error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transform config: %w", err)
+	}
+	var config TransformConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse transform config: %w", err)
+	}
+	return &config, nil
+}
+
+// NewTransformer wraps the platform with the rules in `TRANSFORM_CONFIG_PATH`. By default, the uploading webhook
+// is set as `upload_webhook` in the inputs, which is dropped by the backends that don't use it, or by the rules.
+// The platform is returned as is if neither of them is set.
+func NewTransformer(config utils.Config, platform Platform) (Platform, error) {
+	var defaults *TransformRule
+	if uploadURL := uploadWebhookURL(config); uploadURL != "" {
+		defaults = &TransformRule{Model: "*", Defaults: map[string]interface{}{"upload_webhook": uploadURL}}
+	}
+	if config.TransformConfigPath == "" {
+		if defaults == nil {
+			return platform, nil
+		}
+		return newDefaultTransformer(platform, defaults), nil
+	}
+	transformConfig, err := LoadTransformConfig(config.TransformConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	transformer, err := NewTransformerFromConfig(transformConfig, platform)
+	if err != nil {
+		return nil, err
+	}
+	transformer.defaults = defaults
+	return transformer, nil
+}
+
+// uploadWebhookURL returns the webhook for uploading images or files, which is the built-in upload service
+// of the artifact hosting if `UPLOAD_WEBHOOK_ADDRESS` is empty.
+func uploadWebhookURL(config utils.Config) string {
+	if config.UploadWebhookAddress != "" {
+		return fmt.Sprintf("http://%s/upload", config.UploadWebhookAddress)
+	}
+	if config.ArtifactBaseURL != "" {
+		return strings.TrimSuffix(config.ArtifactBaseURL, "/") + "/upload"
+	}
+	return ""
+}
+
+// newDefaultTransformer wraps the platform with a rule applied to all the models.
+func newDefaultTransformer(platform Platform, defaults *TransformRule) *Transformer {
+	return &Transformer{platform: platform, defaults: defaults, exact: make(map[string]*TransformRule)}
+}
+
+func NewTransformerFromConfig(config *TransformConfig, platform Platform) (*Transformer, error) {
+	transformer := Transformer{platform: platform, exact: make(map[string]*TransformRule)}
+	for i := range config.Rules {
+		rule := &config.Rules[i]
+		if rule.Model == "" {
+			return nil, errors.New("`model` must be set in a transform rule")
+		}
+		if _, err := path.Match(rule.Model, ""); err != nil {
+			return nil, fmt.Errorf("invalid model pattern %s: %w", rule.Model, err)
+		}
+		for name, outputPath := range rule.Outputs {
+			if _, err := parseOutputPath(outputPath); err != nil {
+				return nil, fmt.Errorf("model %s, output %s: %w", rule.Model, name, err)
+			}
+		}
+		if isPattern(rule.Model) {
+			transformer.patterns = append(transformer.patterns, rule)
+		} else {
+			transformer.exact[rule.Model] = rule
+		}
+		log.Info().Msgf("transform the inputs and outputs of model %s", rule.Model)
+	}
+	return &transformer, nil
+}
+
+func (transformer *Transformer) rule(modelName string) *TransformRule {
+	if rule, ok := transformer.exact[modelName]; ok {
+		return rule
+	}
+	for _, rule := range transformer.patterns {
+		if matched, _ := path.Match(rule.Model, modelName); matched {
+			return rule
+		}
+	}
+	return nil
+}
+
+// transformRequest applies the default rule and then the rule of the model if any.
+func (transformer *Transformer) transformRequest(request *InferRequest, rule *TransformRule) *InferRequest {
+	if transformer.defaults != nil {
+		request = transformer.defaults.transformRequest(request)
+	}
+	if rule != nil {
+		request = rule.transformRequest(request)
+	}
+	return request
+}
+
+// transformRequest returns a copy of the request with the transformed inputs.
+func (rule *TransformRule) transformRequest(request *InferRequest) *InferRequest {
+	inputs := make(map[string]interface{}, len(request.Inputs)+len(rule.Defaults))
+	for key, value := range request.Inputs {
+		if name, ok := rule.Rename[key]; ok {
+			key = name
+		}
+		inputs[key] = value
+	}
+	for key, value := range rule.Defaults {
+		if _, ok := inputs[key]; !ok {
+			inputs[key] = value
+		}
+	}
+	for _, key := range rule.Drop {
+		delete(inputs, key)
+	}
+	return &InferRequest{ModelName: request.ModelName, Inputs: inputs, OnSubmitted: request.OnSubmitted}
+}
+
+// transformOutputs extracts the output fields by the paths. The missing paths are skipped.
+func (rule *TransformRule) transformOutputs(outputs map[string]interface{}) map[string]interface{} {
+	if len(rule.Outputs) == 0 {
+		return outputs
+	}
+	results := make(map[string]interface{}, len(rule.Outputs)+len(agentOutputs))
+	for name, outputPath := range rule.Outputs {
+		value, err := extractPath(outputs, outputPath)
+		if err != nil {
+			log.Warn().Msgf("model %s: failed to extract output %s: %v", rule.Model, name, err)
+			continue
+		}
+		results[name] = value
+	}
+	for _, key := range agentOutputs {
+		if value, ok := outputs[key]; ok {
+			results[key] = value
+		}
+	}
+	return results
+}
+
+// transformSchema converts the schema of the model into the one seen by the clients,
+// i.e., the fields are renamed back, the dropped fields are removed and the defaults are filled.
+func (rule *TransformRule) transformSchema(schema *ModelSchema) *ModelSchema {
+	renamed := make(map[string]string, len(rule.Rename))
+	for from, to := range rule.Rename {
+		renamed[to] = from
+	}
+	dropped := make(map[string]bool, len(rule.Drop))
+	for _, key := range rule.Drop {
+		dropped[key] = true
+	}
+
+	result := *schema
+	result.Inputs = make([]FieldSchema, 0, len(schema.Inputs))
+	for _, field := range schema.Inputs {
+		if value, ok := rule.Defaults[field.Name]; ok {
+			field.Default = value
+			field.Required = false
+		}
+		if dropped[field.Name] {
+			continue
+		}
+		if name, ok := renamed[field.Name]; ok {
+			field.Name = name
+		}
+		result.Inputs = append(result.Inputs, field)
+	}
+	if len(rule.Outputs) > 0 {
+		result.Outputs = make([]FieldSchema, 0, len(rule.Outputs))
+		for name := range rule.Outputs {
+			result.Outputs = append(result.Outputs, FieldSchema{Name: name})
+		}
+		sort.Slice(result.Outputs, func(i, j int) bool {
+			return result.Outputs[i].Name < result.Outputs[j].Name
+		})
+	}
+	return &result
+}
+
+// pathSegment is a key of an object or an index of an array in the output path.
+type pathSegment struct {
+	key   string
+	index int
+}
+
+// parseOutputPath parses the path such as `output[0]`, `metrics.seed` or `images[0].url`.
+func parseOutputPath(outputPath string) ([]pathSegment, error) {
+	segments := make([]pathSegment, 0)
+	for _, part := range strings.Split(outputPath, ".") {
+		key, rest := part, ""
+		if i := strings.Index(part, "["); i >= 0 {
+			key, rest = part[:i], part[i:]
+		}
+		if key == "" {
+			return nil, fmt.Errorf("invalid output path %s", outputPath)
+		}
+		segments = append(segments, pathSegment{key: key, index: -1})
+		for rest != "" {
+			end := strings.Index(rest, "]")
+			if !strings.HasPrefix(rest, "[") || end < 0 {
+				return nil, fmt.Errorf("invalid output path %s", outputPath)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid index in output path %s", outputPath)
+			}
+			segments = append(segments, pathSegment{index: index})
+			rest = rest[end+1:]
+		}
+	}
+	return segments, nil
+}
+
+// extractPath returns the value at the path in the outputs.
+func extractPath(outputs map[string]interface{}, outputPath string) (interface{}, error) {
+	segments, err := parseOutputPath(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{} = outputs
+	for _, segment := range segments {
+		if segment.index < 0 {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s is not an object", segment.key)
+			}
+			if value, ok = object[segment.key]; !ok {
+				return nil, fmt.Errorf("%s is not found", segment.key)
+			}
+			continue
+		}
+		array, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("[%d] is applied to a non-array value", segment.index)
+		}
+		if segment.index >= len(array) {
+			return nil, fmt.Errorf("index %d is out of range", segment.index)
+		}
+		value = array[segment.index]
+	}
+	return value, nil
+}
+
+func (transformer *Transformer) Predict(
+	ctx context.Context,
+	request *InferRequest,
+	version string,
+) (*InferResponse, *RequestError) {
+	rule := transformer.rule(request.ModelName)
+	response, e := transformer.platform.Predict(ctx, transformer.transformRequest(request, rule), version)
+	if e != nil || rule == nil {
+		return response, e
+	}
+	response.Outputs = rule.transformOutputs(response.Outputs)
+	return response, nil
+}
+
+// Generate only transforms the inputs, since the streaming messages are plain texts.
+func (transformer *Transformer) Generate(
+	request *InferRequest,
+	version string,
+	ctx context.Context,
+	encoder *json.Encoder,
+	flusher http.Flusher,
+) *RequestError {
+	request = transformer.transformRequest(request, transformer.rule(request.ModelName))
+	return transformer.platform.Generate(request, version, ctx, encoder, flusher)
+}
+
+func (transformer *Transformer) Docs(request *DocsRequest) (*ModelSchema, *RequestError) {
+	schema, e := transformer.platform.Docs(request)
+	if e != nil {
+		return nil, e
+	}
+	if rule := transformer.rule(request.ModelName); rule != nil {
+		schema = rule.transformSchema(schema)
+	}
+	return schema, nil
+}
+
+func (transformer *Transformer) Cancel(request *CancelRequest) *RequestError {
+	return transformer.platform.Cancel(request)
+}
+
+func (transformer *Transformer) CheckHealth(ctx context.Context) error {
+	return CheckHealth(ctx, transformer.platform)
+}
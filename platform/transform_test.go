@@ -0,0 +1,207 @@
+package platform_test
+
+import (
+	"context"
+	"github.com/HyperGAI/serving-agent/platform"
+	mockplatform "github.com/HyperGAI/serving-agent/platform/mock"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransformer(t *testing.T) {
+	config := &platform.TransformConfig{
+		Rules: []platform.TransformRule{
+			{
+				Model:    "sdxl",
+				Rename:   map[string]string{"text": "prompt"},
+				Defaults: map[string]interface{}{"num_steps": 30.0},
+				Drop:     []string{"upload_webhook"},
+				Outputs:  map[string]string{"image": "output[0]", "seed": "metrics.seed", "url": "files[1].url"},
+			},
+			{Model: "llama-*", Defaults: map[string]interface{}{"max_tokens": 512.0}},
+		},
+	}
+	testCases := []struct {
+		name          string
+		modelName     string
+		inputs        map[string]interface{}
+		outputs       map[string]interface{}
+		checkInputs   func(inputs map[string]interface{})
+		checkResponse func(response *platform.InferResponse, err *platform.RequestError)
+	}{
+		{
+			name:      "Exact match",
+			modelName: "sdxl",
+			inputs:    map[string]interface{}{"text": "a cat", "upload_webhook": "http://localhost/upload"},
+			outputs: map[string]interface{}{
+				"output":       []interface{}{"a.png", "b.png"},
+				"metrics":      map[string]interface{}{"seed": 42.0},
+				"files":        []interface{}{map[string]interface{}{"url": "a"}},
+				"running_time": "1.0s",
+			},
+			checkInputs: func(inputs map[string]interface{}) {
+				require.Equal(t, map[string]interface{}{"prompt": "a cat", "num_steps": 30.0}, inputs)
+			},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.Nil(t, err)
+				require.Equal(t, map[string]interface{}{
+					"image": "a.png", "seed": 42.0, "running_time": "1.0s",
+				}, response.Outputs)
+			},
+		},
+		{
+			name:      "Pattern match",
+			modelName: "llama-2-7b",
+			inputs:    map[string]interface{}{"prompt": "Hi", "max_tokens": 64.0},
+			outputs:   map[string]interface{}{"output": "Hello"},
+			checkInputs: func(inputs map[string]interface{}) {
+				require.Equal(t, map[string]interface{}{"prompt": "Hi", "max_tokens": 64.0}, inputs)
+			},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.Nil(t, err)
+				require.Equal(t, map[string]interface{}{"output": "Hello"}, response.Outputs)
+			},
+		},
+		{
+			name:      "No rule",
+			modelName: "gpt2",
+			inputs:    map[string]interface{}{"text": "Hi"},
+			outputs:   map[string]interface{}{"output": "Hello"},
+			checkInputs: func(inputs map[string]interface{}) {
+				require.Equal(t, map[string]interface{}{"text": "Hi"}, inputs)
+			},
+			checkResponse: func(response *platform.InferResponse, err *platform.RequestError) {
+				require.Nil(t, err)
+				require.Equal(t, map[string]interface{}{"output": "Hello"}, response.Outputs)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			backend := mockplatform.NewMockPlatform(ctrl)
+			backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(1).
+				DoAndReturn(func(_ context.Context, request *platform.InferRequest, _ string) (
+					*platform.InferResponse, *platform.RequestError) {
+					tc.checkInputs(request.Inputs)
+					return &platform.InferResponse{Outputs: tc.outputs}, nil
+				})
+			transformer, err := platform.NewTransformerFromConfig(config, backend)
+			require.NoError(t, err)
+
+			request := &platform.InferRequest{ModelName: tc.modelName, Inputs: tc.inputs}
+			response, e := transformer.Predict(context.Background(), request, "v1")
+			tc.checkResponse(response, e)
+		})
+	}
+}
+
+func TestTransformerUploadWebhook(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "transform.json")
+	require.NoError(t, os.WriteFile(configPath,
+		[]byte(`{"rules": [{"model": "llama-*", "drop": ["upload_webhook"]}]}`), 0644))
+
+	testCases := []struct {
+		name      string
+		config    utils.Config
+		modelName string
+		expected  interface{}
+	}{
+		{
+			name:      "Upload webhook",
+			config:    utils.Config{UploadWebhookAddress: "localhost:12000"},
+			modelName: "sdxl",
+			expected:  "http://localhost:12000/upload",
+		},
+		{
+			name:      "Artifact hosting",
+			config:    utils.Config{ArtifactBaseURL: "https://files.example.com/"},
+			modelName: "sdxl",
+			expected:  "https://files.example.com/upload",
+		},
+		{
+			name:      "Dropped by rule",
+			config:    utils.Config{UploadWebhookAddress: "localhost:12000", TransformConfigPath: configPath},
+			modelName: "llama-2-7b",
+		},
+		{
+			name:      "Not configured",
+			modelName: "sdxl",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			backend := mockplatform.NewMockPlatform(ctrl)
+			backend.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(1).
+				DoAndReturn(func(_ context.Context, request *platform.InferRequest, _ string) (
+					*platform.InferResponse, *platform.RequestError) {
+					require.Equal(t, tc.expected, request.Inputs["upload_webhook"])
+					return &platform.InferResponse{}, nil
+				})
+			transformer, err := platform.NewTransformer(tc.config, backend)
+			require.NoError(t, err)
+
+			request := &platform.InferRequest{ModelName: tc.modelName, Inputs: map[string]interface{}{"prompt": "Hi"}}
+			_, e := transformer.Predict(context.Background(), request, "v1")
+			require.Nil(t, e)
+		})
+	}
+}
+
+func TestTransformerDocs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	backend := mockplatform.NewMockPlatform(ctrl)
+	backend.EXPECT().Docs(gomock.Any()).Times(1).Return(&platform.ModelSchema{
+		ModelName: "sdxl",
+		Inputs: []platform.FieldSchema{
+			{Name: "prompt", Type: "string", Required: true},
+			{Name: "num_steps", Type: "integer", Required: true},
+			{Name: "upload_webhook", Type: "string"},
+		},
+		Outputs: []platform.FieldSchema{{Name: "output", Type: "array"}},
+	}, nil)
+	transformer, err := platform.NewTransformerFromConfig(&platform.TransformConfig{
+		Rules: []platform.TransformRule{{
+			Model:    "sdxl",
+			Rename:   map[string]string{"text": "prompt"},
+			Defaults: map[string]interface{}{"num_steps": 30.0},
+			Drop:     []string{"upload_webhook"},
+			Outputs:  map[string]string{"image": "output[0]"},
+		}},
+	}, backend)
+	require.NoError(t, err)
+
+	schema, e := transformer.Docs(&platform.DocsRequest{ModelName: "sdxl"})
+	require.Nil(t, e)
+	require.Equal(t, []platform.FieldSchema{
+		{Name: "text", Type: "string", Required: true},
+		{Name: "num_steps", Type: "integer", Default: 30.0},
+	}, schema.Inputs)
+	require.Equal(t, []platform.FieldSchema{{Name: "image"}}, schema.Outputs)
+}
+
+func TestTransformerInvalidConfig(t *testing.T) {
+	for _, outputPath := range []string{"", "[0]", "output[", "output[a]", "output[0]x", "a..b"} {
+		_, err := platform.NewTransformerFromConfig(&platform.TransformConfig{
+			Rules: []platform.TransformRule{{Model: "sdxl", Outputs: map[string]string{"image": outputPath}}},
+		}, nil)
+		require.Error(t, err, outputPath)
+	}
+}
@@ -0,0 +1,111 @@
+package platform
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/rs/zerolog/log"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var sharedTransport struct {
+	once      sync.Once
+	transport http.RoundTripper
+}
+
+// SharedTransport returns the pooled transport shared by all the platforms and the webhook client.
+// It is created from the config when it is first called, so the later configs are ignored.
+func SharedTransport(config utils.Config) http.RoundTripper {
+	sharedTransport.once.Do(func() {
+		sharedTransport.transport = &instrumentedTransport{base: NewTransport(config)}
+	})
+	return sharedTransport.transport
+}
+
+// NewTransport creates a pooled transport. The zero values in the config fall back to the defaults.
+func NewTransport(config utils.Config) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   durationOrDefault(config.HTTPDialTimeout, 10*time.Second),
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, address)
+			if err != nil {
+				return nil, err
+			}
+			openConnections.WithLabelValues(address).Inc()
+			return &countedConn{Conn: conn, address: address}, nil
+		},
+		ForceAttemptHTTP2:     !config.HTTPDisableHTTP2,
+		MaxIdleConns:          intOrDefault(config.HTTPMaxIdleConns, 256),
+		MaxIdleConnsPerHost:   intOrDefault(config.HTTPMaxIdleConnsPerHost, 64),
+		MaxConnsPerHost:       config.HTTPMaxConnsPerHost,
+		IdleConnTimeout:       durationOrDefault(config.HTTPIdleConnTimeout, 90*time.Second),
+		TLSHandshakeTimeout:   durationOrDefault(config.HTTPTLSHandshakeTimeout, 10*time.Second),
+		ExpectContinueTimeout: time.Second,
+	}
+	if config.HTTPDisableHTTP2 {
+		// A non-nil empty map disables HTTP/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	if config.HTTPProxyURL != "" {
+		proxyURL, err := url.Parse(config.HTTPProxyURL)
+		if err != nil {
+			log.Error().Msgf("invalid proxy url %s: %v", config.HTTPProxyURL, err)
+		} else {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+	return transport
+}
+
+func intOrDefault(value int, defaultValue int) int {
+	if value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func durationOrDefault(seconds int, defaultValue time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultValue
+}
+
+// countedConn decrements the open connection gauge when the connection is closed.
+type countedConn struct {
+	net.Conn
+	address string
+	once    sync.Once
+}
+
+func (conn *countedConn) Close() error {
+	conn.once.Do(func() {
+		openConnections.WithLabelValues(conn.address).Dec()
+	})
+	return conn.Conn.Close()
+}
+
+// instrumentedTransport records whether each request reuses an idle connection.
+type instrumentedTransport struct {
+	base http.RoundTripper
+}
+
+func (transport *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			connectionRequests.WithLabelValues(req.URL.Host, strconv.FormatBool(info.Reused)).Inc()
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return transport.base.RoundTrip(req)
+}
@@ -0,0 +1,52 @@
+package platform_test
+
+import (
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewTransport(t *testing.T) {
+	transport := platform.NewTransport(utils.Config{})
+	require.Equal(t, 64, transport.MaxIdleConnsPerHost)
+	require.Equal(t, 90*time.Second, transport.IdleConnTimeout)
+	require.True(t, transport.ForceAttemptHTTP2)
+
+	transport = platform.NewTransport(utils.Config{
+		HTTPMaxIdleConnsPerHost: 8,
+		HTTPDisableHTTP2:        true,
+		HTTPProxyURL:            "http://proxy:3128",
+	})
+	require.Equal(t, 8, transport.MaxIdleConnsPerHost)
+	require.False(t, transport.ForceAttemptHTTP2)
+	req, err := http.NewRequest("GET", "https://api.replicate.com", nil)
+	require.NoError(t, err)
+	proxyURL, err := transport.Proxy(req)
+	require.NoError(t, err)
+	require.Equal(t, "proxy:3128", proxyURL.Host)
+}
+
+func TestSharedTransport(t *testing.T) {
+	var remoteAddrs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddrs = append(remoteAddrs, r.RemoteAddr)
+		_, _ = w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	client := http.Client{Transport: platform.SharedTransport(utils.Config{})}
+	for i := 0; i < 3; i++ {
+		res, err := client.Get(server.URL)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+	}
+	// The keep-alive connection is reused
+	require.Len(t, remoteAddrs, 3)
+	require.Equal(t, remoteAddrs[0], remoteAddrs[2])
+}
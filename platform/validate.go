@@ -0,0 +1,120 @@
+package platform
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Violation is a field of the inputs that doesn't match the model schema.
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidateInputs checks the types, the required fields, the enums and the numeric ranges of the inputs,
+// and returns all the violations. The fields not defined in the schema are allowed. If `fillDefaults`
+// is true, the missing fields are set to their default values in the schema.
+func ValidateInputs(schema *ModelSchema, inputs map[string]interface{}, fillDefaults bool) []Violation {
+	violations := make([]Violation, 0)
+	for _, field := range schema.Inputs {
+		value, ok := inputs[field.Name]
+		if !ok || value == nil {
+			if fillDefaults && field.Default != nil && inputs != nil {
+				inputs[field.Name] = field.Default
+			} else if field.Required {
+				violations = append(violations, Violation{Field: field.Name, Message: "field is required"})
+			}
+			continue
+		}
+		violations = append(violations, validateField(field.Name, field, value)...)
+	}
+	return violations
+}
+
+func validateField(name string, field FieldSchema, value interface{}) []Violation {
+	if !matchType(field.Type, value) {
+		return []Violation{{
+			Field:   name,
+			Message: fmt.Sprintf("expected %s, got %s", field.Type, typeName(value)),
+		}}
+	}
+	violations := make([]Violation, 0)
+	if len(field.Enum) > 0 && !containsValue(field.Enum, value) {
+		violations = append(violations, Violation{
+			Field:   name,
+			Message: fmt.Sprintf("must be one of %v", field.Enum),
+		})
+	}
+	if number, ok := value.(float64); ok {
+		if field.Minimum != nil && number < *field.Minimum {
+			violations = append(violations, Violation{
+				Field:   name,
+				Message: fmt.Sprintf("must be greater than or equal to %v", *field.Minimum),
+			})
+		}
+		if field.Maximum != nil && number > *field.Maximum {
+			violations = append(violations, Violation{
+				Field:   name,
+				Message: fmt.Sprintf("must be less than or equal to %v", *field.Maximum),
+			})
+		}
+	}
+	if items, ok := value.([]interface{}); ok && field.Items != nil {
+		for i, item := range items {
+			violations = append(violations, validateField(fmt.Sprintf("%s[%d]", name, i), *field.Items, item)...)
+		}
+	}
+	return violations
+}
+
+// matchType checks the value decoded by `encoding/json` against the JSON schema type.
+// An empty type matches any value.
+func matchType(schemaType string, value interface{}) bool {
+	switch schemaType {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	}
+	return true
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
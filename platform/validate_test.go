@@ -0,0 +1,79 @@
+package platform_test
+
+import (
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestValidateInputs(t *testing.T) {
+	minimum, maximum := 1.0, 100.0
+	schema := &platform.ModelSchema{
+		ModelName: "test_model",
+		Inputs: []platform.FieldSchema{
+			{Name: "prompt", Type: "string", Required: true},
+			{Name: "steps", Type: "integer", Default: 50.0, Minimum: &minimum, Maximum: &maximum},
+			{Name: "scheduler", Type: "string", Default: "DDIM", Enum: []interface{}{"DDIM", "K_EULER"}},
+			{Name: "seeds", Type: "array", Items: &platform.FieldSchema{Type: "integer"}},
+		},
+	}
+	testCases := []struct {
+		name         string
+		inputs       map[string]interface{}
+		fillDefaults bool
+		checkResult  func(inputs map[string]interface{}, violations []platform.Violation)
+	}{
+		{
+			name:   "OK",
+			inputs: map[string]interface{}{"prompt": "a cat", "steps": 30.0, "unknown": true},
+			checkResult: func(inputs map[string]interface{}, violations []platform.Violation) {
+				require.Empty(t, violations)
+				require.NotContains(t, inputs, "scheduler")
+			},
+		},
+		{
+			name:         "Fill defaults",
+			inputs:       map[string]interface{}{"prompt": "a cat"},
+			fillDefaults: true,
+			checkResult: func(inputs map[string]interface{}, violations []platform.Violation) {
+				require.Empty(t, violations)
+				require.Equal(t, 50.0, inputs["steps"])
+				require.Equal(t, "DDIM", inputs["scheduler"])
+			},
+		},
+		{
+			name: "All violations",
+			inputs: map[string]interface{}{
+				"steps":     200.5,
+				"scheduler": "DPM",
+				"seeds":     []interface{}{1.0, "2"},
+			},
+			checkResult: func(inputs map[string]interface{}, violations []platform.Violation) {
+				require.Equal(t, []platform.Violation{
+					{Field: "prompt", Message: "field is required"},
+					{Field: "steps", Message: "expected integer, got number"},
+					{Field: "scheduler", Message: "must be one of [DDIM K_EULER]"},
+					{Field: "seeds[1]", Message: "expected integer, got string"},
+				}, violations)
+			},
+		},
+		{
+			name:   "Out of range",
+			inputs: map[string]interface{}{"prompt": "a cat", "steps": 0.0},
+			checkResult: func(inputs map[string]interface{}, violations []platform.Violation) {
+				require.Equal(t, []platform.Violation{
+					{Field: "steps", Message: "must be greater than or equal to 1"},
+				}, violations)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			violations := platform.ValidateInputs(schema, tc.inputs, tc.fillDefaults)
+			tc.checkResult(tc.inputs, violations)
+		})
+	}
+}
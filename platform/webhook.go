@@ -2,6 +2,7 @@ package platform
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -20,13 +21,14 @@ type InternalWebhook struct {
 }
 
 type WebhookFetcher struct {
+	transport http.RoundTripper
 }
 
 func NewInternalWebhook(config utils.Config) Webhook {
 	webhook := InternalWebhook{
 		Config:  config,
 		Url:     fmt.Sprintf("http://%s/task", config.WebhookServerAddress),
-		Fetcher: &WebhookFetcher{},
+		Fetcher: &WebhookFetcher{transport: SharedTransport(config)},
 	}
 	return &webhook
 }
@@ -45,7 +47,7 @@ func (fetcher *WebhookFetcher) SendRequest(req *http.Request, timeout time.Durat
 	err := retry.Do(
 		func() error {
 			var e error
-			client := http.Client{Timeout: timeout}
+			client := http.Client{Transport: fetcher.transport, Timeout: timeout}
 			res, e = client.Do(req)
 			return e
 		},
@@ -219,6 +221,86 @@ func (webhook *InternalWebhook) GetTaskIDByModelStatus(modelName, status string)
 	return taskIDs, nil
 }
 
+// CreateNewBatch creates the parent record of the batch, which lists the child task IDs in the input order.
+func (webhook *InternalWebhook) CreateNewBatch(batchID, userID, modelName string, taskIDs []string) error {
+	info := map[string]interface{}{
+		"id":         batchID,
+		"model_name": modelName,
+		"task_ids":   taskIDs,
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return errors.New("failed to marshal batch info")
+	}
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/batch", webhook.Url), bytes.NewReader(data))
+	if err != nil {
+		return errors.New("failed to build request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apikey", webhook.Config.WebhookAPIKey)
+	req.Header.Set("UID", userID)
+
+	res, err := webhook.Fetcher.SendRequest(req, 10*time.Second, 3)
+	if err != nil {
+		return fmt.Errorf("http post request /task/batch failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		message := readErrorMessage(res)
+		return fmt.Errorf("http post request /task/batch failed, status code: %d, error: %v",
+			res.StatusCode, message)
+	}
+	return nil
+}
+
+func (webhook *InternalWebhook) GetBatchInfo(batchID string) (*BatchInfo, error) {
+	url := fmt.Sprintf("%s/batch/%s", webhook.Url, batchID)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, errors.New("failed to build request")
+	}
+	req.Header.Set("apikey", webhook.Config.WebhookAPIKey)
+
+	res, err := webhook.Fetcher.SendRequest(req, 10*time.Second, 3)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch info: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		message := readErrorMessage(res)
+		return nil, fmt.Errorf("failed to get batch info, status code: %d, error: %v",
+			res.StatusCode, message)
+	}
+	var info BatchInfo
+	if err := json.NewDecoder(res.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal data: %w", err)
+	}
+	return &info, nil
+}
+
+// CheckHealth checks if the webhook server is reachable. Any status code below 500 is accepted,
+// since it only tells that the server is up.
+func (webhook *InternalWebhook) CheckHealth(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", webhook.Url, nil)
+	if err != nil {
+		return errors.New("failed to build request")
+	}
+	req.Header.Set("apikey", webhook.Config.WebhookAPIKey)
+
+	res, err := webhook.Fetcher.SendRequest(req, 5*time.Second, 1)
+	if err != nil {
+		return fmt.Errorf("webhook server is unreachable: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("webhook server is unhealthy, status code: %d", res.StatusCode)
+	}
+	return nil
+}
+
 func readErrorMessage(res *http.Response) interface{} {
 	var errorMessage interface{}
 	data, e := io.ReadAll(res.Body)
@@ -280,3 +280,42 @@ func TestGetTaskIDByModelStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestBatchInfo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fetcher := mockplatform.NewMockFetcher(ctrl)
+	gomock.InOrder(
+		fetcher.EXPECT().
+			SendRequest(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(1).
+			DoAndReturn(func(req *http.Request, _ interface{}, _ interface{}) (*http.Response, error) {
+				require.Equal(t, "POST", req.Method)
+				require.Equal(t, "http://localhost:12000/task/batch", req.URL.String())
+				body, _ := io.ReadAll(req.Body)
+				require.JSONEq(t, `{"id": "b1", "model_name": "test", "task_ids": ["t1", "t2"]}`, string(body))
+				return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewReader(nil))}, nil
+			}),
+		fetcher.EXPECT().
+			SendRequest(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(1).
+			DoAndReturn(func(req *http.Request, _ interface{}, _ interface{}) (*http.Response, error) {
+				require.Equal(t, "http://localhost:12000/task/batch/b1", req.URL.String())
+				data := `{"id": "b1", "model_name": "test", "task_ids": ["t1", "t2"]}`
+				return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewReader([]byte(data)))}, nil
+			}),
+		fetcher.EXPECT().
+			SendRequest(gomock.Any(), gomock.Any(), gomock.Any()).
+			Times(1).
+			Return(&http.Response{StatusCode: 404, Body: io.NopCloser(bytes.NewReader(nil))}, nil),
+	)
+
+	webhook := newInternalWebhook(utils.Config{WebhookServerAddress: "localhost:12000"}, fetcher)
+	require.NoError(t, webhook.CreateNewBatch("b1", "abcde", "test", []string{"t1", "t2"}))
+	info, err := webhook.GetBatchInfo("b1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"t1", "t2"}, info.TaskIDs)
+	_, err = webhook.GetBatchInfo("b2")
+	require.Error(t, err)
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/google/uuid"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ArtifactPrefix is the prefix of the object keys of the artifacts.
+const ArtifactPrefix = "artifacts/"
+
+// The preferred file extensions of the common content types
+var artifactExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/webp": ".webp",
+	"image/gif":  ".gif",
+	"video/mp4":  ".mp4",
+	"audio/wav":  ".wav",
+	"audio/mpeg": ".mp3",
+	"text/plain": ".txt",
+}
+
+var validExtension = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+// Artifacts hosts the files generated by the models, e.g., images, in the object store, so that
+// all the platforms return the links served by the agent.
+// If the signing keys are set, the links are signed and expiring, i.e., `{base}/artifacts/{name}?expires=...`,
+// otherwise they are permanent, i.e., `{base}/files/artifacts/{name}`.
+type Artifacts struct {
+	store   ObjectStore
+	baseURL string
+	signer  *URLSigner
+}
+
+// NewArtifacts returns nil if `ARTIFACT_BASE_URL` is not set. The object store must be configured.
+func NewArtifacts(config utils.Config, store ObjectStore) (*Artifacts, error) {
+	if config.ArtifactBaseURL == "" {
+		return nil, nil
+	}
+	if store == nil {
+		return nil, errors.New("OBJECT_STORE must be set for hosting artifacts")
+	}
+	artifacts := Artifacts{store: store, baseURL: strings.TrimSuffix(config.ArtifactBaseURL, "/")}
+	if config.ArtifactSigningKeys != "" {
+		signer, err := NewURLSigner(config.ArtifactSigningKeys, time.Duration(config.ArtifactURLTTL)*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		artifacts.signer = signer
+	}
+	return &artifacts, nil
+}
+
+// Save stores the file and returns its URL. The content type is detected if it is not set,
+// and the extension is derived from the content type if it is empty.
+func (artifacts *Artifacts) Save(ctx context.Context, data []byte, contentType string, ext string) (string, error) {
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = http.DetectContentType(data)
+	}
+	ext = strings.ToLower(ext)
+	if !validExtension.MatchString(ext) {
+		ext = extensionByType(contentType)
+	}
+	key := ArtifactPrefix + uuid.New().String() + ext
+	if err := artifacts.store.Put(ctx, key, data); err != nil {
+		return "", fmt.Errorf("failed to store artifact: %w", err)
+	}
+	return artifacts.URL(key), nil
+}
+
+// URL returns the signed URL of the artifact if signing is enabled, otherwise the permanent URL.
+func (artifacts *Artifacts) URL(key string) string {
+	if artifacts.signer == nil {
+		return fmt.Sprintf("%s/files/%s", artifacts.baseURL, key)
+	}
+	query := artifacts.signer.Sign(key, time.Now())
+	return fmt.Sprintf("%s/artifacts/%s?%s", artifacts.baseURL, strings.TrimPrefix(key, ArtifactPrefix), query.Encode())
+}
+
+// Signed returns whether the artifacts are only served by the signed URLs.
+func (artifacts *Artifacts) Signed() bool {
+	return artifacts != nil && artifacts.signer != nil
+}
+
+// Verify checks the signed URL of the artifact, where `name` is the key without the prefix.
+func (artifacts *Artifacts) Verify(name string, query url.Values) error {
+	if artifacts.signer == nil {
+		return ErrInvalidSignature
+	}
+	return artifacts.signer.Verify(ArtifactPrefix+name, query, time.Now())
+}
+
+// Resign replaces the artifact URLs in the value, e.g., the outputs of a task, with newly signed ones,
+// so that the links in a leaked response stop working after they expire. The value is updated in place.
+// It does nothing if signing is disabled.
+func (artifacts *Artifacts) Resign(value interface{}) interface{} {
+	if !artifacts.Signed() {
+		return value
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = artifacts.Resign(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = artifacts.Resign(item)
+		}
+	case string:
+		if key, ok := artifacts.keyOf(v); ok {
+			return artifacts.URL(key)
+		}
+	}
+	return value
+}
+
+// keyOf returns the object key if the link is an artifact URL of the agent, signed or permanent.
+func (artifacts *Artifacts) keyOf(link string) (string, bool) {
+	for _, prefix := range []string{artifacts.baseURL + "/artifacts/", artifacts.baseURL + "/files/" + ArtifactPrefix} {
+		if name, ok := strings.CutPrefix(link, prefix); ok {
+			name, _, _ = strings.Cut(name, "?")
+			if name == "" || strings.Contains(name, "..") {
+				return "", false
+			}
+			return ArtifactPrefix + name, true
+		}
+	}
+	return "", false
+}
+
+// Load returns the artifact and its content type, which is derived from the extension.
+func (artifacts *Artifacts) Load(ctx context.Context, key string) ([]byte, string, error) {
+	if !strings.HasPrefix(key, ArtifactPrefix) || strings.Contains(key, "..") {
+		return nil, "", ErrNotFound
+	}
+	data, err := artifacts.store.Get(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return data, contentType, nil
+}
+
+func extensionByType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if ext, ok := artifactExtensions[mediaType]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
@@ -0,0 +1,214 @@
+package storage_test
+
+import (
+	"context"
+	"github.com/HyperGAI/serving-agent/storage"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var pngData = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestArtifacts(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	artifacts, err := storage.NewArtifacts(utils.Config{ArtifactBaseURL: "http://localhost:8080/"}, store)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		data         []byte
+		contentType  string
+		ext          string
+		expectedExt  string
+		expectedType string
+	}{
+		{
+			name:         "Detect content type",
+			data:         pngData,
+			expectedExt:  ".png",
+			expectedType: "image/png",
+		},
+		{
+			name:         "Content type",
+			data:         []byte("RIFF0000WAVE"),
+			contentType:  "audio/wav",
+			expectedExt:  ".wav",
+			expectedType: "audio/",
+		},
+		{
+			name:         "Extension",
+			data:         []byte("hello"),
+			contentType:  "text/plain",
+			ext:          ".TXT",
+			expectedExt:  ".txt",
+			expectedType: "text/plain",
+		},
+		{
+			name:         "Invalid extension",
+			data:         pngData,
+			ext:          ".png/../x",
+			expectedExt:  ".png",
+			expectedType: "image/png",
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			url, err := artifacts.Save(context.Background(), tc.data, tc.contentType, tc.ext)
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(url, "http://localhost:8080/files/"+storage.ArtifactPrefix))
+			require.True(t, strings.HasSuffix(url, tc.expectedExt))
+
+			key := strings.TrimPrefix(url, "http://localhost:8080/files/")
+			data, contentType, err := artifacts.Load(context.Background(), key)
+			require.NoError(t, err)
+			require.Equal(t, tc.data, data)
+			require.True(t, strings.HasPrefix(contentType, tc.expectedType), contentType)
+		})
+	}
+
+	for _, key := range []string{"payloads/a.json", "artifacts/../payloads/a.json", "artifacts/missing.png"} {
+		_, _, err := artifacts.Load(context.Background(), key)
+		require.ErrorIs(t, err, storage.ErrNotFound, key)
+	}
+}
+
+func TestNewArtifacts(t *testing.T) {
+	artifacts, err := storage.NewArtifacts(utils.Config{}, nil)
+	require.NoError(t, err)
+	require.Nil(t, artifacts)
+
+	_, err = storage.NewArtifacts(utils.Config{ArtifactBaseURL: "http://localhost:8080"}, nil)
+	require.Error(t, err)
+}
+
+func TestURLSigner(t *testing.T) {
+	now := time.Now()
+	oldSigner, err := storage.NewURLSigner("k1:secret1", time.Hour)
+	require.NoError(t, err)
+	// The new key is put first, and the old key is kept for the links signed before
+	signer, err := storage.NewURLSigner("k2:secret2, k1:secret1", time.Hour)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		query    func() url.Values
+		now      time.Time
+		expected error
+	}{
+		{
+			name:  "OK",
+			query: func() url.Values { return signer.Sign("artifacts/a.png", now) },
+			now:   now,
+		},
+		{
+			name:  "Old key",
+			query: func() url.Values { return oldSigner.Sign("artifacts/a.png", now) },
+			now:   now,
+		},
+		{
+			name:     "Expired",
+			query:    func() url.Values { return signer.Sign("artifacts/a.png", now) },
+			now:      now.Add(time.Hour + time.Second),
+			expected: storage.ErrURLExpired,
+		},
+		{
+			name:     "Other key",
+			query:    func() url.Values { return signer.Sign("artifacts/b.png", now) },
+			now:      now,
+			expected: storage.ErrInvalidSignature,
+		},
+		{
+			name: "Extended expiry",
+			query: func() url.Values {
+				query := signer.Sign("artifacts/a.png", now)
+				query.Set("expires", strconv.FormatInt(now.Add(24*time.Hour).Unix(), 10))
+				return query
+			},
+			now:      now,
+			expected: storage.ErrInvalidSignature,
+		},
+		{
+			name: "Unknown key ID",
+			query: func() url.Values {
+				query := signer.Sign("artifacts/a.png", now)
+				query.Set("key_id", "k3")
+				return query
+			},
+			now:      now,
+			expected: storage.ErrInvalidSignature,
+		},
+		{
+			name:     "No signature",
+			query:    func() url.Values { return url.Values{} },
+			now:      now,
+			expected: storage.ErrInvalidSignature,
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			err := signer.Verify("artifacts/a.png", tc.query(), tc.now)
+			if tc.expected == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tc.expected)
+			}
+		})
+	}
+
+	for _, keys := range []string{"", "k1", "k1:", ":secret", "k1:a,k1:b"} {
+		_, err := storage.NewURLSigner(keys, time.Hour)
+		require.Error(t, err, keys)
+	}
+}
+
+func TestArtifactsResign(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	artifacts, err := storage.NewArtifacts(utils.Config{
+		ArtifactBaseURL: "http://agent", ArtifactSigningKeys: "k1:secret1", ArtifactURLTTL: 60,
+	}, store)
+	require.NoError(t, err)
+	require.True(t, artifacts.Signed())
+
+	link, err := artifacts.Save(context.Background(), pngData, "", "")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(link, "http://agent/artifacts/"))
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	name := strings.TrimPrefix(u.Path, "/artifacts/")
+	require.NoError(t, artifacts.Verify(name, u.Query()))
+
+	outputs := map[string]interface{}{
+		"images": []interface{}{
+			"http://agent/artifacts/" + name + "?expires=1&key_id=k1&signature=x",
+			"http://agent/files/artifacts/" + name,
+		},
+		"other": "http://example.com/artifacts/a.png",
+		"seed":  42.0,
+	}
+	artifacts.Resign(outputs)
+	for _, item := range outputs["images"].([]interface{}) {
+		u, err := url.Parse(item.(string))
+		require.NoError(t, err)
+		require.Equal(t, "/artifacts/"+name, u.Path)
+		require.NoError(t, artifacts.Verify(name, u.Query()))
+	}
+	require.Equal(t, "http://example.com/artifacts/a.png", outputs["other"])
+	require.Equal(t, 42.0, outputs["seed"])
+
+	// Nothing is changed if signing is disabled
+	var unsigned *storage.Artifacts
+	require.Equal(t, "http://agent/files/artifacts/a.png", unsigned.Resign("http://agent/files/artifacts/a.png"))
+}
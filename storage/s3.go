@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/utils"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Store stores the objects in an S3-compatible bucket, e.g., AWS S3, GCS (interoperability mode)
+// or MinIO. The requests are signed with AWS signature version 4.
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+type S3Store struct {
+	endpoint        string
+	bucket          string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	client          http.Client
+}
+
+// NewS3Store creates the S3 store. If `S3_ENDPOINT` is not set, the AWS endpoint of the region
+// is used with the virtual-hosted-style URLs, otherwise the path-style URLs.
+func NewS3Store(config utils.Config, transport http.RoundTripper) (*S3Store, error) {
+	if config.S3Bucket == "" {
+		return nil, errors.New("S3_BUCKET is not set")
+	}
+	region := config.S3Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3Store{
+		endpoint:        strings.TrimSuffix(config.S3Endpoint, "/"),
+		bucket:          config.S3Bucket,
+		region:          region,
+		accessKeyID:     config.S3AccessKeyID,
+		secretAccessKey: config.S3SecretAccessKey,
+		client:          http.Client{Transport: transport, Timeout: 60 * time.Second},
+	}, nil
+}
+
+func (store *S3Store) objectURL(key string) string {
+	if store.endpoint == "" {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", store.bucket, store.region, encodePath(key))
+	}
+	return fmt.Sprintf("%s/%s/%s", store.endpoint, store.bucket, encodePath(key))
+}
+
+func (store *S3Store) do(ctx context.Context, method string, key string, data []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, store.objectURL(key), bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	store.sign(req, data, time.Now())
+	res, err := store.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	return res, nil
+}
+
+func (store *S3Store) Put(ctx context.Context, key string, data []byte) error {
+	if data == nil {
+		data = []byte{}
+	}
+	res, err := store.do(ctx, "PUT", key, data)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return readS3Error(res)
+	}
+	return nil
+}
+
+func (store *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	res, err := store.do(ctx, "GET", key, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, readS3Error(res)
+	}
+	return io.ReadAll(res.Body)
+}
+
+func (store *S3Store) Delete(ctx context.Context, key string) error {
+	res, err := store.do(ctx, "DELETE", key, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK &&
+		res.StatusCode != http.StatusNotFound {
+		return readS3Error(res)
+	}
+	return nil
+}
+
+func readS3Error(res *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	return fmt.Errorf("s3 status code: %d, error: %s", res.StatusCode, strings.TrimSpace(string(message)))
+}
+
+// sign adds the signature version 4 headers. All the headers already set in the request are signed.
+func (store *S3Store) sign(req *http.Request, payload []byte, now time.Time) {
+	hash := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(hash[:])
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, store.region)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+store.secretAccessKey), date)
+	key = hmacSHA256(key, store.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		store.accessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, encodeURI(key, true)+"="+encodeURI(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// encodePath encodes the object key as required by signature version 4, keeping the slashes.
+func encodePath(key string) string {
+	return encodeURI(key, false)
+}
+
+func encodeURI(s string, encodeSlash bool) string {
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			builder.WriteByte(c)
+		} else {
+			builder.WriteString(fmt.Sprintf("%%%02X", c))
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidSignature is returned by `Verify` if the signature is missing or doesn't match.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrURLExpired is returned by `Verify` if the signed URL is expired.
+	ErrURLExpired = errors.New("the URL is expired")
+)
+
+// URLSigner signs the artifact keys with HMAC-SHA256 and an expiry time. The URLs are signed with the first key,
+// and verified with any of the keys by the key ID in the URL, so that a new key can be put first without
+// invalidating the links signed with the old key, which can be removed after the links expire.
+type URLSigner struct {
+	keyID string
+	keys  map[string][]byte
+	ttl   time.Duration
+}
+
+// NewURLSigner parses the keys in the format of `id1:secret1,id2:secret2`.
+func NewURLSigner(keys string, ttl time.Duration) (*URLSigner, error) {
+	if ttl <= 0 {
+		return nil, errors.New("the TTL of the signed URLs must be > 0")
+	}
+	signer := URLSigner{keys: make(map[string][]byte), ttl: ttl}
+	for i, item := range strings.Split(keys, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(item, ":")
+		if !ok || id == "" || secret == "" {
+			// The secret is not logged
+			return nil, fmt.Errorf("invalid signing key #%d, the format is `id:secret`", i+1)
+		}
+		if _, ok := signer.keys[id]; ok {
+			return nil, fmt.Errorf("duplicate signing key id: %s", id)
+		}
+		if signer.keyID == "" {
+			signer.keyID = id
+		}
+		signer.keys[id] = []byte(secret)
+	}
+	if signer.keyID == "" {
+		return nil, errors.New("no signing keys")
+	}
+	return &signer, nil
+}
+
+func (signer *URLSigner) signature(secret []byte, key string, expires string) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(key + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Sign returns the query parameters of the signed URL, which expires after the TTL.
+func (signer *URLSigner) Sign(key string, now time.Time) url.Values {
+	expires := strconv.FormatInt(now.Add(signer.ttl).Unix(), 10)
+	return url.Values{
+		"expires":   {expires},
+		"key_id":    {signer.keyID},
+		"signature": {signer.signature(signer.keys[signer.keyID], key, expires)},
+	}
+}
+
+// Verify checks the signature and the expiry time in the query parameters.
+func (signer *URLSigner) Verify(key string, query url.Values, now time.Time) error {
+	secret, ok := signer.keys[query.Get("key_id")]
+	if !ok {
+		return ErrInvalidSignature
+	}
+	expires := query.Get("expires")
+	expected := signer.signature(secret, key, expires)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return ErrInvalidSignature
+	}
+	timestamp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if now.Unix() >= timestamp {
+		return ErrURLExpired
+	}
+	return nil
+}
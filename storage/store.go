@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/rs/zerolog/log"
+	"net/http"
+)
+
+// ErrNotFound is returned by `Get` if the object doesn't exist.
+var ErrNotFound = errors.New("object not found")
+
+// ObjectStore stores the objects which are too large to keep in redis, e.g., the task payloads.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// NewObjectStore creates the object store by `OBJECT_STORE`, i.e., local or s3.
+// It returns nil if `OBJECT_STORE` is not set.
+func NewObjectStore(config utils.Config, transport http.RoundTripper) (ObjectStore, error) {
+	switch config.ObjectStore {
+	case "":
+		return nil, nil
+	case "local":
+		log.Info().Msgf("using local object store: %s", config.LocalStoreDir)
+		return NewLocalStore(config.LocalStoreDir)
+	case "s3":
+		log.Info().Msgf("using s3 object store: %s, %s", config.S3Endpoint, config.S3Bucket)
+		return NewS3Store(config, transport)
+	}
+	return nil, fmt.Errorf("unknown object store: %s", config.ObjectStore)
+}
@@ -0,0 +1,107 @@
+package storage_test
+
+import (
+	"context"
+	"github.com/HyperGAI/serving-agent/storage"
+	"github.com/HyperGAI/serving-agent/utils"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newS3Server returns an in-memory server handling the object requests of the path-style URLs.
+func newS3Server(t *testing.T) *httptest.Server {
+	var mutex sync.Mutex
+	objects := make(map[string][]byte)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/"))
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch r.Method {
+		case "PUT":
+			data, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = data
+		case "GET":
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		case "DELETE":
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+}
+
+func TestObjectStore(t *testing.T) {
+	s3Server := newS3Server(t)
+	defer s3Server.Close()
+
+	testCases := []struct {
+		name   string
+		config utils.Config
+	}{
+		{
+			name:   "Local",
+			config: utils.Config{ObjectStore: "local", LocalStoreDir: t.TempDir()},
+		},
+		{
+			name: "S3",
+			config: utils.Config{
+				ObjectStore:       "s3",
+				S3Endpoint:        s3Server.URL,
+				S3Bucket:          "payloads",
+				S3AccessKeyID:     "key",
+				S3SecretAccessKey: "secret",
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+
+		t.Run(tc.name, func(t *testing.T) {
+			store, err := storage.NewObjectStore(tc.config, http.DefaultTransport)
+			require.NoError(t, err)
+			ctx := context.Background()
+
+			_, err = store.Get(ctx, "payloads/1.json")
+			require.ErrorIs(t, err, storage.ErrNotFound)
+
+			require.NoError(t, store.Put(ctx, "payloads/1.json", []byte(`{"prompt": "a cat"}`)))
+			data, err := store.Get(ctx, "payloads/1.json")
+			require.NoError(t, err)
+			require.Equal(t, `{"prompt": "a cat"}`, string(data))
+
+			require.NoError(t, store.Delete(ctx, "payloads/1.json"))
+			require.NoError(t, store.Delete(ctx, "payloads/1.json"))
+			_, err = store.Get(ctx, "payloads/1.json")
+			require.ErrorIs(t, err, storage.ErrNotFound)
+		})
+	}
+}
+
+func TestNewObjectStore(t *testing.T) {
+	store, err := storage.NewObjectStore(utils.Config{}, nil)
+	require.NoError(t, err)
+	require.Nil(t, store)
+
+	_, err = storage.NewObjectStore(utils.Config{ObjectStore: "gcs"}, nil)
+	require.Error(t, err)
+	_, err = storage.NewObjectStore(utils.Config{ObjectStore: "s3"}, nil)
+	require.Error(t, err)
+}
+
+func TestLocalStoreInvalidKey(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	for _, key := range []string{"", "../a.json", "payloads/../../a.json"} {
+		require.Error(t, store.Put(context.Background(), key, []byte("a")), key)
+	}
+}
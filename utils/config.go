@@ -23,25 +23,104 @@ type Config struct {
 	MLPlatform           string `mapstructure:"ML_PLATFORM"`
 	UploadWebhookAddress string `mapstructure:"UPLOAD_WEBHOOK_ADDRESS"`
 	EnablePeriodicCheck  bool   `mapstructure:"ENABLE_PERIODIC_CHECK"`
+	HealthCheckTimeout   int    `mapstructure:"HEALTH_CHECK_TIMEOUT"`
+	RouterConfigPath     string `mapstructure:"ROUTER_CONFIG_PATH"`
+	FailoverPlatforms    string `mapstructure:"FAILOVER_PLATFORMS"`
+	TransformConfigPath  string `mapstructure:"TRANSFORM_CONFIG_PATH"`
+	// Input validation against the model schema
+	ValidateInputs    bool `mapstructure:"VALIDATE_INPUTS"`
+	SchemaCacheTTL    int  `mapstructure:"SCHEMA_CACHE_TTL"`
+	FillInputDefaults bool `mapstructure:"FILL_INPUT_DEFAULTS"`
+	// Batch prediction
+	MaxBatchSize     int `mapstructure:"MAX_BATCH_SIZE"`
+	BatchConcurrency int `mapstructure:"BATCH_CONCURRENCY"`
+	// Dynamic batching of the sync predictions
+	DynamicBatchModels     string `mapstructure:"DYNAMIC_BATCH_MODELS"`
+	DynamicBatchMaxSize    int    `mapstructure:"DYNAMIC_BATCH_MAX_SIZE"`
+	DynamicBatchMaxLatency int    `mapstructure:"DYNAMIC_BATCH_MAX_LATENCY"`
+	// The seconds to keep the idempotency keys
+	IdempotencyTTL int `mapstructure:"IDEMPOTENCY_TTL"`
+	// Response cache
+	CacheEnabled    bool   `mapstructure:"CACHE_ENABLED"`
+	CacheTTL        int    `mapstructure:"CACHE_TTL"`
+	CacheConfigPath string `mapstructure:"CACHE_CONFIG_PATH"`
+	// Object store for the large payloads
+	ObjectStore           string `mapstructure:"OBJECT_STORE"`
+	LocalStoreDir         string `mapstructure:"LOCAL_STORE_DIR"`
+	S3Endpoint            string `mapstructure:"S3_ENDPOINT"`
+	S3Bucket              string `mapstructure:"S3_BUCKET"`
+	S3Region              string `mapstructure:"S3_REGION"`
+	S3AccessKeyID         string `mapstructure:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey     string `mapstructure:"S3_SECRET_ACCESS_KEY"`
+	PayloadStoreThreshold int    `mapstructure:"PAYLOAD_STORE_THRESHOLD"`
+	// Artifacts hosted in the object store
+	ArtifactBaseURL     string `mapstructure:"ARTIFACT_BASE_URL"`
+	RehostArtifacts     bool   `mapstructure:"REHOST_ARTIFACTS"`
+	ArtifactRehostHosts string `mapstructure:"ARTIFACT_REHOST_HOSTS"`
+	MaxArtifactSize     int64  `mapstructure:"MAX_ARTIFACT_SIZE"`
+	ArtifactSigningKeys string `mapstructure:"ARTIFACT_SIGNING_KEYS"`
+	ArtifactURLTTL      int    `mapstructure:"ARTIFACT_URL_TTL"`
+	// Circuit breaker
+	CircuitBreakerThreshold   int `mapstructure:"CIRCUIT_BREAKER_THRESHOLD"`
+	CircuitBreakerOpenTimeout int `mapstructure:"CIRCUIT_BREAKER_OPEN_TIMEOUT"`
+	// HTTP transport shared by all the platforms and the webhook client
+	HTTPMaxIdleConns        int    `mapstructure:"HTTP_MAX_IDLE_CONNS"`
+	HTTPMaxIdleConnsPerHost int    `mapstructure:"HTTP_MAX_IDLE_CONNS_PER_HOST"`
+	HTTPMaxConnsPerHost     int    `mapstructure:"HTTP_MAX_CONNS_PER_HOST"`
+	HTTPIdleConnTimeout     int    `mapstructure:"HTTP_IDLE_CONN_TIMEOUT"`
+	HTTPDialTimeout         int    `mapstructure:"HTTP_DIAL_TIMEOUT"`
+	HTTPTLSHandshakeTimeout int    `mapstructure:"HTTP_TLS_HANDSHAKE_TIMEOUT"`
+	HTTPDisableHTTP2        bool   `mapstructure:"HTTP_DISABLE_HTTP2"`
+	HTTPProxyURL            string `mapstructure:"HTTP_PROXY_URL"`
+	// Retry policy shared by all the platforms
+	RetryMaxBackoff  float64 `mapstructure:"RETRY_MAX_BACKOFF"`
+	RetryStatusCodes string  `mapstructure:"RETRY_STATUS_CODES"`
 	// KServe
-	KServeVersion        string `mapstructure:"KSERVE_VERSION"`
-	KServeAddress        string `mapstructure:"KSERVE_ADDRESS"`
-	KServeCustomDomain   string `mapstructure:"KSERVE_CUSTOM_DOMAIN"`
-	KServeNamespace      string `mapstructure:"KSERVE_NAMESPACE"`
-	KServeRequestTimeout int    `mapstructure:"KSERVE_REQUEST_TIMEOUT"`
+	KServeVersion        string  `mapstructure:"KSERVE_VERSION"`
+	KServeAddress        string  `mapstructure:"KSERVE_ADDRESS"`
+	KServeCustomDomain   string  `mapstructure:"KSERVE_CUSTOM_DOMAIN"`
+	KServeNamespace      string  `mapstructure:"KSERVE_NAMESPACE"`
+	KServeRequestTimeout int     `mapstructure:"KSERVE_REQUEST_TIMEOUT"`
+	KServeRetryAttempts  int     `mapstructure:"KSERVE_RETRY_ATTEMPTS"`
+	KServeRetryBackoff   float64 `mapstructure:"KSERVE_RETRY_BACKOFF"`
 	// Replicate
-	ReplicateAddress        string `mapstructure:"REPLICATE_ADDRESS"`
-	ReplicateAPIKey         string `mapstructure:"REPLICATE_APIKEY"`
-	ReplicateModelID        string `mapstructure:"REPLICATE_MODEL_ID"`
-	ReplicateRequestTimeout int    `mapstructure:"REPLICATE_REQUEST_TIMEOUT"`
+	ReplicateAddress        string  `mapstructure:"REPLICATE_ADDRESS"`
+	ReplicateAPIKey         string  `mapstructure:"REPLICATE_APIKEY"`
+	ReplicateModelID        string  `mapstructure:"REPLICATE_MODEL_ID"`
+	ReplicateModelName      string  `mapstructure:"REPLICATE_MODEL_NAME"`
+	ReplicateRequestTimeout int     `mapstructure:"REPLICATE_REQUEST_TIMEOUT"`
+	ReplicateRetryAttempts  int     `mapstructure:"REPLICATE_RETRY_ATTEMPTS"`
+	ReplicateRetryBackoff   float64 `mapstructure:"REPLICATE_RETRY_BACKOFF"`
+	// The requests per second per API key, 0 to disable
+	ReplicateCreateRateLimit float64 `mapstructure:"REPLICATE_CREATE_RATE_LIMIT"`
+	ReplicatePollRateLimit   float64 `mapstructure:"REPLICATE_POLL_RATE_LIMIT"`
 	// RunPod
-	RunPodAddress        string `mapstructure:"RUNPOD_ADDRESS"`
-	RunPodAPIKey         string `mapstructure:"RUNPOD_APIKEY"`
-	RunPodModelID        string `mapstructure:"RUNPOD_MODEL_ID"`
-	RunPodRequestTimeout int    `mapstructure:"RUNPOD_REQUEST_TIMEOUT"`
+	RunPodAddress        string  `mapstructure:"RUNPOD_ADDRESS"`
+	RunPodAPIKey         string  `mapstructure:"RUNPOD_APIKEY"`
+	RunPodModelID        string  `mapstructure:"RUNPOD_MODEL_ID"`
+	RunPodSchemaDir      string  `mapstructure:"RUNPOD_SCHEMA_DIR"`
+	RunPodRequestTimeout int     `mapstructure:"RUNPOD_REQUEST_TIMEOUT"`
+	RunPodRetryAttempts  int     `mapstructure:"RUNPOD_RETRY_ATTEMPTS"`
+	RunPodRetryBackoff   float64 `mapstructure:"RUNPOD_RETRY_BACKOFF"`
+	// The requests per second per API key, 0 to disable
+	RunPodCreateRateLimit float64 `mapstructure:"RUNPOD_CREATE_RATE_LIMIT"`
+	RunPodPollRateLimit   float64 `mapstructure:"RUNPOD_POLL_RATE_LIMIT"`
 	// K8s deployment
-	K8sPluginAddress        string `mapstructure:"K8SPLUGIN_ADDRESS"`
-	K8sPluginRequestTimeout int    `mapstructure:"K8SPLUGIN_REQUEST_TIMEOUT"`
+	K8sPluginAddress        string  `mapstructure:"K8SPLUGIN_ADDRESS"`
+	K8sPluginRequestTimeout int     `mapstructure:"K8SPLUGIN_REQUEST_TIMEOUT"`
+	K8sPluginRetryAttempts  int     `mapstructure:"K8SPLUGIN_RETRY_ATTEMPTS"`
+	K8sPluginRetryBackoff   float64 `mapstructure:"K8SPLUGIN_RETRY_BACKOFF"`
+	// OpenAI-compatible servers
+	OpenAIAddress        string  `mapstructure:"OPENAI_ADDRESS"`
+	OpenAIAPIKey         string  `mapstructure:"OPENAI_APIKEY"`
+	OpenAIRequestTimeout int     `mapstructure:"OPENAI_REQUEST_TIMEOUT"`
+	OpenAIRetryAttempts  int     `mapstructure:"OPENAI_RETRY_ATTEMPTS"`
+	OpenAIRetryBackoff   float64 `mapstructure:"OPENAI_RETRY_BACKOFF"`
+	// Ollama
+	OllamaAddress        string  `mapstructure:"OLLAMA_ADDRESS"`
+	OllamaRequestTimeout int     `mapstructure:"OLLAMA_REQUEST_TIMEOUT"`
+	OllamaRetryAttempts  int     `mapstructure:"OLLAMA_RETRY_ATTEMPTS"`
+	OllamaRetryBackoff   float64 `mapstructure:"OLLAMA_RETRY_BACKOFF"`
 }
 
 // LoadConfigs reads configuration from file or environment variables.
@@ -0,0 +1,13 @@
+package utils
+
+import (
+	"github.com/redis/go-redis/v9"
+)
+
+// NewRedisClient creates the client of the redis used by Asynq, which can be a redis cluster.
+func NewRedisClient(config Config) redis.UniversalClient {
+	if config.RedisClusterMode {
+		return redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{config.RedisAddress}})
+	}
+	return redis.NewClient(&redis.Options{Addr: config.RedisAddress})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/storage"
 	"github.com/HyperGAI/serving-agent/utils"
 	"github.com/hibiken/asynq"
 	"github.com/rs/zerolog/log"
@@ -27,6 +28,10 @@ type TaskDistributor interface {
 		id string,
 	) error
 
+	CancelTask(
+		id string,
+	) error
+
 	ListArchivedTasks(
 		queue string,
 	) ([]*asynq.TaskInfo, error)
@@ -63,10 +68,12 @@ type TaskDistributor interface {
 type RedisTaskDistributor struct {
 	client    *asynq.Client
 	inspector *asynq.Inspector
+	store     storage.ObjectStore
 	config    utils.Config
 }
 
-func NewRedisTaskDistributor(config utils.Config) TaskDistributor {
+// NewRedisTaskDistributor creates the distributor. The large task payloads are stored in `store` if it is set.
+func NewRedisTaskDistributor(config utils.Config, store storage.ObjectStore) TaskDistributor {
 	if config.RedisAddress == "" {
 		return nil
 	}
@@ -86,6 +93,7 @@ func NewRedisTaskDistributor(config utils.Config) TaskDistributor {
 	return &RedisTaskDistributor{
 		client:    client,
 		inspector: inspector,
+		store:     store,
 		config:    config,
 	}
 }
@@ -139,8 +147,29 @@ func (distributor *RedisTaskDistributor) ListUnfinishedTasks(queue string) ([]*a
 	return tasks, nil
 }
 
+// DeleteTask deletes the task from the queue together with its offloaded inputs.
+// The payload is only looked up if the payloads can be offloaded.
 func (distributor *RedisTaskDistributor) DeleteTask(queue string, id string) error {
-	return distributor.inspector.DeleteTask(queue, id)
+	var task *asynq.TaskInfo
+	var lookupErr error
+	if distributor.store != nil && distributor.config.PayloadStoreThreshold > 0 {
+		task, lookupErr = distributor.inspector.GetTaskInfo(queue, id)
+	}
+	if err := distributor.inspector.DeleteTask(queue, id); err != nil {
+		return err
+	}
+	if lookupErr != nil {
+		log.Error().Msgf("failed to get task %s, its offloaded inputs are not deleted: %v", id, lookupErr)
+	} else if task != nil {
+		deletePayload(context.Background(), distributor.store, task.Payload)
+	}
+	return nil
+}
+
+// CancelTask cancels the context of the running task on the agent processing it, which aborts the backend
+// request. It is best-effort, i.e., it only returns an error if the signal couldn't be sent.
+func (distributor *RedisTaskDistributor) CancelTask(id string) error {
+	return distributor.inspector.CancelProcessing(id)
 }
 
 func (distributor *RedisTaskDistributor) PauseQueue(queue string) error {
@@ -168,13 +197,15 @@ func CheckArchivedTasks(distributor TaskDistributor, webhook platform.Webhook) {
 				log.Error().Msgf("failed to unmarshal payload from archived task: %v", err)
 				continue
 			}
-			// Update the task status
+			// Update the task status unless it was canceled while running
 			info := platform.UpdateRequest{
 				ID:        payload.ID,
 				Status:    "failed",
 				ErrorInfo: "failed due to system errors",
 			}
-			if err := webhook.UpdateTaskInfo(&info); err != nil {
+			if tasks[i].LastErr == context.Canceled.Error() {
+				log.Info().Msgf("archived task %s was canceled", tasks[i].ID)
+			} else if err := webhook.UpdateTaskInfo(&info); err != nil {
 				// Two cases:
 				// 1. The task record has been deleted by redis automatically due to key expiration.
 				// 2. The redis fails during the call (happens rarely).
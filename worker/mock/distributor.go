@@ -36,6 +36,20 @@ func (m *MockTaskDistributor) EXPECT() *MockTaskDistributorMockRecorder {
 	return m.recorder
 }
 
+// CancelTask mocks base method.
+func (m *MockTaskDistributor) CancelTask(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelTask", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelTask indicates an expected call of CancelTask.
+func (mr *MockTaskDistributorMockRecorder) CancelTask(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelTask", reflect.TypeOf((*MockTaskDistributor)(nil).CancelTask), arg0)
+}
+
 // DeleteTask mocks base method.
 func (m *MockTaskDistributor) DeleteTask(arg0, arg1 string) error {
 	m.ctrl.T.Helper()
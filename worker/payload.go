@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/HyperGAI/serving-agent/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog/log"
+)
+
+var payloadOffloadCounts = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "task_payload_offload_total",
+	Help: "Number of task payloads stored in the object store instead of redis",
+})
+
+// PayloadKey returns the object key of the offloaded inputs of the task.
+func PayloadKey(id string) string {
+	return fmt.Sprintf("payloads/%s.json", id)
+}
+
+// Encode marshals the payload. If it is larger than `threshold` bytes, the inputs are moved to the store
+// and the encoded payload only keeps the reference. The payload is never offloaded if the store is nil
+// or the threshold is 0.
+func (payload *PayloadRunPrediction) Encode(
+	ctx context.Context,
+	store storage.ObjectStore,
+	threshold int,
+) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal task payload: %w", err)
+	}
+	if store == nil || threshold <= 0 || len(data) <= threshold {
+		return data, nil
+	}
+
+	inputs, err := json.Marshal(payload.Inputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal inputs: %w", err)
+	}
+	key := PayloadKey(payload.ID)
+	if err := store.Put(ctx, key, inputs); err != nil {
+		return nil, fmt.Errorf("failed to store inputs: %w", err)
+	}
+	offloaded := *payload
+	offloaded.Inputs = nil
+	offloaded.PayloadRef = key
+	data, err = json.Marshal(&offloaded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal task payload: %w", err)
+	}
+	payloadOffloadCounts.Inc()
+	log.Info().Msgf("task %s: stored %d bytes of inputs at %s", payload.ID, len(inputs), key)
+	return data, nil
+}
+
+// Resolve loads the offloaded inputs from the store.
+func (payload *PayloadRunPrediction) Resolve(ctx context.Context, store storage.ObjectStore) error {
+	if payload.PayloadRef == "" {
+		return nil
+	}
+	if store == nil {
+		return fmt.Errorf("object store is not configured for %s", payload.PayloadRef)
+	}
+	data, err := store.Get(ctx, payload.PayloadRef)
+	if err != nil {
+		return fmt.Errorf("failed to load inputs from %s: %w", payload.PayloadRef, err)
+	}
+	if err := json.Unmarshal(data, &payload.Inputs); err != nil {
+		return fmt.Errorf("failed to unmarshal inputs: %w", err)
+	}
+	return nil
+}
+
+// deletePayload deletes the offloaded inputs of the encoded task payload if there are any.
+func deletePayload(ctx context.Context, store storage.ObjectStore, data []byte) {
+	if store == nil {
+		return
+	}
+	var payload PayloadRunPrediction
+	if err := json.Unmarshal(data, &payload); err != nil || payload.PayloadRef == "" {
+		return
+	}
+	if err := store.Delete(ctx, payload.PayloadRef); err != nil {
+		log.Error().Msgf("failed to delete payload %s: %v", payload.PayloadRef, err)
+	}
+}
@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/storage"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPayloadOffload(t *testing.T) {
+	store, err := storage.NewLocalStore(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+	payload := PayloadRunPrediction{
+		InferRequest: platform.InferRequest{
+			ModelName: "test",
+			Inputs:    map[string]interface{}{"prompt": "a cat"},
+		},
+		ID:         "12-23",
+		APIVersion: "v1",
+	}
+
+	// Small payloads are kept in redis
+	data, err := payload.Encode(ctx, store, 1024)
+	require.NoError(t, err)
+	var decoded PayloadRunPrediction
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Empty(t, decoded.PayloadRef)
+	require.Equal(t, payload.Inputs, decoded.Inputs)
+
+	// Large payloads are offloaded
+	data, err = payload.Encode(ctx, store, 16)
+	require.NoError(t, err)
+	decoded = PayloadRunPrediction{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, PayloadKey("12-23"), decoded.PayloadRef)
+	require.Nil(t, decoded.Inputs)
+	require.Equal(t, "test", decoded.ModelName)
+
+	require.NoError(t, decoded.Resolve(ctx, store))
+	require.Equal(t, payload.Inputs, decoded.Inputs)
+
+	// The offloaded inputs are deleted together with the task
+	deletePayload(ctx, store, data)
+	err = decoded.Resolve(ctx, store)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	require.Error(t, decoded.Resolve(ctx, nil))
+}
@@ -3,22 +3,60 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/storage"
 	"github.com/hibiken/asynq"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rs/zerolog/log"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type PayloadRunPrediction struct {
 	platform.InferRequest
 	ID         string `json:"id"`
 	APIVersion string `json:"api_version" default:"v1"`
+	// The object key of the inputs if they are stored in the object store
+	PayloadRef string `json:"payload_ref,omitempty"`
+	// The unique task ID in the queue, e.g., derived from the idempotency key
+	UniqueID string `json:"unique_id,omitempty"`
 }
 
+// rateLimitedError requeues the task if the platform is rate limited, which isn't counted as a failure.
+type rateLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (err *rateLimitedError) Error() string {
+	return fmt.Sprintf("the platform is rate limited, retry after %v", err.retryAfter)
+}
+
+// isFailure returns false for the rate limited tasks, so that they are retried without using up `MaxRetry`.
+func isFailure(err error) bool {
+	var limitErr *rateLimitedError
+	return !errors.As(err, &limitErr)
+}
+
+// retryDelay retries the rate limited tasks after `Retry-After`, the canceled tasks immediately so that
+// they are cleaned up, and the other tasks with the default backoff.
+func retryDelay(n int, err error, task *asynq.Task) time.Duration {
+	var limitErr *rateLimitedError
+	if errors.As(err, &limitErr) {
+		return max(limitErr.retryAfter, time.Second)
+	}
+	if errors.Is(err, context.Canceled) {
+		return time.Second
+	}
+	return asynq.DefaultRetryDelayFunc(n, err, task)
+}
+
+// ErrDuplicateTask is returned by `DistributeTaskRunPrediction` if a task with the same unique ID is in the queue.
+var ErrDuplicateTask = errors.New("duplicate task")
+
 var predictFailureCounts = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "async_predict_failure_total",
 	Help: "Number of async prediction failures",
@@ -38,15 +76,22 @@ func (distributor *RedisTaskDistributor) DistributeTaskRunPrediction(
 	payload *PayloadRunPrediction,
 	opts ...asynq.Option,
 ) (string, error) {
-	jsonPayload, err := json.Marshal(payload)
+	jsonPayload, err := payload.Encode(ctx, distributor.store, distributor.config.PayloadStoreThreshold)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal task payload: %w", err)
+		return "", err
 	}
 
+	if payload.UniqueID != "" {
+		opts = append(opts[:len(opts):len(opts)], asynq.TaskID(payload.UniqueID))
+	}
 	task := asynq.NewTask(fmt.Sprintf("task:%s", distributor.config.TaskTypeName),
 		jsonPayload, opts...)
 	info, err := distributor.client.EnqueueContext(ctx, task)
 	if err != nil {
+		deletePayload(ctx, distributor.store, jsonPayload)
+		if errors.Is(err, asynq.ErrTaskIDConflict) {
+			return "", fmt.Errorf("%w: %s", ErrDuplicateTask, payload.UniqueID)
+		}
 		return "", fmt.Errorf("failed to enqueue task: %w", err)
 	}
 
@@ -58,24 +103,94 @@ func (distributor *RedisTaskDistributor) DistributeTaskRunPrediction(
 func (processor *RedisTaskProcessor) ProcessTaskRunPrediction(
 	ctx context.Context,
 	task *asynq.Task,
-) error {
+) (result error) {
 	var payload PayloadRunPrediction
 	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
 		log.Error().Msgf("failed to unmarshal payload")
 		return fmt.Errorf("failed to unmarshal payload: %w", asynq.SkipRetry)
 	}
+	// The offloaded inputs are kept for the retries until the task is done
+	defer func() {
+		if result == nil {
+			deletePayload(context.Background(), processor.store, task.Payload())
+		}
+	}()
+
+	// The task canceled while running is retried by asynq, which only needs to be dropped
+	if retried, _ := asynq.GetRetryCount(ctx); retried > 0 && processor.isCanceled(payload.ID) {
+		log.Info().Msgf("task %s was canceled", payload.ID)
+		return nil
+	}
 
 	info := platform.UpdateRequest{ID: payload.ID}
+	if err := payload.Resolve(ctx, processor.store); err != nil {
+		log.Error().Msgf("failed to resolve payload: %v", err)
+		if !errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("failed to resolve payload: %w", err)
+		}
+		info.Status = "failed"
+		info.ErrorInfo = "the task inputs are missing"
+		if err := processor.webhook.UpdateTaskInfo(&info); err != nil {
+			log.Error().Msgf("failed to update task info: %v", err)
+		}
+		return nil
+	}
+
+	// Return the cached outputs of the same inputs if there are any
+	cacheKey, cacheable := processor.cache.Key(&payload.InferRequest, payload.APIVersion)
+	if cacheable {
+		if outputs, ok := processor.cache.Get(ctx, payload.ModelName, cacheKey); ok {
+			info.Status = "succeeded"
+			info.Outputs = outputs
+			info.CacheHit = true
+			if err := processor.webhook.UpdateTaskInfo(&info); err != nil {
+				log.Error().Msgf("failed to update task info: %v", err)
+				return fmt.Errorf("failed to update task info")
+			}
+			return nil
+		}
+	}
+
 	info.Status = "running"
 	if err := processor.webhook.UpdateTaskInfo(&info); err != nil {
 		log.Error().Msgf("failed to update task info: %v", err)
 		return fmt.Errorf("failed to update task info")
 	}
 
-	response, err := processor.platform.Predict(&payload.InferRequest, payload.APIVersion)
+	// Persist the upstream job ID so that the job can be canceled from any replica
+	var upstreamID string
+	payload.OnSubmitted = func(id string) {
+		upstreamID = id
+		if err := processor.webhook.UpdateTaskInfo(
+			&platform.UpdateRequest{ID: payload.ID, UpstreamID: id}); err != nil {
+			log.Error().Msgf("failed to update upstream id: %v", err)
+		}
+	}
+	// The context is done when the task times out or the processor shuts down
+	response, err := processor.platform.Predict(ctx, &payload.InferRequest, payload.APIVersion)
+	if err != nil && err.StatusCode == platform.RateLimitedError && upstreamID == "" && ctx.Err() == nil {
+		// The job wasn't submitted, so the task waits in the queue for the capacity instead of failing
+		log.Warn().Msgf("task %s is requeued: %v", payload.ID, err)
+		info.Status = "pending"
+		if err := processor.webhook.UpdateTaskInfo(&info); err != nil {
+			log.Error().Msgf("failed to update task info: %v", err)
+		}
+		return &rateLimitedError{retryAfter: err.RetryAfter}
+	}
 	if err != nil {
 		log.Error().Msgf("failed to run prediction: %v", err)
 		info.Status = "failed"
+		// The context is canceled if the task is canceled via `/cancel` on any agent
+		if (err.StatusCode == platform.CanceledError && ctx.Err() == nil) || errors.Is(ctx.Err(), context.Canceled) {
+			info.Status = "canceled"
+		}
+		if (err.StatusCode == platform.TimeoutError || ctx.Err() != nil) && upstreamID != "" {
+			// Stop the upstream job so that it is no longer billed
+			cancelRequest := platform.CancelRequest{ModelName: payload.ModelName, UpstreamID: upstreamID}
+			if e := processor.platform.Cancel(&cancelRequest); e != nil {
+				log.Error().Msgf("failed to cancel upstream job %s: %v", upstreamID, e)
+			}
+		}
 		info.ErrorInfo = err.Error()
 		if err := processor.webhook.UpdateTaskInfo(&info); err != nil {
 			log.Error().Msgf("failed to update task info: %v", err)
@@ -98,9 +213,22 @@ func (processor *RedisTaskProcessor) ProcessTaskRunPrediction(
 			}
 		}
 	}
+	if cacheable {
+		processor.cache.Set(ctx, cacheKey, response.Outputs)
+	}
 	if err := processor.webhook.UpdateTaskInfo(&info); err != nil {
 		log.Error().Msgf("failed to update task info: %v", err)
 		return fmt.Errorf("failed to update task info")
 	}
 	return nil
 }
+
+// isCanceled returns true if the task has been canceled by the user.
+func (processor *RedisTaskProcessor) isCanceled(id string) bool {
+	task, err := processor.webhook.GetTaskInfoObject(id)
+	if err != nil {
+		log.Error().Msgf("failed to get task info: %v", err)
+		return false
+	}
+	return task.Status == "canceled"
+}
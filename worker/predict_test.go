@@ -0,0 +1,252 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"github.com/HyperGAI/serving-agent/cache"
+	"github.com/HyperGAI/serving-agent/platform"
+	mockplatform "github.com/HyperGAI/serving-agent/platform/mock"
+	"github.com/HyperGAI/serving-agent/storage"
+	"github.com/hibiken/asynq"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"testing"
+	"time"
+)
+
+type memoryCacheStore struct {
+	values map[string][]byte
+}
+
+func (store *memoryCacheStore) Get(_ context.Context, key string) ([]byte, error) {
+	if value, ok := store.values[key]; ok {
+		return value, nil
+	}
+	return nil, cache.ErrMiss
+}
+
+func (store *memoryCacheStore) Set(_ context.Context, key string, value []byte, _ time.Duration) error {
+	store.values[key] = value
+	return nil
+}
+
+// unavailableStore fails to load the offloaded inputs
+type unavailableStore struct {
+	storage.ObjectStore
+}
+
+func (store *unavailableStore) Get(_ context.Context, _ string) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestProcessTaskRunPrediction(t *testing.T) {
+	outputs := map[string]interface{}{"output": "a.png"}
+	testCases := []struct {
+		name          string
+		buildStubs    func(p *mockplatform.MockPlatform, store storage.ObjectStore, responseCache *cache.ResponseCache)
+		unavailable   bool
+		canceled      bool
+		checkResponse func(t *testing.T, err error, updates []platform.UpdateRequest, payloadKept bool)
+	}{
+		{
+			name: "OK",
+			buildStubs: func(p *mockplatform.MockPlatform, _ storage.ObjectStore, _ *cache.ResponseCache) {
+				p.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Eq("v1")).Times(1).
+					DoAndReturn(func(_ context.Context, request *platform.InferRequest, _ string) (
+						*platform.InferResponse, *platform.RequestError) {
+						require.Equal(t, "a cat", request.Inputs["prompt"])
+						request.OnSubmitted("job-1")
+						return &platform.InferResponse{Outputs: map[string]interface{}{
+							"output": "a.png", "running_time": "1.5s"}}, nil
+					})
+			},
+			checkResponse: func(t *testing.T, err error, updates []platform.UpdateRequest, payloadKept bool) {
+				require.NoError(t, err)
+				require.Len(t, updates, 3)
+				require.Equal(t, "running", updates[0].Status)
+				require.Equal(t, "job-1", updates[1].UpstreamID)
+				require.Equal(t, "succeeded", updates[2].Status)
+				require.Equal(t, "1.5s", updates[2].RunningTime)
+				require.Equal(t, outputs, updates[2].Outputs)
+				require.False(t, payloadKept)
+			},
+		},
+		{
+			name: "Payload missing",
+			buildStubs: func(p *mockplatform.MockPlatform, store storage.ObjectStore, _ *cache.ResponseCache) {
+				require.NoError(t, store.Delete(context.Background(), PayloadKey("12-23")))
+				p.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, err error, updates []platform.UpdateRequest, _ bool) {
+				require.NoError(t, err)
+				require.Len(t, updates, 1)
+				require.Equal(t, "failed", updates[0].Status)
+				require.Equal(t, "the task inputs are missing", updates[0].ErrorInfo)
+			},
+		},
+		{
+			name:        "Store unavailable",
+			unavailable: true,
+			buildStubs: func(p *mockplatform.MockPlatform, _ storage.ObjectStore, _ *cache.ResponseCache) {
+				p.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, err error, updates []platform.UpdateRequest, payloadKept bool) {
+				// The task is retried with the same payload
+				require.Error(t, err)
+				require.True(t, isFailure(err))
+				require.Empty(t, updates)
+				require.True(t, payloadKept)
+			},
+		},
+		{
+			name: "Cache hit",
+			buildStubs: func(p *mockplatform.MockPlatform, _ storage.ObjectStore, responseCache *cache.ResponseCache) {
+				key, ok := responseCache.Key(&platform.InferRequest{
+					ModelName: "test", Inputs: map[string]interface{}{"prompt": "a cat"}}, "v1")
+				require.True(t, ok)
+				responseCache.Set(context.Background(), key, outputs)
+				p.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, err error, updates []platform.UpdateRequest, payloadKept bool) {
+				require.NoError(t, err)
+				require.Len(t, updates, 1)
+				require.Equal(t, "succeeded", updates[0].Status)
+				require.True(t, updates[0].CacheHit)
+				require.Equal(t, outputs, updates[0].Outputs)
+				require.False(t, payloadKept)
+			},
+		},
+		{
+			name: "Rate limited",
+			buildStubs: func(p *mockplatform.MockPlatform, _ storage.ObjectStore, _ *cache.ResponseCache) {
+				e := platform.NewRequestError(platform.RateLimitedError, errors.New("too many requests"))
+				e.RetryAfter = 5 * time.Second
+				p.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).Return(nil, e)
+			},
+			checkResponse: func(t *testing.T, err error, updates []platform.UpdateRequest, payloadKept bool) {
+				// The task is requeued without using up the retries
+				var limitErr *rateLimitedError
+				require.ErrorAs(t, err, &limitErr)
+				require.False(t, isFailure(err))
+				require.Equal(t, 5*time.Second, retryDelay(1, err, nil))
+				require.Len(t, updates, 2)
+				require.Equal(t, "running", updates[0].Status)
+				require.Equal(t, "pending", updates[1].Status)
+				require.True(t, payloadKept)
+			},
+		},
+		{
+			name: "Canceled",
+			buildStubs: func(p *mockplatform.MockPlatform, _ storage.ObjectStore, _ *cache.ResponseCache) {
+				p.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					Return(nil, platform.NewRequestError(platform.CanceledError, errors.New("canceled")))
+				p.EXPECT().Cancel(gomock.Any()).Times(0)
+			},
+			checkResponse: func(t *testing.T, err error, updates []platform.UpdateRequest, payloadKept bool) {
+				require.NoError(t, err)
+				require.Len(t, updates, 2)
+				require.Equal(t, "canceled", updates[1].Status)
+				require.False(t, payloadKept)
+			},
+		},
+		{
+			name:     "Canceled by the user",
+			canceled: true,
+			buildStubs: func(p *mockplatform.MockPlatform, _ storage.ObjectStore, _ *cache.ResponseCache) {
+				p.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(ctx context.Context, request *platform.InferRequest, _ string) (
+						*platform.InferResponse, *platform.RequestError) {
+						request.OnSubmitted("job-1")
+						<-ctx.Done()
+						return nil, platform.NewRequestError(platform.CanceledError, ctx.Err())
+					})
+				// The upstream job is stopped
+				p.EXPECT().Cancel(gomock.Eq(&platform.CancelRequest{ModelName: "test", UpstreamID: "job-1"})).
+					Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, err error, updates []platform.UpdateRequest, payloadKept bool) {
+				require.NoError(t, err)
+				require.Len(t, updates, 3)
+				require.Equal(t, "canceled", updates[2].Status)
+				// The task retried by asynq is cleaned up soon
+				require.Equal(t, time.Second, retryDelay(0, context.Canceled, nil))
+			},
+		},
+		{
+			name: "Timeout",
+			buildStubs: func(p *mockplatform.MockPlatform, _ storage.ObjectStore, _ *cache.ResponseCache) {
+				p.EXPECT().Predict(gomock.Any(), gomock.Any(), gomock.Any()).Times(1).
+					DoAndReturn(func(_ context.Context, request *platform.InferRequest, _ string) (
+						*platform.InferResponse, *platform.RequestError) {
+						request.OnSubmitted("job-1")
+						return nil, platform.NewRequestError(platform.TimeoutError, errors.New("timeout"))
+					})
+				// The upstream job is stopped
+				p.EXPECT().Cancel(gomock.Eq(&platform.CancelRequest{ModelName: "test", UpstreamID: "job-1"})).
+					Times(1).Return(nil)
+			},
+			checkResponse: func(t *testing.T, err error, updates []platform.UpdateRequest, payloadKept bool) {
+				require.NoError(t, err)
+				require.Len(t, updates, 3)
+				require.Equal(t, "failed", updates[2].Status)
+				require.False(t, payloadKept)
+			},
+		},
+	}
+
+	for i := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.canceled {
+				// `/cancel` cancels the context of the running task
+				time.AfterFunc(50*time.Millisecond, cancel)
+			}
+			local, err := storage.NewLocalStore(t.TempDir())
+			require.NoError(t, err)
+			var store storage.ObjectStore = local
+			if tc.unavailable {
+				store = &unavailableStore{ObjectStore: local}
+			}
+			responseCache, err := cache.NewResponseCacheWithStore(
+				&memoryCacheStore{values: make(map[string][]byte)}, time.Hour, &cache.Config{})
+			require.NoError(t, err)
+
+			payload := PayloadRunPrediction{
+				InferRequest: platform.InferRequest{
+					ModelName: "test",
+					Inputs:    map[string]interface{}{"prompt": "a cat"},
+				},
+				ID:         "12-23",
+				APIVersion: "v1",
+			}
+			data, err := payload.Encode(ctx, local, 16)
+			require.NoError(t, err)
+
+			p := mockplatform.NewMockPlatform(ctrl)
+			webhook := mockplatform.NewMockWebhook(ctrl)
+			tc.buildStubs(p, local, responseCache)
+			var updates []platform.UpdateRequest
+			webhook.EXPECT().UpdateTaskInfo(gomock.Any()).AnyTimes().
+				DoAndReturn(func(info *platform.UpdateRequest) error {
+					require.Equal(t, "12-23", info.ID)
+					updates = append(updates, *info)
+					return nil
+				})
+
+			processor := &RedisTaskProcessor{
+				platform: p,
+				webhook:  webhook,
+				store:    store,
+				cache:    responseCache,
+			}
+			err = processor.ProcessTaskRunPrediction(ctx, asynq.NewTask("task:test", data))
+			_, e := local.Get(context.Background(), PayloadKey("12-23"))
+			tc.checkResponse(t, err, updates, e == nil)
+		})
+	}
+}
@@ -5,7 +5,9 @@ package worker
 import (
 	"context"
 	"fmt"
+	"github.com/HyperGAI/serving-agent/cache"
 	"github.com/HyperGAI/serving-agent/platform"
+	"github.com/HyperGAI/serving-agent/storage"
 	"github.com/HyperGAI/serving-agent/utils"
 	"github.com/hibiken/asynq"
 	"github.com/redis/go-redis/v9"
@@ -23,9 +25,17 @@ type RedisTaskProcessor struct {
 	server   *asynq.Server
 	platform platform.Platform
 	webhook  platform.Webhook
+	store    storage.ObjectStore
+	cache    *cache.ResponseCache
 }
 
-func NewRedisTaskProcessor(config utils.Config, platform platform.Platform, webhook platform.Webhook) *RedisTaskProcessor {
+func NewRedisTaskProcessor(
+	config utils.Config,
+	platform platform.Platform,
+	webhook platform.Webhook,
+	store storage.ObjectStore,
+	responseCache *cache.ResponseCache,
+) *RedisTaskProcessor {
 	var redisOpt asynq.RedisConnOpt
 	if config.RedisClusterMode {
 		// Support redis cluster (https://github.com/hibiken/asynq/wiki/Redis-Cluster)
@@ -49,6 +59,8 @@ func NewRedisTaskProcessor(config utils.Config, platform platform.Platform, webh
 				QueueDefault:  5,
 			},
 			ShutdownTimeout: time.Duration(config.TaskTimeout) * time.Second,
+			IsFailure:       isFailure,
+			RetryDelayFunc:  retryDelay,
 			ErrorHandler: asynq.ErrorHandlerFunc(func(ctx context.Context, task *asynq.Task, err error) {
 				log.Error().Err(err).Str("type", task.Type()).
 					Bytes("payload", task.Payload()).Msg("process task failed")
@@ -62,6 +74,8 @@ func NewRedisTaskProcessor(config utils.Config, platform platform.Platform, webh
 		server:   server,
 		platform: platform,
 		webhook:  webhook,
+		store:    store,
+		cache:    responseCache,
 	}
 }
 